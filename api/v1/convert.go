@@ -0,0 +1,273 @@
+package v1
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+// FromTask converts an internal task into its v1 form.
+func FromTask(t task.Task) Task {
+	v := Task{
+		ID:          t.ID,
+		TaskSpec:    specFromTask(t),
+		State:       t.State.String(),
+		ContainerID: t.ContainerID,
+		Health:      t.Health,
+		StartTime:   timePtr(t.StartTime),
+		FinishTime:  timePtr(t.FinishTime),
+	}
+	if t.GroupID != uuid.Nil {
+		groupID := t.GroupID
+		v.GroupID = &groupID
+	}
+	return v
+}
+
+// FromDetail converts a task detail into its v1 form.
+func FromDetail(d task.Detail) TaskDetail {
+	v := TaskDetail{
+		Task:           FromTask(*d.Task),
+		Node:           d.Node,
+		History:        []StateChange{},
+		ContainerError: d.ContainerError,
+	}
+	for _, c := range d.Task.History {
+		v.History = append(v.History, StateChange{State: c.State.String(), Time: c.Time, Reason: c.Reason})
+	}
+	if c := d.Container; c != nil {
+		v.Container = &ContainerStatus{
+			ID:            c.ID,
+			Status:        c.Status,
+			Running:       c.Running,
+			ExitCode:      c.ExitCode,
+			Error:         c.Error,
+			StartedAt:     timePtr(c.StartedAt),
+			FinishedAt:    timePtr(c.FinishedAt),
+			RestartCount:  c.RestartCount,
+			IPAddresses:   c.IPAddresses,
+			Ports:         c.Ports,
+			Health:        c.Health,
+			FailingStreak: c.FailingStreak,
+		}
+	}
+	return v
+}
+
+// ToTask converts a v1 task, e.g. one returned by a worker, back into an internal task.
+func (v Task) ToTask() (task.Task, error) {
+	t, err := v.TaskSpec.toTask(v.ID)
+	if err != nil {
+		return task.Task{}, err
+	}
+	if t.State, err = task.ParseState(v.State); err != nil {
+		return task.Task{}, err
+	}
+	t.ContainerID = v.ContainerID
+	t.Health = v.Health
+	if v.GroupID != nil {
+		t.GroupID = *v.GroupID
+	}
+	if v.StartTime != nil {
+		t.StartTime = *v.StartTime
+	}
+	if v.FinishTime != nil {
+		t.FinishTime = *v.FinishTime
+	}
+	return t, nil
+}
+
+// ToTask converts the request into a new Pending task.
+func (r CreateTaskRequest) ToTask() (task.Task, error) {
+	id := r.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	return r.TaskSpec.toTask(id)
+}
+
+// NewCreateTaskRequest is the request creating a copy of t, with the same ID.
+func NewCreateTaskRequest(t task.Task) CreateTaskRequest {
+	return CreateTaskRequest{ID: t.ID, TaskSpec: specFromTask(t)}
+}
+
+// ToPatch converts the request into a task.Patch.
+func (p TaskPatch) ToPatch() task.Patch {
+	return task.Patch{
+		Memory:        p.Memory,
+		Cpu:           p.Cpu,
+		RestartPolicy: p.RestartPolicy,
+		Labels:        p.Labels,
+		Image:         p.Image,
+		Env:           p.Env,
+		Cmd:           p.Cmd,
+	}
+}
+
+// FromGroup converts an internal group into its v1 form.
+func FromGroup(g task.Group) Group {
+	v := Group{
+		ID:         g.ID,
+		Name:       g.Name,
+		State:      g.State.String(),
+		Tasks:      []Task{},
+		StartTime:  timePtr(g.StartTime),
+		FinishTime: timePtr(g.FinishTime),
+	}
+	for _, t := range g.Tasks {
+		v.Tasks = append(v.Tasks, FromTask(t))
+	}
+	return v
+}
+
+// ToGroup converts the request into a new Pending group.
+func (r CreateGroupRequest) ToGroup() (task.Group, error) {
+	g := task.Group{ID: r.ID, Name: r.Name, Tasks: []task.Task{}}
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	for i, tr := range r.Tasks {
+		t, err := tr.ToTask()
+		if err != nil {
+			return task.Group{}, fmt.Errorf("tasks[%d]: %w", i, err)
+		}
+		t.GroupID = g.ID
+		g.Tasks = append(g.Tasks, t)
+	}
+	return g, nil
+}
+
+// NewCreateGroupRequest is the request creating a copy of g, with the same IDs.
+func NewCreateGroupRequest(g task.Group) CreateGroupRequest {
+	r := CreateGroupRequest{ID: g.ID, Name: g.Name, Tasks: []CreateTaskRequest{}}
+	for _, t := range g.Tasks {
+		r.Tasks = append(r.Tasks, NewCreateTaskRequest(t))
+	}
+	return r
+}
+
+// FromFieldChanges converts the changes of the spec of a task into their v1 form, named and valued
+// as in TaskSpec.
+func FromFieldChanges(changes []task.FieldChange) []FieldChange {
+	v := []FieldChange{}
+	for _, c := range changes {
+		v = append(v, FieldChange{
+			Field: strings.ToLower(c.Field[:1]) + c.Field[1:],
+			Old:   specValue(c.Old),
+			New:   specValue(c.New),
+		})
+	}
+	return v
+}
+
+// specValue is a value of a field of task.Task as in TaskSpec.
+func specValue(value any) any {
+	switch v := value.(type) {
+	case nat.PortSet:
+		ports := []string{}
+		for port := range v {
+			ports = append(ports, string(port))
+		}
+		slices.Sort(ports)
+		return ports
+	case time.Duration:
+		if v <= 0 {
+			return ""
+		}
+		return v.String()
+	}
+	return value
+}
+
+func specFromTask(t task.Task) TaskSpec {
+	s := TaskSpec{
+		Name:          t.Name,
+		Image:         t.Image,
+		Env:           t.Env,
+		Cmd:           t.Cmd,
+		Cpu:           t.Cpu,
+		Memory:        t.Memory,
+		Disk:          t.Disk,
+		PortBindings:  t.PortBindings,
+		RestartPolicy: t.RestartPolicy,
+		NetworkMode:   t.NetworkMode,
+		Labels:        t.Labels,
+		Revision:      t.Revision,
+	}
+	for port := range t.ExposedPorts {
+		s.ExposedPorts = append(s.ExposedPorts, string(port))
+	}
+	slices.Sort(s.ExposedPorts)
+	if t.StopGracePeriod > 0 {
+		s.StopGracePeriod = t.StopGracePeriod.String()
+	}
+	return s
+}
+
+func (s TaskSpec) toTask(id uuid.UUID) (task.Task, error) {
+	t := task.Task{
+		ID:            id,
+		Name:          s.Name,
+		State:         task.Pending,
+		Image:         s.Image,
+		Env:           s.Env,
+		Cmd:           s.Cmd,
+		Cpu:           s.Cpu,
+		Memory:        s.Memory,
+		Disk:          s.Disk,
+		PortBindings:  s.PortBindings,
+		RestartPolicy: s.RestartPolicy,
+		NetworkMode:   s.NetworkMode,
+		Labels:        s.Labels,
+		Revision:      s.Revision,
+	}
+	if len(s.ExposedPorts) > 0 {
+		t.ExposedPorts = nat.PortSet{}
+		for _, p := range s.ExposedPorts {
+			proto, port := nat.SplitProtoPort(p)
+			if _, err := nat.ParsePort(port); err != nil || port == "" {
+				return task.Task{}, errdefs.New(errdefs.InvalidArgument, "invalid exposed port %q", p)
+			}
+			t.ExposedPorts[nat.Port(port+"/"+proto)] = struct{}{}
+		}
+	}
+	if s.StopGracePeriod != "" {
+		d, err := time.ParseDuration(s.StopGracePeriod)
+		if err != nil || d < 0 {
+			return task.Task{}, errdefs.New(errdefs.InvalidArgument, "invalid stop grace period %q", s.StopGracePeriod)
+		}
+		t.StopGracePeriod = d
+	}
+	return t, nil
+}
+
+// FromFields converts the fields of a validation error, see errdefs.FieldsOf, into their v1 form,
+// named after the JSON fields of the request: Task.RestartPolicy is restartPolicy.
+func FromFields(fields []errdefs.FieldViolation) []errdefs.FieldViolation {
+	var converted []errdefs.FieldViolation
+	for _, f := range fields {
+		path := strings.Split(strings.TrimPrefix(f.Field, "Task."), ".")
+		for i, name := range path {
+			if strings.ToUpper(name) == name {
+				path[i] = strings.ToLower(name)
+			} else {
+				path[i] = strings.ToLower(name[:1]) + name[1:]
+			}
+		}
+		converted = append(converted, errdefs.FieldViolation{Field: strings.Join(path, "."), Description: f.Description})
+	}
+	return converted
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
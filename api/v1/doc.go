@@ -0,0 +1,21 @@
+// Package v1 defines version 1 of the worker API: the requests and responses of the /v1 routes,
+// their conversion from and to the internal types, and the OpenAPI document describing them,
+// served at GET /v1/openapi.json.
+//
+// The types of this package are the wire format. They are deliberately separate from task.Task and
+// friends, which are free to change with the code; a refactoring of an internal type only needs the
+// conversions here to be updated.
+//
+// # Compatibility
+//
+// Within v1:
+//
+//   - fields and endpoints may be added, they are never removed, renamed or given another type;
+//   - an added request field is optional, leaving it out keeps the previous behaviour;
+//   - state names, error statuses and the meaning of existing fields do not change;
+//   - requests with unknown fields are rejected, responses may gain fields, which clients must ignore.
+//
+// Any other change goes into a new version, served next to v1 under its own prefix until v1 is
+// retired. The unversioned routes (/tasks, /groups, /stats...) predate v1 and encode the internal
+// types as they are, they are kept for existing clients but new ones should use /v1.
+package v1
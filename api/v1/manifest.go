@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+// ManifestVersion and ManifestKind identify the manifest format, so that it can change in later versions.
+const (
+	ManifestVersion = "tesseract/v1"
+	ManifestKind    = "TaskList"
+)
+
+// Manifest declares tasks by name, the body of POST /manifests/apply, /manifests/diff and
+// /manifests/delete on the manager. Applying it creates the tasks missing and updates or replaces the
+// ones whose spec differs, so that one task of each name runs with the spec of the manifest.
+type Manifest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// Tasks are keyed by their name, which is required and unique within the manifest
+	Tasks []TaskSpec `json:"tasks"`
+}
+
+// DecodeManifest reads a JSON manifest, rejecting unknown fields.
+func DecodeManifest(r io.Reader) (Manifest, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	m := Manifest{}
+	if err := d.Decode(&m); err != nil {
+		return Manifest{}, errdefs.New(errdefs.InvalidArgument, "invalid manifest: %v", err)
+	}
+	return m, nil
+}
+
+// ToTasks checks the manifest and returns its tasks, without IDs.
+func (m Manifest) ToTasks() ([]task.Task, error) {
+	if m.APIVersion != ManifestVersion {
+		return nil, errdefs.New(errdefs.InvalidArgument, "invalid manifest apiVersion %q, expected %s", m.APIVersion, ManifestVersion)
+	}
+	if m.Kind != ManifestKind {
+		return nil, errdefs.New(errdefs.InvalidArgument, "invalid manifest kind %q, expected %s", m.Kind, ManifestKind)
+	}
+
+	tasks := []task.Task{}
+	names := map[string]bool{}
+	for i, s := range m.Tasks {
+		if s.Name == "" {
+			return nil, errdefs.New(errdefs.InvalidArgument, "tasks[%d]: name is required", i)
+		}
+		if names[s.Name] {
+			return nil, errdefs.New(errdefs.InvalidArgument, "tasks[%d]: %s is declared twice", i, s.Name)
+		}
+		names[s.Name] = true
+
+		t, err := s.toTask(uuid.Nil)
+		if err != nil {
+			return nil, errdefs.New(errdefs.CodeOf(err), "tasks[%d] %s: %w", i, s.Name, err)
+		}
+		// The revision is the one of the running task, bumped when it is replaced.
+		t.Revision = 0
+		// The defaults are the ones of the tasks submitted one by one, so that they compare equal.
+		t.SetDefaults()
+		if err := task.ValidateSpec(t); err != nil {
+			return nil, errdefs.New(errdefs.CodeOf(err), "tasks[%d] %s: %w", i, s.Name, err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// Names returns the names of the tasks of the manifest, in order.
+func (m Manifest) Names() []string {
+	names := []string{}
+	for _, s := range m.Tasks {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// The actions applying a manifest takes for each of its tasks.
+const (
+	// ActionCreate creates a task, none of this name is running
+	ActionCreate = "create"
+
+	// ActionUpdate patches the running task, in place or by replacing its container, keeping its ID
+	ActionUpdate = "update"
+
+	// ActionReplace stops the running task and creates a new one, since the changes cannot be patched
+	ActionReplace = "replace"
+
+	// ActionUnchanged leaves the running task alone, its spec is the one of the manifest
+	ActionUnchanged = "unchanged"
+
+	// ActionDelete stops the running task, and ActionAbsent is a task to delete which is not running
+	ActionDelete = "delete"
+	ActionAbsent = "absent"
+)
+
+// ManifestChange is what applying or deleting a manifest does, or would do, to one of its tasks.
+type ManifestChange struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+
+	// TaskID is the running task, absent when there is none
+	TaskID *uuid.UUID `json:"taskId,omitempty"`
+
+	// NewTaskID is the task created by a create or a replace, absent on a dry run
+	NewTaskID *uuid.UUID `json:"newTaskId,omitempty"`
+
+	// Changes are the fields of the running task which differ in the manifest
+	Changes []FieldChange `json:"changes,omitempty"`
+
+	// Error says why the action failed, the other tasks of the manifest are still acted upon
+	Error string `json:"error,omitempty"`
+}
+
+// FieldChange is a field of a task whose value differs between the running task and the manifest.
+type FieldChange struct {
+	// Field is the name of the field of TaskSpec, e.g. restartPolicy
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
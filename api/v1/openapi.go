@@ -0,0 +1,21 @@
+package v1
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI is the OpenAPI 3 document of the v1 worker API. It is kept by hand next to the types,
+// a change to one goes with a change to the other.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// OpenAPIHandler serves the OpenAPI document.
+func OpenAPIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(OpenAPI)
+	}
+}
@@ -0,0 +1,133 @@
+package v1
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+// schema is the part of an OpenAPI schema the types are checked against.
+type schema struct {
+	Ref        string              `json:"$ref"`
+	AllOf      []schema            `json:"allOf"`
+	Required   []string            `json:"required"`
+	Properties map[string]struct{} `json:"properties"`
+}
+
+// TestOpenAPISchemas checks that the schemas of the OpenAPI document have the properties of the
+// types, so that a field added to one is added to the other.
+func TestOpenAPISchemas(t *testing.T) {
+	types := map[string]any{
+		"TaskSpec":           TaskSpec{},
+		"CreateTaskRequest":  CreateTaskRequest{},
+		"TaskPatch":          TaskPatch{},
+		"Task":               Task{},
+		"TaskList":           TaskList{},
+		"TaskDetail":         TaskDetail{},
+		"StateChange":        StateChange{},
+		"ContainerStatus":    ContainerStatus{},
+		"TaskStats":          TaskStats{},
+		"CreateGroupRequest": CreateGroupRequest{},
+		"Group":              Group{},
+		"GroupList":          GroupList{},
+		"NodeStats":          NodeStats{},
+		"Error":              Error{},
+		"FieldViolation":     errdefs.FieldViolation{},
+	}
+
+	var doc struct {
+		Components struct {
+			Schemas map[string]schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(OpenAPI, &doc); err != nil {
+		t.Fatalf("decoding openapi.json: %v", err)
+	}
+	schemas := doc.Components.Schemas
+
+	for name := range schemas {
+		if _, ok := types[name]; !ok {
+			t.Errorf("schema %s has no type", name)
+		}
+	}
+	for name, v := range types {
+		t.Run(name, func(t *testing.T) {
+			s, ok := schemas[name]
+			if !ok {
+				t.Fatalf("no schema for %s", name)
+			}
+			properties, required := map[string]bool{}, []string{}
+			flatten(t, schemas, s, properties, &required)
+
+			fields := jsonFields(reflect.TypeOf(v))
+			for field := range fields {
+				if !properties[field] {
+					t.Errorf("field %s is not a property of the schema", field)
+				}
+			}
+			for property := range properties {
+				if _, ok := fields[property]; !ok {
+					t.Errorf("property %s is not a field of the type", property)
+				}
+			}
+			// A required property is always encoded.
+			for _, property := range required {
+				if omitEmpty, ok := fields[property]; ok && omitEmpty {
+					t.Errorf("property %s is required, its field is omitempty", property)
+				}
+			}
+		})
+	}
+}
+
+// flatten adds the properties of s to properties, following $ref and allOf.
+func flatten(t *testing.T, schemas map[string]schema, s schema, properties map[string]bool, required *[]string) {
+	t.Helper()
+	if s.Ref != "" {
+		ref, ok := schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			t.Fatalf("unknown $ref %s", s.Ref)
+		}
+		flatten(t, schemas, ref, properties, required)
+	}
+	for _, part := range s.AllOf {
+		flatten(t, schemas, part, properties, required)
+	}
+	for property := range s.Properties {
+		properties[property] = true
+	}
+	for _, property := range s.Required {
+		if !slices.Contains(*required, property) {
+			*required = append(*required, property)
+		}
+	}
+}
+
+// jsonFields returns the names the fields of the struct type encode to, embedded structs included,
+// and whether they are omitempty.
+func jsonFields(typ reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		tag, hasTag := f.Tag.Lookup("json")
+		if f.Anonymous && !hasTag {
+			for name, omitEmpty := range jsonFields(f.Type) {
+				fields[name] = omitEmpty
+			}
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = slices.Contains(strings.Split(options, ","), "omitempty")
+	}
+	return fields
+}
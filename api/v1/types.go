@@ -0,0 +1,231 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+// TaskSpec is what a client asks for when creating a task.
+type TaskSpec struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+
+	// Cpu is the number of CPU cores, Memory and Disk are in bytes
+	Cpu    float64 `json:"cpu,omitempty"`
+	Memory int     `json:"memory,omitempty"`
+	Disk   int     `json:"disk,omitempty"`
+
+	// ExposedPorts are container ports such as "80/tcp"
+	ExposedPorts []string `json:"exposedPorts,omitempty"`
+
+	// PortBindings maps container ports to host ports
+	PortBindings map[string]string `json:"portBindings,omitempty"`
+
+	// RestartPolicy is one of always, unless-stopped or on-failure, none when empty
+	RestartPolicy string `json:"restartPolicy,omitempty"`
+
+	// NetworkMode is the Docker network mode of the container, the Docker default when empty
+	NetworkMode string `json:"networkMode,omitempty"`
+
+	// StopGracePeriod is a duration such as "30s", the default of the worker when empty
+	StopGracePeriod string `json:"stopGracePeriod,omitempty"`
+
+	// Env holds the environment variables of the container, as KEY=value
+	Env []string `json:"env,omitempty"`
+
+	// Cmd is the command of the container, the default of the image when empty
+	Cmd []string `json:"cmd,omitempty"`
+
+	// Labels are key/value pairs describing the task, which listings can filter on
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Revision is the revision of the spec the task was created from, e.g. of its service
+	Revision int `json:"revision,omitempty"`
+}
+
+// CreateTaskRequest is the body of POST /v1/tasks.
+type CreateTaskRequest struct {
+	// ID is the ID of the task, one is generated when it is left out
+	ID uuid.UUID `json:"id,omitempty"`
+
+	TaskSpec
+}
+
+// Task is a task as returned by the API.
+type Task struct {
+	ID uuid.UUID `json:"id"`
+
+	TaskSpec
+
+	// State is one of pending, scheduled, running, completed or failed
+	State string `json:"state"`
+
+	ContainerID string `json:"containerId,omitempty"`
+
+	// Health is starting, healthy or unhealthy, empty when the image has no health check
+	Health string `json:"health,omitempty"`
+
+	// GroupID is the ID of the group of the task, if any
+	GroupID *uuid.UUID `json:"groupId,omitempty"`
+
+	StartTime  *time.Time `json:"startTime,omitempty"`
+	FinishTime *time.Time `json:"finishTime,omitempty"`
+}
+
+// TaskDetail is the response of GET /v1/tasks/{taskID}: a task with the node running it, the history
+// of its states and what Docker reports about its container.
+type TaskDetail struct {
+	Task
+
+	// Node is the worker the task was sent to, empty while it is pending
+	Node string `json:"node,omitempty"`
+
+	// History lists the states of the task, oldest first
+	History []StateChange `json:"history"`
+
+	// Container is absent when there is no container yet or it could not be inspected,
+	// containerError then says why in the latter case
+	Container      *ContainerStatus `json:"container,omitempty"`
+	ContainerError string           `json:"containerError,omitempty"`
+}
+
+// StateChange is an entry of the history of a task.
+type StateChange struct {
+	State  string    `json:"state"`
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// ContainerStatus is what Docker reports about the container of a task.
+type ContainerStatus struct {
+	ID string `json:"id"`
+
+	// Status is one of created, running, paused, restarting, removing, exited or dead
+	Status   string `json:"status"`
+	Running  bool   `json:"running"`
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+	RestartCount int        `json:"restartCount"`
+
+	// IPAddresses maps the networks of the container to its address in each of them
+	IPAddresses map[string]string `json:"ipAddresses"`
+
+	// Ports maps the exposed ports to the host addresses they are bound to
+	Ports map[string][]string `json:"ports"`
+
+	Health        string `json:"health,omitempty"`
+	FailingStreak int    `json:"failingStreak,omitempty"`
+}
+
+// TaskPatch is the body of PATCH /v1/tasks/{taskID}, the fields left out are unchanged.
+// Memory, cpu and restartPolicy are applied to the running container in place and labels are only
+// recorded; a new image, env or cmd replaces the container, keeping the ID and bumping the revision.
+type TaskPatch struct {
+	Memory        *int     `json:"memory,omitempty"`
+	Cpu           *float64 `json:"cpu,omitempty"`
+	RestartPolicy *string  `json:"restartPolicy,omitempty"`
+
+	// Labels are merged into those of the task, a null value removes the label
+	Labels map[string]*string `json:"labels,omitempty"`
+
+	Image *string   `json:"image,omitempty"`
+	Env   *[]string `json:"env,omitempty"`
+	Cmd   *[]string `json:"cmd,omitempty"`
+}
+
+// TaskList is the response of GET /v1/tasks.
+type TaskList struct {
+	Items []Task `json:"items"`
+
+	// NextCursor is passed as the cursor parameter to get the next page, it is empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// TaskStats is the resource usage of the container of a task.
+type TaskStats struct {
+	TaskID      uuid.UUID `json:"taskId"`
+	ContainerID string    `json:"containerId"`
+	Timestamp   time.Time `json:"timestamp"`
+
+	// CpuCores is the number of CPU cores in use, next to the cpu of the task
+	CpuCores     float64 `json:"cpuCores"`
+	CpuRequested float64 `json:"cpuRequested"`
+
+	// Memory figures are in bytes
+	MemoryUsage     uint64 `json:"memoryUsage"`
+	MemoryLimit     uint64 `json:"memoryLimit"`
+	MemoryRequested int    `json:"memoryRequested"`
+
+	NetworkRxBytes  uint64 `json:"networkRxBytes"`
+	NetworkTxBytes  uint64 `json:"networkTxBytes"`
+	BlockReadBytes  uint64 `json:"blockReadBytes"`
+	BlockWriteBytes uint64 `json:"blockWriteBytes"`
+	Pids            uint64 `json:"pids"`
+}
+
+// CreateGroupRequest is the body of POST /v1/groups.
+type CreateGroupRequest struct {
+	// ID is the ID of the group, one is generated when it is left out
+	ID   uuid.UUID `json:"id,omitempty"`
+	Name string    `json:"name"`
+
+	// Tasks are started in order and share the network namespace of the first one
+	Tasks []CreateTaskRequest `json:"tasks"`
+}
+
+// Group is a group of tasks as returned by the API.
+type Group struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+
+	// State sums up the states of the tasks, see Task
+	State string `json:"state"`
+	Tasks []Task `json:"tasks"`
+
+	StartTime  *time.Time `json:"startTime,omitempty"`
+	FinishTime *time.Time `json:"finishTime,omitempty"`
+}
+
+// GroupList is the response of GET /v1/groups.
+type GroupList struct {
+	Items []Group `json:"items"`
+}
+
+// NodeStats is the resource usage of the node of a worker, as of its last sample.
+type NodeStats struct {
+	Timestamp time.Time `json:"timestamp"`
+
+	// CpuUtilization is the CPU usage (0.0 to 1.0) over the last sampling interval
+	CpuUtilization float64 `json:"cpuUtilization"`
+
+	// CpuCores, MemTotalKb and MemAvailableKb are what the worker can use, within its cgroup limits
+	CpuCores       float64 `json:"cpuCores"`
+	MemTotalKb     uint64  `json:"memTotalKb"`
+	MemAvailableKb uint64  `json:"memAvailableKb"`
+
+	// Disk figures are in bytes, for the root filesystem
+	DiskTotal uint64 `json:"diskTotal"`
+	DiskFree  uint64 `json:"diskFree"`
+
+	LoadAvg1  float64 `json:"loadAvg1"`
+	LoadAvg5  float64 `json:"loadAvg5"`
+	LoadAvg15 float64 `json:"loadAvg15"`
+
+	TaskCount int `json:"taskCount"`
+}
+
+// Error is the body of every error response. Code identifies the kind of error, clients should
+// match on it rather than on the message, see package errdefs for the codes.
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Fields are the fields of the request which failed validation, see FromFields
+	Fields []errdefs.FieldViolation `json:"fields,omitempty"`
+}
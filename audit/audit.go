@@ -0,0 +1,128 @@
+// Package audit keeps a trail of the calls which change the state of the manager or the worker.
+// Records are appended to a file of their own, one JSON object per line, and never rewritten.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/praaatik/tesseract/logger"
+)
+
+// Record is an audited API call.
+type Record struct {
+	Timestamp time.Time
+
+	// RequestID is the X-Request-ID of the request, generated when the caller sent none
+	RequestID string
+
+	// Component is the API which handled the call, manager or worker
+	Component string
+
+	// Caller is the identity of the caller, from basic auth or the X-Remote-User header of a trusted
+	// proxy, if any
+	Caller string
+
+	// RemoteAddr is the address of the caller, and ForwardedFor the X-Forwarded-For header if any
+	RemoteAddr   string
+	ForwardedFor string `json:",omitempty"`
+
+	Method string
+	Route  string
+	Path   string
+
+	// Target holds the wildcards of the route, such as the taskID of DELETE /tasks/{taskID}
+	Target map[string]string `json:",omitempty"`
+
+	// Payload holds the identifying fields of the request body and the query parameters
+	Payload map[string]any `json:",omitempty"`
+
+	StatusCode int
+
+	// Outcome is success or failure, depending on StatusCode
+	Outcome string
+}
+
+// Log is an append-only file of Records.
+type Log struct {
+	path   string
+	logger *logger.Logger
+
+	// TrustedProxies are the addresses of the authenticating proxies whose X-Remote-User header names
+	// the caller, see ParseTrustedProxies. The header is ignored when there are none. They are set
+	// before the Log is used.
+	TrustedProxies []netip.Prefix
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens the audit log at path, creating it if needed. The records which cannot be appended
+// are reported to logger.
+func Open(path string, logger *logger.Logger) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, logger: logger, file: file}, nil
+}
+
+// Append writes a record and syncs it to disk, so that an accepted call is never missing from the trail.
+func (l *Log) Append(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Query returns the records whose timestamp is within [from, to), oldest first.
+// A zero from or to leaves that side of the range open.
+func (l *Log) Query(from time.Time, to time.Time) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []Record{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("audit log %s, line %d: %w", l.path, line, err)
+		}
+		if (!from.IsZero() && r.Timestamp.Before(from)) || (!to.IsZero() && !r.Timestamp.Before(to)) {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// Close closes the file of the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
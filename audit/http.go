@@ -0,0 +1,218 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/middleware"
+)
+
+// RequestIDHeader identifies a request in the audit log. It is echoed back on the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxPayload is how much of a request body is inspected for payload fields.
+const maxPayload = 1 << 20
+
+// Instrument wraps an API router so that every call which may change state, anything but GET, HEAD
+// and OPTIONS, is appended to the audit log once it is handled. It sits right above the router, so
+// that the record has the matched route and its wildcards.
+func Instrument(l *Log, component string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		rec := Record{
+			Timestamp:    time.Now().UTC(),
+			RequestID:    requestID,
+			Component:    component,
+			Caller:       l.caller(r),
+			RemoteAddr:   r.RemoteAddr,
+			ForwardedFor: r.Header.Get("X-Forwarded-For"),
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			Payload:      payload(r),
+		}
+
+		sw := middleware.NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+
+		rec.Route = r.Pattern
+		rec.Target = target(r)
+		rec.StatusCode = sw.Status
+		rec.Outcome = "success"
+		if sw.Status >= http.StatusBadRequest {
+			rec.Outcome = "failure"
+		}
+		if err := l.Append(rec); err != nil {
+			l.logger.Error("Error appending %s %s (request %s) to the audit log: %v", r.Method, r.URL.Path, requestID, err)
+		}
+	})
+}
+
+// Handler serves the records within the optional from and to query parameters, RFC 3339
+// timestamps, oldest first. Errors are written with writeError, in the error format of the API
+// serving the records.
+func Handler(l *Log, writeError func(w http.ResponseWriter, err error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var from, to time.Time
+		for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+			value := r.URL.Query().Get(name)
+			if value == "" {
+				continue
+			}
+			var err error
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid %s %q, expected an RFC 3339 timestamp", name, value))
+				return
+			}
+		}
+
+		records, err := l.Query(from, to)
+		if err != nil {
+			l.logger.Error("Error reading the audit log: %v", err)
+			writeError(w, errdefs.New(errdefs.Internal, "Error reading the audit log"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(records)
+	}
+}
+
+// caller is the user of basic auth, or the X-Remote-User header set by an authenticating proxy when
+// the request comes from one of the TrustedProxies. Anyone else could claim any user with it.
+func (l *Log) caller(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	if len(l.TrustedProxies) == 0 {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	for _, proxy := range l.TrustedProxies {
+		if proxy.Contains(addr) {
+			return r.Header.Get("X-Remote-User")
+		}
+	}
+	return ""
+}
+
+// ParseTrustedProxies parses addresses, such as 10.0.0.1, and CIDR ranges, such as 10.0.0.0/8, into
+// the prefixes of the TrustedProxies of a Log.
+func ParseTrustedProxies(specs []string) ([]netip.Prefix, error) {
+	proxies := []netip.Prefix{}
+	for _, spec := range specs {
+		if strings.Contains(spec, "/") {
+			prefix, err := netip.ParsePrefix(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q, expected an address or a CIDR range", spec)
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an address or a CIDR range", spec)
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+// target returns the wildcards of the matched route, e.g. {"taskID": "..."} for DELETE /tasks/{taskID}.
+func target(r *http.Request) map[string]string {
+	var t map[string]string
+	for rest := r.Pattern; ; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return t
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return t
+		}
+		name := strings.TrimSuffix(rest[start+1:start+end], "...")
+		rest = rest[start+end+1:]
+		if name == "$" {
+			continue
+		}
+		if t == nil {
+			t = map[string]string{}
+		}
+		t[name] = r.PathValue(name)
+	}
+}
+
+// payload returns the query parameters and the scalar fields of the JSON body of r, keyed by their
+// path in the body, e.g. Task.Image. Lists such as commands and environment variables are left out.
+// The body is restored for the handler.
+func payload(r *http.Request) map[string]any {
+	p := map[string]any{}
+	for key, values := range r.URL.Query() {
+		p[key] = strings.Join(values, ",")
+	}
+
+	if r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPayload))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+		var v any
+		if err == nil && json.Unmarshal(body, &v) == nil {
+			collect(p, "", v, 0)
+		}
+	}
+
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// collect walks the objects of a JSON body, two levels deep, for their scalar fields.
+func collect(p map[string]any, prefix string, v any, depth int) {
+	obj, ok := v.(map[string]any)
+	if !ok || depth > 1 {
+		return
+	}
+	for key, value := range obj {
+		switch value.(type) {
+		case map[string]any:
+			collect(p, prefix+key+".", value, depth+1)
+		case []any:
+			// Commands, environment variables and the like stay out of the trail
+		default:
+			p[prefix+key] = value
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCaller(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		remoteUser string
+		basicAuth  string
+		want       string
+	}{
+		{name: "no trusted proxy", remoteAddr: "10.0.0.1:4242", remoteUser: "alice", want: ""},
+		{name: "trusted proxy", proxies: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:4242", remoteUser: "alice", want: "alice"},
+		{name: "trusted range", proxies: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:4242", remoteUser: "alice", want: "alice"},
+		{name: "untrusted address", proxies: []string{"10.0.0.1"}, remoteAddr: "192.168.1.1:4242", remoteUser: "alice", want: ""},
+		{name: "IPv4 mapped address", proxies: []string{"10.0.0.1"}, remoteAddr: "[::ffff:10.0.0.1]:4242", remoteUser: "alice", want: "alice"},
+		{name: "IPv6 proxy", proxies: []string{"fd00::/8"}, remoteAddr: "[fd00::1]:4242", remoteUser: "alice", want: "alice"},
+		{name: "basic auth", remoteAddr: "192.168.1.1:4242", remoteUser: "alice", basicAuth: "bob", want: "bob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := ParseTrustedProxies(tt.proxies)
+			if err != nil {
+				t.Fatalf("ParseTrustedProxies() error = %v", err)
+			}
+			l := &Log{TrustedProxies: proxies}
+
+			r := httptest.NewRequest("POST", "/tasks", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("X-Remote-User", tt.remoteUser)
+			if tt.basicAuth != "" {
+				r.SetBasicAuth(tt.basicAuth, "secret")
+			}
+			if got := l.caller(r); got != tt.want {
+				t.Errorf("caller() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "10.0.0.1", want: "10.0.0.1/32"},
+		{spec: "10.1.2.3/8", want: "10.0.0.0/8"},
+		{spec: "::1", want: "::1/128"},
+		{spec: "::ffff:10.0.0.1", want: "10.0.0.1/32"},
+		{spec: "proxy.local", wantErr: true},
+		{spec: "10.0.0.0/33", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseTrustedProxies([]string{tt.spec})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTrustedProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got[0].String() != tt.want {
+				t.Errorf("ParseTrustedProxies() = %v, want %s", got[0], tt.want)
+			}
+		})
+	}
+}
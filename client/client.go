@@ -0,0 +1,228 @@
+// Package client is a Go client of the worker and manager APIs. Both serve the same task and group
+// routes, so one Client talks to either of them; the calls only one of them serves say so.
+// Error responses are returned as errors carrying the errdefs.Code of the body, so callers can use
+// errdefs.Is(err, errdefs.NotFound) whichever API answered.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/tracing"
+)
+
+// DefaultTimeout bounds the calls of a Client which leaves Timeout at zero.
+const DefaultTimeout = 30 * time.Second
+
+// Client calls the API at BaseURL.
+type Client struct {
+	// BaseURL is the address of the API, e.g. http://localhost:5555
+	BaseURL string
+
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	// Timeout bounds each call, DefaultTimeout when zero and only the context when negative.
+	// The streams of Logs and Events are only bound by their context.
+	Timeout time.Duration
+
+	// Retries is the number of times an idempotent call (GET, PUT or DELETE) is tried again after
+	// it got no response or a 502, 503 or 504 one. The first retry waits RetryDelay, every other
+	// one twice as long as the previous one.
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// New returns a Client of the API at address, a host:port or a URL, retrying idempotent calls twice.
+func New(address string) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(address, "/"),
+		Retries:    2,
+		RetryDelay: 200 * time.Millisecond,
+	}
+}
+
+// unreachableError is a call which got no response from the API.
+type unreachableError struct {
+	url string
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return fmt.Sprintf("%s is unreachable: %v", e.url, e.err)
+}
+
+func (e *unreachableError) Unwrap() error {
+	return e.err
+}
+
+// IsUnreachable reports whether err is a call which got no response, e.g. because the API is down
+// or the call timed out.
+func IsUnreachable(err error) bool {
+	var u *unreachableError
+	return errors.As(err, &u)
+}
+
+// do sends a request with the JSON encoding of in as body, unless in is nil, and decodes the JSON
+// response into out, unless out is nil. A response with another status than want is returned as an error.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, in any, out any, want int) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.send(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		return decodeError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding the response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// stream sends a GET request and returns the body of the response, which the caller must close.
+// The call is only bound by ctx, since the body is read after stream returns.
+func (c *Client) stream(ctx context.Context, path string, query url.Values) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	return resp.Body, nil
+}
+
+// send sends a request, retrying the idempotent ones, and returns the response whatever its status.
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, in any) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, fmt.Errorf("encoding the body of %s %s: %w", method, path, err)
+		}
+	}
+
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	attempts := 1
+	if idempotent(method) {
+		attempts += max(c.Retries, 0)
+	}
+	delay := c.RetryDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := c.sendOnce(ctx, method, u, body)
+		failed := err != nil || retryable(resp.StatusCode)
+		if !failed || attempt == attempts || ctx.Err() != nil {
+			if err != nil {
+				return nil, &unreachableError{url: c.BaseURL, err: err}
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, &unreachableError{url: c.BaseURL, err: ctx.Err()}
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, method string, u string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	tracing.Inject(ctx, req.Header)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if timeout < 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// decodeError turns an error response into an error with the errdefs.Code of its body, or one guessed
+// from the status when the body has none. Both the unversioned and the v1 error bodies are understood,
+// their field names only differ in case.
+func decodeError(resp *http.Response) error {
+	body := struct {
+		Code    errdefs.Code
+		Message string
+		Fields  []errdefs.FieldViolation
+	}{}
+	host := resp.Request.URL.Host
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Message == "" {
+		return errdefs.New(errdefs.CodeForStatus(resp.StatusCode), "%s responded with %d", host, resp.StatusCode)
+	}
+	if body.Code == "" {
+		body.Code = errdefs.CodeForStatus(resp.StatusCode)
+	}
+	return &errdefs.Error{
+		Code:    body.Code,
+		Message: fmt.Sprintf("%s responded with %d: %s", host, resp.StatusCode, body.Message),
+		Fields:  body.Fields,
+	}
+}
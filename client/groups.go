@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/task"
+)
+
+// CreateGroup submits a group of tasks which run on the same node, sharing the network of the first one.
+// It returns the group as it was accepted.
+func (c *Client) CreateGroup(ctx context.Context, g task.Group) (*task.Group, error) {
+	accepted := &task.Group{}
+	if err := c.do(ctx, http.MethodPost, "/groups", nil, g, accepted, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return accepted, nil
+}
+
+// ListGroups returns every group with the current state of each of its tasks.
+func (c *Client) ListGroups(ctx context.Context) ([]task.Group, error) {
+	groups := []task.Group{}
+	if err := c.do(ctx, http.MethodGet, "/groups", nil, nil, &groups, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GetGroup returns the group with the current state of each of its tasks.
+func (c *Client) GetGroup(ctx context.Context, id uuid.UUID) (*task.Group, error) {
+	g := &task.Group{}
+	if err := c.do(ctx, http.MethodGet, "/groups/"+id.String(), nil, nil, g, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// StopGroup asks for every task of the group to be stopped, it returns once the request is accepted.
+func (c *Client) StopGroup(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/groups/"+id.String(), nil, nil, nil, http.StatusNoContent)
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	v1 "github.com/praaatik/tesseract/api/v1"
+)
+
+// ApplyManifest makes the running tasks match the manifest and returns what was done to each of its
+// tasks. With dryRun, nothing is done and the changes are the ones which would be made.
+func (c *Client) ApplyManifest(ctx context.Context, m v1.Manifest, dryRun bool) ([]v1.ManifestChange, error) {
+	return c.manifest(ctx, "/manifests/apply", m, dryRun)
+}
+
+// DiffManifest returns what applying the manifest would do, with the fields of the running tasks which differ.
+func (c *Client) DiffManifest(ctx context.Context, m v1.Manifest) ([]v1.ManifestChange, error) {
+	return c.manifest(ctx, "/manifests/diff", m, false)
+}
+
+// DeleteManifest stops the running tasks named in the manifest. With dryRun, nothing is stopped and
+// the changes are the tasks which would be.
+func (c *Client) DeleteManifest(ctx context.Context, m v1.Manifest, dryRun bool) ([]v1.ManifestChange, error) {
+	return c.manifest(ctx, "/manifests/delete", m, dryRun)
+}
+
+func (c *Client) manifest(ctx context.Context, path string, m v1.Manifest, dryRun bool) ([]v1.ManifestChange, error) {
+	var query url.Values
+	if dryRun {
+		query = url.Values{"dryRun": {"true"}}
+	}
+	changes := []v1.ManifestChange{}
+	if err := c.do(ctx, http.MethodPost, path, query, m, &changes, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
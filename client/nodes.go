@@ -0,0 +1,18 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/praaatik/tesseract/node"
+)
+
+// Nodes returns the workers known to the manager with their capacity and schedulable status.
+// Only the manager serves it.
+func (c *Client) Nodes(ctx context.Context) ([]*node.Node, error) {
+	nodes := []*node.Node{}
+	if err := c.do(ctx, http.MethodGet, "/nodes", nil, nil, &nodes, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
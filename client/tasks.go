@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "github.com/praaatik/tesseract/api/v1"
+	"github.com/praaatik/tesseract/task"
+)
+
+// nextCursorHeader carries the cursor of the next page of the task listing.
+const nextCursorHeader = "X-Next-Cursor"
+
+// CreateTask submits t, with a new ID when it has none. The manager queues it for scheduling while a
+// worker starts it right away. It returns the task as it was accepted.
+func (c *Client) CreateTask(ctx context.Context, t task.Task) (*task.Task, error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	// A worker only starts Scheduled tasks, the manager makes every task Pending anyway.
+	if t.State == task.Pending {
+		t.State = task.Scheduled
+	}
+	return c.SendEvent(ctx, task.Event{ID: uuid.New(), State: task.Scheduled, Timestamp: time.Now().UTC(), Task: t})
+}
+
+// SendEvent submits the task of the event as it is, see CreateTask.
+func (c *Client) SendEvent(ctx context.Context, te task.Event) (*task.Task, error) {
+	accepted := &task.Task{}
+	if err := c.do(ctx, http.MethodPost, "/tasks", nil, te, accepted, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return accepted, nil
+}
+
+// ListTasks returns the tasks selected by q and the cursor of the next page, empty on the last page.
+func (c *Client) ListTasks(ctx context.Context, q task.Query) ([]*task.Task, string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.send(ctx, http.MethodGet, "/tasks", q.Values(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", decodeError(resp)
+	}
+	tasks := []*task.Task{}
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		return nil, "", fmt.Errorf("decoding the response of GET /tasks: %w", err)
+	}
+	return tasks, resp.Header.Get(nextCursorHeader), nil
+}
+
+// GetTask returns the task with the status of its container and the history of its states.
+func (c *Client) GetTask(ctx context.Context, id uuid.UUID) (*task.Detail, error) {
+	detail := &task.Detail{}
+	if err := c.do(ctx, http.MethodGet, "/tasks/"+id.String(), nil, nil, detail, http.StatusOK); err != nil {
+		return nil, err
+	}
+	if detail.Task == nil {
+		return nil, fmt.Errorf("decoding the response of GET /tasks/%v: no task", id)
+	}
+	return detail, nil
+}
+
+// UpdateTask patches a running task and returns it as it will be once updated.
+func (c *Client) UpdateTask(ctx context.Context, id uuid.UUID, p task.Patch) (*task.Task, error) {
+	updated := &task.Task{}
+	if err := c.do(ctx, http.MethodPatch, "/tasks/"+id.String(), nil, p, updated, http.StatusAccepted); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// StopTask asks for the task to be stopped, it returns once the request is accepted.
+func (c *Client) StopTask(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/tasks/"+id.String(), nil, nil, nil, http.StatusNoContent)
+}
+
+// TaskStats returns the resource usage of the container of a task. Only workers serve it.
+func (c *Client) TaskStats(ctx context.Context, id uuid.UUID) (*v1.TaskStats, error) {
+	stats := &v1.TaskStats{}
+	if err := c.do(ctx, http.MethodGet, "/v1/tasks/"+id.String()+"/stats", nil, nil, stats, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Stats returns the resource usage of the node, as of the last sample. Only workers serve it.
+func (c *Client) Stats(ctx context.Context) (*v1.NodeStats, error) {
+	stats := &v1.NodeStats{}
+	if err := c.do(ctx, http.MethodGet, "/v1/stats", nil, nil, stats, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Logs streams the output of the container of a task, stdout and stderr interleaved as plain text.
+// The caller must close the stream, which ends with io.EOF once the output selected by o is sent.
+func (c *Client) Logs(ctx context.Context, id uuid.UUID, o task.LogOptions) (io.ReadCloser, error) {
+	return c.stream(ctx, "/tasks/"+id.String()+"/logs", o.Values())
+}
+
+// EventStream is a stream of changes of state of tasks, see Client.Events.
+type EventStream struct {
+	body    io.ReadCloser
+	decoder *json.Decoder
+}
+
+// Next waits for the next change. It returns io.EOF when the API ends the stream, and the error of
+// the context once it is done.
+func (s *EventStream) Next() (task.StateEvent, error) {
+	e := task.StateEvent{}
+	if err := s.decoder.Decode(&e); err != nil {
+		return task.StateEvent{}, err
+	}
+	return e, nil
+}
+
+// Close ends the stream.
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
+
+// Events streams the changes of state of the tasks recorded after since, the ones already recorded
+// first. A zero since only streams the changes to come.
+func (c *Client) Events(ctx context.Context, since time.Time) (*EventStream, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339Nano))
+	}
+	body, err := c.stream(ctx, "/events", query)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{body: body, decoder: json.NewDecoder(body)}, nil
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	v1 "github.com/praaatik/tesseract/api/v1"
+	"github.com/praaatik/tesseract/client"
+	"github.com/praaatik/tesseract/node"
+	"github.com/praaatik/tesseract/task"
+)
+
+// clientFlags are the flags of every command talking to the manager.
+type clientFlags struct {
+	manager string
+	output  string
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.manager, "manager", "", "Address of the manager, overriding TESSERACT_MANAGER and the context file (see tesseract context)")
+	fs.StringVar(&f.output, "o", "table", "Output format: table, json or yaml")
+}
+
+func (f *clientFlags) format() (format, error) {
+	output, err := parseFormat(f.output)
+	if err != nil {
+		return "", usageError{err}
+	}
+	return output, nil
+}
+
+func (f *clientFlags) client() (*client.Client, error) {
+	address, _, err := managerAddress(f.manager)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(address), nil
+}
+
+// signalContext is the context of a command, done once the user interrupts it.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// parseIDs reads the task IDs given as arguments, at least one of them.
+func parseIDs(args []string) ([]uuid.UUID, error) {
+	if len(args) == 0 {
+		return nil, usageError{errors.New("expected at least one task ID")}
+	}
+	ids := []uuid.UUID{}
+	for _, arg := range args {
+		id, err := uuid.Parse(arg)
+		if err != nil {
+			return nil, usageError{fmt.Errorf("invalid task ID %q", arg)}
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// taskTable writes tasks as a table with a row per task.
+func taskTable(tasks ...*task.Task) func(w io.Writer) {
+	return func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tIMAGE\tSTATE\tSTARTED\tLABELS")
+		for _, t := range tasks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, orDash(t.Name), t.Image, t.State, ago(t.StartTime), labels(t.Labels))
+		}
+	}
+}
+
+func runRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "run [flags] IMAGE [CMD...]", "Submit a task running IMAGE to the manager, which schedules it on a worker.")
+	flags := &clientFlags{}
+	flags.register(fs)
+	name := fs.String("name", "", "Name of the task")
+	cpu := fs.Float64("cpu", 0, "Number of CPU cores the task needs, e.g. 0.5")
+	memory := fs.String("memory", "", "Memory the task needs, in bytes with an optional KB, MB or GB suffix")
+	disk := fs.String("disk", "", "Disk the task needs, in bytes with an optional KB, MB or GB suffix")
+	restart := fs.String("restart", "", "Restart policy of the container: always, unless-stopped or on-failure")
+	stopGracePeriod := fs.Duration("stop-grace-period", 0, "Time between SIGTERM and SIGKILL when stopping the task, the default of the worker when zero")
+	env := []string{}
+	fs.Func("env", "Environment variable of the container, as KEY=value (repeatable)", func(s string) error {
+		if !strings.Contains(s, "=") {
+			return fmt.Errorf("expected KEY=value")
+		}
+		env = append(env, s)
+		return nil
+	})
+	taskLabels := map[string]string{}
+	fs.Func("label", "Label of the task, as key=value (repeatable)", func(s string) error {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("expected key=value")
+		}
+		taskLabels[key] = value
+		return nil
+	})
+	exposed := nat.PortSet{}
+	fs.Func("expose", "Port of the container to publish on the worker, e.g. 80/tcp (repeatable)", func(s string) error {
+		proto, port := nat.SplitProtoPort(s)
+		p, err := nat.NewPort(proto, port)
+		if err != nil {
+			return err
+		}
+		exposed[p] = struct{}{}
+		return nil
+	})
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usageError{errors.New("expected an image")}
+	}
+	output, err := flags.format()
+	if err != nil {
+		return err
+	}
+
+	t := task.Task{
+		Name:            *name,
+		Image:           fs.Arg(0),
+		Cmd:             fs.Args()[1:],
+		Env:             env,
+		Cpu:             *cpu,
+		RestartPolicy:   *restart,
+		StopGracePeriod: *stopGracePeriod,
+	}
+	if len(taskLabels) > 0 {
+		t.Labels = taskLabels
+	}
+	if len(exposed) > 0 {
+		t.ExposedPorts = exposed
+	}
+	for flagName, size := range map[string]struct {
+		value string
+		field *int
+	}{"memory": {*memory, &t.Memory}, "disk": {*disk, &t.Disk}} {
+		if size.value == "" {
+			continue
+		}
+		n, err := parseSize(size.value)
+		if err != nil {
+			return usageError{fmt.Errorf("invalid -%s: %w", flagName, err)}
+		}
+		*size.field = n
+	}
+
+	c, err := flags.client()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	accepted, err := c.CreateTask(ctx, t)
+	if err != nil {
+		return err
+	}
+	return output.print(os.Stdout, accepted, taskTable(accepted))
+}
+
+func runPs(args []string) error {
+	fs := flag.NewFlagSet("ps", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "ps [flags]", "List the tasks known to the manager, all of them unless filtered.")
+	flags := &clientFlags{}
+	flags.register(fs)
+	values := url.Values{}
+	fs.Func("state", "Keep the tasks in this state, e.g. running or pending,scheduled (repeatable)", func(s string) error {
+		values.Add("state", s)
+		return nil
+	})
+	fs.Func("label", "Keep the tasks with this label, as key=value or key (repeatable)", func(s string) error {
+		values.Add("label", s)
+		return nil
+	})
+	for _, name := range []string{"namePrefix", "image", "sort", "limit", "startedAfter", "startedBefore", "finishedAfter", "finishedBefore"} {
+		fs.Func(name, psFlagUsage[name], func(s string) error {
+			values.Set(name, s)
+			return nil
+		})
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError{errors.New("ps takes no arguments")}
+	}
+	q, err := task.ParseQuery(values)
+	if err != nil {
+		return usageError{err}
+	}
+	output, err := flags.format()
+	if err != nil {
+		return err
+	}
+
+	c, err := flags.client()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Without a limit every page is listed, with one only the first page.
+	tasks := []*task.Task{}
+	for {
+		page, next, err := c.ListTasks(ctx, q)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, page...)
+		if next == "" || values.Get("limit") != "" {
+			break
+		}
+		q.Cursor = next
+	}
+	return output.print(os.Stdout, tasks, taskTable(tasks...))
+}
+
+// psFlagUsage are the usages of the flags of ps passed as they are to GET /tasks.
+var psFlagUsage = map[string]string{
+	"namePrefix":     "Keep the tasks whose name starts with this prefix",
+	"image":          "Keep the tasks running exactly this image",
+	"sort":           "Order of the tasks: startTime or finishTime, prefixed with - for a descending order",
+	"limit":          "List at most this number of tasks, all of them when not set",
+	"startedAfter":   "Keep the tasks started at or after this RFC 3339 time",
+	"startedBefore":  "Keep the tasks started at or before this RFC 3339 time",
+	"finishedAfter":  "Keep the tasks finished at or after this RFC 3339 time",
+	"finishedBefore": "Keep the tasks finished at or before this RFC 3339 time",
+}
+
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "inspect [flags] ID...", "Show the tasks with the status of their container and the history of their states.")
+	flags := &clientFlags{}
+	flags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	ids, err := parseIDs(fs.Args())
+	if err != nil {
+		return err
+	}
+	output, err := flags.format()
+	if err != nil {
+		return err
+	}
+
+	c, err := flags.client()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	details := []*task.Detail{}
+	for _, id := range ids {
+		detail, err := c.GetTask(ctx, id)
+		if err != nil {
+			return err
+		}
+		details = append(details, detail)
+	}
+
+	return output.print(os.Stdout, details, func(w io.Writer) {
+		for i, d := range details {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			printDetail(w, d)
+		}
+	})
+}
+
+// printDetail writes a task as a field per line, followed by the history of its states.
+func printDetail(w io.Writer, d *task.Detail) {
+	t := d.Task
+	fmt.Fprintf(w, "ID:\t%s\n", t.ID)
+	fmt.Fprintf(w, "Name:\t%s\n", orDash(t.Name))
+	fmt.Fprintf(w, "State:\t%s\n", t.State)
+	fmt.Fprintf(w, "Node:\t%s\n", orDash(d.Node))
+	fmt.Fprintf(w, "Image:\t%s\n", t.Image)
+	fmt.Fprintf(w, "Cmd:\t%s\n", orDash(strings.Join(t.Cmd, " ")))
+	fmt.Fprintf(w, "Env:\t%s\n", orDash(strings.Join(t.Env, " ")))
+	fmt.Fprintf(w, "Cpu:\t%g\n", t.Cpu)
+	fmt.Fprintf(w, "Memory:\t%s\n", bytesSize(uint64(max(t.Memory, 0))))
+	fmt.Fprintf(w, "Restart policy:\t%s\n", orDash(t.RestartPolicy))
+	fmt.Fprintf(w, "Labels:\t%s\n", labels(t.Labels))
+	fmt.Fprintf(w, "Revision:\t%d\n", t.Revision)
+	fmt.Fprintf(w, "Started:\t%s\n", ago(t.StartTime))
+	fmt.Fprintf(w, "Finished:\t%s\n", ago(t.FinishTime))
+
+	switch {
+	case d.Container != nil:
+		fmt.Fprintf(w, "Container:\t%s\n", d.Container.ID)
+		fmt.Fprintf(w, "Container status:\t%s (exit code %d, %d restarts)\n", d.Container.Status, d.Container.ExitCode, d.Container.RestartCount)
+		if d.Container.Health != "" {
+			fmt.Fprintf(w, "Health:\t%s\n", d.Container.Health)
+		}
+	case d.ContainerError != "":
+		fmt.Fprintf(w, "Container:\t%s (%s)\n", orDash(t.ContainerID), d.ContainerError)
+	default:
+		fmt.Fprintf(w, "Container:\t-\n")
+	}
+
+	fmt.Fprintln(w, "History:")
+	for _, c := range t.History {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", c.Time.Local().Format(time.DateTime), c.State, c.Reason)
+	}
+}
+
+func runStop(args []string) error {
+	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "stop [flags] ID...", "Ask for the tasks to be stopped. It returns once the manager accepted the requests.")
+	flags := &clientFlags{}
+	flags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	ids, err := parseIDs(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	c, err := flags.client()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	for _, id := range ids {
+		if err := c.StopTask(ctx, id); err != nil {
+			return err
+		}
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func runLogs(args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "logs [flags] ID", "Print the output of the container of a task, stdout and stderr interleaved.")
+	flags := &clientFlags{}
+	flags.register(fs)
+	values := url.Values{}
+	follow := fs.Bool("f", false, "Keep printing the output until the container exits")
+	timestamps := fs.Bool("timestamps", false, "Prefix each line with the time it was written at")
+	fs.Func("tail", "Start from this number of lines, counted from the end", func(s string) error {
+		values.Set("tail", s)
+		return nil
+	})
+	fs.Func("since", "Drop the lines written before this RFC 3339 time or duration, e.g. 10m", func(s string) error {
+		values.Set("since", s)
+		return nil
+	})
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	ids, err := parseIDs(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(ids) > 1 {
+		return usageError{errors.New("logs takes a single task ID")}
+	}
+	values.Set("follow", strconv.FormatBool(*follow))
+	values.Set("timestamps", strconv.FormatBool(*timestamps))
+	o, err := task.ParseLogOptions(values)
+	if err != nil {
+		return usageError{err}
+	}
+
+	c, err := flags.client()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	logs, err := c.Logs(ctx, ids[0], o)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	if _, err := io.Copy(os.Stdout, logs); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// nodeStats is the resource usage of a node, or why it could not be read.
+type nodeStats struct {
+	Node  string
+	Stats *v1.NodeStats `json:",omitempty"`
+	Error string        `json:",omitempty"`
+}
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "stats [flags] [ID]", "Show the resource usage of the container of a task, or of every node without an ID.\nThe figures are read from the workers, found through the manager unless -worker is set.")
+	flags := &clientFlags{}
+	flags.register(fs)
+	workerAddress := fs.String("worker", "", "Address of the worker to read the figures from")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	output, err := flags.format()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	if fs.NArg() > 0 {
+		ids, err := parseIDs(fs.Args())
+		if err != nil {
+			return err
+		}
+		if len(ids) > 1 {
+			return usageError{errors.New("stats takes a single task ID")}
+		}
+		return taskStats(ctx, flags, *workerAddress, ids[0], output)
+	}
+
+	nodes := []*node.Node{{Name: *workerAddress, Api: *workerAddress}}
+	if *workerAddress == "" {
+		c, err := flags.client()
+		if err != nil {
+			return err
+		}
+		if nodes, err = c.Nodes(ctx); err != nil {
+			return err
+		}
+	}
+
+	all := []nodeStats{}
+	for _, n := range nodes {
+		s, err := client.New(n.Api).Stats(ctx)
+		if err != nil {
+			all = append(all, nodeStats{Node: n.Name, Error: err.Error()})
+			continue
+		}
+		all = append(all, nodeStats{Node: n.Name, Stats: s})
+	}
+
+	return output.print(os.Stdout, all, func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tCPU\tCORES\tMEMORY\tDISK\tLOAD\tTASKS")
+		for _, ns := range all {
+			s := ns.Stats
+			if s == nil {
+				fmt.Fprintf(w, "%s\t%s\n", ns.Node, ns.Error)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%.1f%%\t%g\t%s / %s\t%s / %s\t%.2f %.2f %.2f\t%d\n",
+				ns.Node, s.CpuUtilization*100, s.CpuCores,
+				bytesSize((s.MemTotalKb-s.MemAvailableKb)*1024), bytesSize(s.MemTotalKb*1024),
+				bytesSize(s.DiskTotal-s.DiskFree), bytesSize(s.DiskTotal),
+				s.LoadAvg1, s.LoadAvg5, s.LoadAvg15, s.TaskCount)
+		}
+	})
+}
+
+// taskStats prints the resource usage of the container of a task, read from workerAddress or else
+// from the node the manager sent the task to.
+func taskStats(ctx context.Context, flags *clientFlags, workerAddress string, id uuid.UUID, output format) error {
+	if workerAddress == "" {
+		c, err := flags.client()
+		if err != nil {
+			return err
+		}
+		detail, err := c.GetTask(ctx, id)
+		if err != nil {
+			return err
+		}
+		if detail.Node == "" {
+			return fmt.Errorf("task %v has not been sent to a worker yet", id)
+		}
+		nodes, err := c.Nodes(ctx)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			if n.Name == detail.Node {
+				workerAddress = n.Api
+			}
+		}
+		if workerAddress == "" {
+			return fmt.Errorf("task %v runs on %s, which the manager does not know", id, detail.Node)
+		}
+	}
+
+	s, err := client.New(workerAddress).TaskStats(ctx, id)
+	if err != nil {
+		return err
+	}
+	return output.print(os.Stdout, s, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tCPU\tMEMORY\tNET RX / TX\tBLOCK READ / WRITE\tPIDS")
+		fmt.Fprintf(w, "%s\t%.2f / %g\t%s / %s\t%s / %s\t%s / %s\t%d\n",
+			s.TaskID, s.CpuCores, s.CpuRequested,
+			bytesSize(s.MemoryUsage), bytesSize(s.MemoryLimit),
+			bytesSize(s.NetworkRxBytes), bytesSize(s.NetworkTxBytes),
+			bytesSize(s.BlockReadBytes), bytesSize(s.BlockWriteBytes), s.Pids)
+	})
+}
+
+func runNodes(args []string) error {
+	fs := flag.NewFlagSet("nodes", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "nodes [flags]", "List the workers known to the manager with their capacity and status.")
+	flags := &clientFlags{}
+	flags.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	output, err := flags.format()
+	if err != nil {
+		return err
+	}
+
+	c, err := flags.client()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	nodes, err := c.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+	return output.print(os.Stdout, nodes, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tAPI\tSTATUS\tCORES\tMEMORY\tDISK\tTASKS")
+		for _, n := range nodes {
+			status := "Ready"
+			switch {
+			case n.Draining:
+				status = "Draining"
+			case n.Unschedulable:
+				status = "Cordoned"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s / %s\t%s / %s\t%d\n", n.Name, n.Api, status, n.Cores,
+				bytesSize(uint64(max(n.MemoryAllocated, 0))), bytesSize(uint64(max(n.Memory, 0))),
+				bytesSize(uint64(max(n.DiskAllocated, 0))), bytesSize(uint64(max(n.Disk, 0))), n.TaskCount)
+		}
+	})
+}
+
+// parseSize parses a number of bytes with an optional KB, MB or GB suffix (powers of 1024).
+func parseSize(s string) (int, error) {
+	multiplier := 1
+	upper := strings.ToUpper(s)
+	for suffix, m := range map[string]int{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(upper, suffix) {
+			multiplier = m
+			upper = strings.TrimSuffix(upper, suffix)
+			break
+		}
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(upper))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
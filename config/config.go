@@ -0,0 +1,590 @@
+// Package config holds the settings of the worker and manager daemons. Every setting can be set by a
+// flag, an environment variable or a key of a TOML configuration file, in this order of precedence,
+// and otherwise keeps its default.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/praaatik/tesseract/audit"
+	"github.com/praaatik/tesseract/logger"
+)
+
+// The roles a Config is validated for: a worker, maybe running a manager next to it, or a manager alone.
+const (
+	RoleWorker  = "worker"
+	RoleManager = "manager"
+)
+
+// Config is the configuration of a daemon.
+type Config struct {
+	Log     Log
+	Audit   Audit
+	Tracing Tracing
+	Worker  Worker
+	Manager Manager
+}
+
+type Log struct {
+	// Level is the level of every component, DEBUG, INFO, WARN or ERROR
+	Level string
+
+	// Levels overrides the level of some components, e.g. scheduler=DEBUG,stats=WARN
+	Levels string
+
+	// Format is text or json
+	Format string
+
+	// Outputs are the sinks the records are written to, e.g. stdout,level=info
+	Outputs []string
+}
+
+type Audit struct {
+	// Log is the file recording the API calls which change state, auditing is off when empty
+	Log string
+
+	// TrustedProxies are the addresses or CIDR ranges of the authenticating proxies whose
+	// X-Remote-User header names the caller in the audit log
+	TrustedProxies []string
+}
+
+type Tracing struct {
+	// OTLPEndpoint is the base URL of the collector spans are exported to, tracing is off when empty
+	OTLPEndpoint string
+	Service      string
+}
+
+type Worker struct {
+	// Host and Port are where the API listens, Host also names the worker
+	Host string
+	Port int
+
+	// TaskInterval is the time between two runs of the task queue, UpdateInterval between two
+	// checks of the running tasks
+	TaskInterval   time.Duration
+	UpdateInterval time.Duration
+
+	StatsInterval time.Duration
+	StatsWindow   time.Duration
+
+	// Mounts are the mount points whose disk usage is reported, next to the Docker data root
+	Mounts     []string
+	ProcPath   string
+	CgroupPath string
+
+	// StopGracePeriod is the default time between SIGTERM and SIGKILL when stopping a task
+	StopGracePeriod time.Duration
+
+	// WaitForTasks lets the running tasks exit on shutdown, for at most ShutdownTimeout, rather than stopping them
+	WaitForTasks    bool
+	ShutdownTimeout time.Duration
+}
+
+type Manager struct {
+	// Host is where the API listens, the host of the worker when empty. Port is required to run a
+	// manager alone, a worker only runs one next to it when it is set.
+	Host string
+	Port int
+
+	// Workers are the addresses of the workers, only the worker running the manager when empty
+	Workers []string
+
+	ProcessInterval   time.Duration
+	UpdateInterval    time.Duration
+	ReconcileInterval time.Duration
+}
+
+// Default returns the configuration used for the settings nothing sets.
+func Default() *Config {
+	return &Config{
+		Log: Log{
+			Level:   "INFO",
+			Format:  "text",
+			Outputs: []string{"stdout"},
+		},
+		Tracing: Tracing{Service: "tesseract"},
+		Worker: Worker{
+			TaskInterval:    10 * time.Second,
+			UpdateInterval:  15 * time.Second,
+			StatsInterval:   15 * time.Second,
+			StatsWindow:     time.Hour,
+			Mounts:          []string{"/"},
+			ProcPath:        "/proc",
+			CgroupPath:      "/sys/fs/cgroup",
+			StopGracePeriod: 10 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Manager: Manager{
+			ProcessInterval:   10 * time.Second,
+			UpdateInterval:    15 * time.Second,
+			ReconcileInterval: 10 * time.Second,
+		},
+	}
+}
+
+// setting is a field of Config with the names it is set by.
+type setting struct {
+	// key is the section.key of the configuration file
+	key  string
+	env  string
+	flag string
+
+	// role limits the flag to the command running this role, every command has it when empty
+	role  string
+	usage string
+	field func(c *Config) any
+
+	// separator splits the value of a list in the environment, a list flag is repeated instead
+	separator string
+}
+
+var settings = []setting{
+	{key: "log.level", env: "CUBE_LOG_LEVEL", flag: "loglevel", usage: "Set logging level (DEBUG, INFO, WARN, ERROR)", field: func(c *Config) any { return &c.Log.Level }},
+	{key: "log.levels", env: "CUBE_LOG_LEVELS", flag: "loglevels", usage: "Set the logging level of some components, e.g. scheduler=DEBUG,stats=WARN (components: main, api, worker, docker, stats, manager, scheduler, audit, tracing)", field: func(c *Config) any { return &c.Log.Levels }},
+	{key: "log.format", env: "CUBE_LOG_FORMAT", flag: "logformat", usage: "Set logging format (text, json)", field: func(c *Config) any { return &c.Log.Format }},
+	{key: "log.outputs", env: "CUBE_LOG_OUTPUTS", flag: "log-output", separator: ";", usage: "Add a log sink, e.g. stdout,level=info or file:/var/log/tesseract.log,level=debug,max-size=10MB,max-backups=5 or syslog,level=warn (repeatable, defaults to stdout)", field: func(c *Config) any { return &c.Log.Outputs }},
+	{key: "audit.log", env: "CUBE_AUDIT_LOG", flag: "audit-log", usage: "Append-only file recording the API calls which change state, apart from the logs (auditing is off when empty)", field: func(c *Config) any { return &c.Audit.Log }},
+	{key: "audit.trusted-proxies", env: "CUBE_AUDIT_TRUSTED_PROXIES", flag: "audit-trusted-proxies", separator: ",", usage: "Comma-separated addresses or CIDR ranges of the authenticating proxies whose X-Remote-User header names the caller in the audit log", field: func(c *Config) any { return &c.Audit.TrustedProxies }},
+	{key: "tracing.otlp-endpoint", env: "CUBE_OTLP_ENDPOINT", flag: "otlp-endpoint", usage: "Base URL of the OpenTelemetry collector spans are exported to over OTLP/HTTP, e.g. http://localhost:4318 (tracing is off when empty)", field: func(c *Config) any { return &c.Tracing.OTLPEndpoint }},
+	{key: "tracing.service", env: "CUBE_TRACE_SERVICE", flag: "trace-service", usage: "Service name of the exported spans", field: func(c *Config) any { return &c.Tracing.Service }},
+
+	{key: "worker.host", env: "CUBE_HOST", flag: "host", usage: "Host the worker API listens on, which also names the worker", field: func(c *Config) any { return &c.Worker.Host }},
+	{key: "worker.port", env: "CUBE_PORT", flag: "port", role: RoleWorker, usage: "Port the worker API listens on", field: func(c *Config) any { return &c.Worker.Port }},
+	{key: "worker.task-interval", env: "CUBE_TASK_INTERVAL", flag: "task-interval", role: RoleWorker, usage: "Time between two runs of the task queue", field: func(c *Config) any { return &c.Worker.TaskInterval }},
+	{key: "worker.update-interval", env: "CUBE_UPDATE_INTERVAL", flag: "update-interval", role: RoleWorker, usage: "Time between two checks of the running tasks", field: func(c *Config) any { return &c.Worker.UpdateInterval }},
+	{key: "worker.stats-interval", env: "CUBE_STATS_INTERVAL", flag: "stats-interval", role: RoleWorker, usage: "Time between two samples of the worker statistics", field: func(c *Config) any { return &c.Worker.StatsInterval }},
+	{key: "worker.stats-window", env: "CUBE_STATS_WINDOW", flag: "stats-window", role: RoleWorker, usage: "Duration of statistics history kept by the worker", field: func(c *Config) any { return &c.Worker.StatsWindow }},
+	{key: "worker.mounts", env: "CUBE_MOUNTS", flag: "mounts", role: RoleWorker, separator: ",", usage: "Comma-separated mount points whose disk usage the worker reports, next to the Docker data root", field: func(c *Config) any { return &c.Worker.Mounts }},
+	{key: "worker.proc-path", env: "CUBE_PROC_PATH", flag: "proc-path", role: RoleWorker, usage: "Mount point of procfs the worker reads its statistics from", field: func(c *Config) any { return &c.Worker.ProcPath }},
+	{key: "worker.cgroup-path", env: "CUBE_CGROUP_PATH", flag: "cgroup-path", role: RoleWorker, usage: "Mount point of the cgroup filesystem the worker reads its limits from", field: func(c *Config) any { return &c.Worker.CgroupPath }},
+	{key: "worker.stop-grace-period", env: "CUBE_STOP_GRACE_PERIOD", flag: "stop-grace-period", role: RoleWorker, usage: "Default time between SIGTERM and SIGKILL when stopping a task", field: func(c *Config) any { return &c.Worker.StopGracePeriod }},
+	{key: "worker.wait-for-tasks", env: "CUBE_WAIT_FOR_TASKS", flag: "wait-for-tasks", role: RoleWorker, usage: "On shutdown, wait for running tasks to exit before stopping them", field: func(c *Config) any { return &c.Worker.WaitForTasks }},
+	{key: "worker.shutdown-timeout", env: "CUBE_SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", role: RoleWorker, usage: "Maximum time to wait for running tasks to exit on shutdown", field: func(c *Config) any { return &c.Worker.ShutdownTimeout }},
+
+	{key: "manager.host", env: "CUBE_MANAGER_HOST", flag: "manager-host", usage: "Host the manager API listens on, the host of the worker when empty", field: func(c *Config) any { return &c.Manager.Host }},
+	{key: "manager.port", env: "CUBE_MANAGER_PORT", flag: "manager-port", usage: "Port the manager API listens on, a worker only runs a manager next to it when it is set", field: func(c *Config) any { return &c.Manager.Port }},
+	{key: "manager.workers", env: "CUBE_WORKERS", flag: "workers", separator: ",", usage: "Comma-separated addresses (host:port) of the workers the manager sends tasks to", field: func(c *Config) any { return &c.Manager.Workers }},
+	{key: "manager.process-interval", env: "CUBE_PROCESS_INTERVAL", flag: "process-interval", usage: "Time between two runs of the queue of pending tasks of the manager", field: func(c *Config) any { return &c.Manager.ProcessInterval }},
+	{key: "manager.update-interval", env: "CUBE_MANAGER_UPDATE_INTERVAL", flag: "manager-update-interval", usage: "Time between two refreshes of the task states from the workers", field: func(c *Config) any { return &c.Manager.UpdateInterval }},
+	{key: "manager.reconcile-interval", env: "CUBE_RECONCILE_INTERVAL", flag: "reconcile-interval", usage: "Time between two reconciliations of the services", field: func(c *Config) any { return &c.Manager.ReconcileInterval }},
+}
+
+// set parses value into the field of s.
+func (s setting) set(c *Config, value string) error {
+	switch field := s.field(c).(type) {
+	case *string:
+		*field = value
+	case *int:
+		n, err := parseInt(value)
+		if err != nil {
+			return err
+		}
+		*field = n
+	case *bool:
+		b, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		*field = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected e.g. 10s or 1m30s", value)
+		}
+		*field = d
+	case *[]string:
+		*field = splitList(value, s.separator)
+	}
+	return nil
+}
+
+// setFile sets the field of s from the value of the configuration file, which must have its type.
+func (s setting) setFile(c *Config, value any) error {
+	switch field := s.field(c).(type) {
+	case *string:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %s", formatTOML(value))
+		}
+		*field = v
+	case *int:
+		v, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %s", formatTOML(value))
+		}
+		*field = int(v)
+	case *bool:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected true or false, got %s", formatTOML(value))
+		}
+		*field = v
+	case *time.Duration:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a duration as a string such as \"10s\", got %s", formatTOML(value))
+		}
+		return s.set(c, v)
+	case *[]string:
+		v, ok := value.([]string)
+		if !ok {
+			return fmt.Errorf("expected an array of strings, got %s", formatTOML(value))
+		}
+		*field = v
+	}
+	return nil
+}
+
+// get returns the value of the field of s, as written in the configuration file.
+func (s setting) get(c *Config) any {
+	switch field := s.field(c).(type) {
+	case *string:
+		return *field
+	case *int:
+		return *field
+	case *bool:
+		return *field
+	case *time.Duration:
+		return field.String()
+	case *[]string:
+		return *field
+	}
+	return nil
+}
+
+func parseInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q", value)
+	}
+	return n, nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "1", "yes":
+		return true, nil
+	case "false", "0", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q, expected true or false", value)
+}
+
+func splitList(value string, separator string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, separator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Loader reads a Config from its flags, the environment and the configuration file.
+type Loader struct {
+	role string
+	path string
+
+	// flags are the values of the flags set on the command line, keyed by setting
+	flags map[string][]string
+
+	// sources says what set each setting which is not at its default
+	sources map[string]string
+}
+
+// NewLoader adds to fs a flag for every setting of role, and -config for the configuration file.
+// The file is CUBE_CONFIG when -config is not set, there is none when both are empty.
+func NewLoader(fs *flag.FlagSet, role string) *Loader {
+	l := &Loader{role: role, flags: map[string][]string{}, sources: map[string]string{}}
+	fs.StringVar(&l.path, "config", "", "Path of the TOML configuration file, CUBE_CONFIG when not set")
+	for _, s := range settings {
+		if s.role != "" && s.role != role {
+			continue
+		}
+		_, isBool := s.field(Default()).(*bool)
+		fs.Var(&flagValue{loader: l, setting: s, isBool: isBool}, s.flag, fmt.Sprintf("%s (%s, %s)", s.usage, s.env, s.key))
+	}
+	return l
+}
+
+// flagValue records the values of the flag of a setting, which Load applies last.
+type flagValue struct {
+	loader  *Loader
+	setting setting
+	isBool  bool
+}
+
+// String is the default of the setting, which the usage of the flags shows.
+func (v *flagValue) String() string {
+	if v.setting.field == nil {
+		return ""
+	}
+	switch value := v.setting.get(Default()).(type) {
+	case []string:
+		separator := v.setting.separator
+		if separator == ";" {
+			separator = " "
+		}
+		return strings.Join(value, separator)
+	case bool:
+		if !value {
+			return ""
+		}
+	case int:
+		if value == 0 {
+			return ""
+		}
+	}
+	return fmt.Sprint(v.setting.get(Default()))
+}
+
+func (v *flagValue) Set(value string) error {
+	if err := v.setting.set(Default(), value); err != nil {
+		return err
+	}
+	// Lists are repeated rather than separated, apart from the ones separated by commas.
+	key := v.setting.key
+	if v.setting.separator == "," {
+		v.loader.flags[key] = splitList(value, ",")
+	} else {
+		v.loader.flags[key] = append(v.loader.flags[key], value)
+	}
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// Load returns the Config set by the flags of fs once parsed, the environment read with lookupEnv and
+// the configuration file. A variable set to an empty value sets the setting, e.g. CUBE_AUDIT_LOG=
+// turns off the audit log of the file. It fails when a value cannot be parsed, the file has an
+// unknown key, or the Config is not valid for the role of the Loader.
+func (l *Loader) Load(lookupEnv func(string) (string, bool)) (*Config, error) {
+	c := Default()
+
+	path, pathSource := l.path, "-config"
+	if path == "" {
+		path, _ = lookupEnv("CUBE_CONFIG")
+		pathSource = "CUBE_CONFIG"
+	}
+	if path != "" {
+		if err := l.loadFile(c, path); err != nil {
+			return nil, fmt.Errorf("configuration file %s (from %s): %w", path, pathSource, err)
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := lookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(c, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.env, err)
+		}
+		l.sources[s.key] = s.env
+	}
+
+	for _, s := range settings {
+		values, ok := l.flags[s.key]
+		if !ok {
+			continue
+		}
+		if field, isList := s.field(c).(*[]string); isList {
+			*field = values
+		} else if err := s.set(c, values[len(values)-1]); err != nil {
+			return nil, fmt.Errorf("-%s: %w", s.flag, err)
+		}
+		l.sources[s.key] = "-" + s.flag
+	}
+
+	if err := l.validate(c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func (l *Loader) loadFile(c *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	values, err := parseTOML(f)
+	if err != nil {
+		return err
+	}
+	for key, v := range values {
+		s, ok := lookup(key)
+		if !ok {
+			return fmt.Errorf("line %d: unknown setting %s", v.line, key)
+		}
+		if err := s.setFile(c, v.value); err != nil {
+			return fmt.Errorf("line %d: %s: %w", v.line, key, err)
+		}
+		l.sources[key] = fmt.Sprintf("%s:%d", path, v.line)
+	}
+	return nil
+}
+
+func lookup(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// Source says what set the setting of key: a flag, an environment variable, a line of the
+// configuration file, or default.
+func (l *Loader) Source(key string) string {
+	if source, ok := l.sources[key]; ok {
+		return source
+	}
+	return "default"
+}
+
+// ValidationError lists every invalid setting of a Config.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+func (l *Loader) validate(c *Config) error {
+	errs := ValidationError{}
+	invalid := func(key string, format string, args ...any) {
+		s, _ := lookup(key)
+		errs = append(errs, fmt.Sprintf("%s = %s (%s): %s, set it with -%s, %s or %s in the configuration file",
+			key, formatTOML(s.get(c)), l.Source(key), fmt.Sprintf(format, args...), s.flag, s.env, key))
+	}
+
+	level, err := logger.ParseLevel(c.Log.Level)
+	if err != nil {
+		invalid("log.level", "%v", err)
+	}
+	if err := logger.NewLevels(level).ParseLevels(c.Log.Levels); err != nil {
+		invalid("log.levels", "%v", err)
+	}
+	format, err := logger.ParseFormat(c.Log.Format)
+	if err != nil {
+		invalid("log.format", "%v", err)
+	}
+	if len(c.Log.Outputs) == 0 {
+		invalid("log.outputs", "at least one output is required")
+	}
+	for _, spec := range c.Log.Outputs {
+		if _, err := logger.ParseSinkConfig(spec, logger.DEBUG, format); err != nil {
+			invalid("log.outputs", "invalid output %q: %v", spec, err)
+		}
+	}
+	for _, proxy := range c.Audit.TrustedProxies {
+		if _, err := audit.ParseTrustedProxies([]string{proxy}); err != nil {
+			invalid("audit.trusted-proxies", "%v", err)
+		}
+	}
+	if c.Tracing.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("tracing.otlp-endpoint", "expected a URL such as http://localhost:4318")
+		}
+	}
+
+	if l.role == RoleWorker {
+		validatePort(invalid, "worker.port", c.Worker.Port, true)
+		for key, d := range map[string]time.Duration{
+			"worker.task-interval":   c.Worker.TaskInterval,
+			"worker.update-interval": c.Worker.UpdateInterval,
+			"worker.stats-interval":  c.Worker.StatsInterval,
+		} {
+			if d <= 0 {
+				invalid(key, "expected a positive duration")
+			}
+		}
+		if c.Worker.StatsWindow < c.Worker.StatsInterval {
+			invalid("worker.stats-window", "expected at least worker.stats-interval (%v)", c.Worker.StatsInterval)
+		}
+		if len(c.Worker.Mounts) == 0 {
+			invalid("worker.mounts", "at least one mount point is required")
+		}
+		for key, d := range map[string]time.Duration{
+			"worker.stop-grace-period": c.Worker.StopGracePeriod,
+			"worker.shutdown-timeout":  c.Worker.ShutdownTimeout,
+		} {
+			if d < 0 {
+				invalid(key, "expected a duration which is not negative")
+			}
+		}
+		sameHost := c.Manager.Host == "" || c.Manager.Host == c.Worker.Host
+		if c.Manager.Port != 0 && c.Manager.Port == c.Worker.Port && sameHost {
+			invalid("manager.port", "the worker already listens on it")
+		}
+	}
+
+	// A worker only runs a manager when manager.port is set.
+	if l.role == RoleManager || c.Manager.Port != 0 {
+		validatePort(invalid, "manager.port", c.Manager.Port, l.role == RoleManager)
+		if l.role == RoleManager && len(c.Manager.Workers) == 0 {
+			invalid("manager.workers", "at least one worker is required")
+		}
+		for _, w := range c.Manager.Workers {
+			if _, _, err := net.SplitHostPort(w); err != nil {
+				invalid("manager.workers", "invalid worker %q, expected host:port", w)
+			}
+		}
+		for key, d := range map[string]time.Duration{
+			"manager.process-interval":   c.Manager.ProcessInterval,
+			"manager.update-interval":    c.Manager.UpdateInterval,
+			"manager.reconcile-interval": c.Manager.ReconcileInterval,
+		} {
+			if d <= 0 {
+				invalid(key, "expected a positive duration")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validatePort(invalid func(key string, format string, args ...any), key string, port int, required bool) {
+	switch {
+	case port == 0 && required:
+		invalid(key, "a port is required")
+	case port < 0 || port > 65535:
+		invalid(key, "expected a port between 1 and 65535")
+	}
+}
+
+// Write writes c as a configuration file, each setting of the role of the Loader commented with what set it.
+func (l *Loader) Write(w io.Writer, c *Config) error {
+	section := ""
+	for _, s := range settings {
+		if s.role != "" && s.role != l.role {
+			continue
+		}
+		name, key, _ := strings.Cut(s.key, ".")
+		if name != section {
+			if section != "" {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "[%s]\n", name)
+			section = name
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s  # %s\n", key, formatTOML(s.get(c)), l.Source(s.key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFile = `
+[audit]
+log = "/var/log/tesseract/audit.log"
+
+[worker]
+port = 1000
+task-interval = "1s"
+mounts = ["/", "/file"]
+`
+
+// load runs a Loader of role on args, the environment env and the configuration file holding file,
+// when it is not empty.
+func load(t *testing.T, role string, args []string, env map[string]string, file string) (*Config, *Loader, error) {
+	t.Helper()
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "tesseract.toml")
+		if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+
+	fs := flag.NewFlagSet(role, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	l := NewLoader(fs, role)
+	if err := fs.Parse(args); err != nil {
+		return nil, l, err
+	}
+	c, err := l.Load(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+	return c, l, err
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+
+		wantPort     int
+		wantPortFrom string
+		wantInterval time.Duration
+		wantMounts   []string
+		wantAuditLog string
+	}{
+		{
+			name:         "defaults",
+			args:         []string{"-port", "5555"},
+			wantPort:     5555,
+			wantPortFrom: "-port",
+			wantInterval: 10 * time.Second,
+			wantMounts:   []string{"/"},
+		},
+		{
+			name:         "file over defaults",
+			file:         testFile,
+			wantPort:     1000,
+			wantPortFrom: "tesseract.toml:6",
+			wantInterval: time.Second,
+			wantMounts:   []string{"/", "/file"},
+			wantAuditLog: "/var/log/tesseract/audit.log",
+		},
+		{
+			name:         "environment over file",
+			env:          map[string]string{"CUBE_PORT": "2000", "CUBE_MOUNTS": "/env, /data"},
+			file:         testFile,
+			wantPort:     2000,
+			wantPortFrom: "CUBE_PORT",
+			wantInterval: time.Second,
+			wantMounts:   []string{"/env", "/data"},
+			wantAuditLog: "/var/log/tesseract/audit.log",
+		},
+		{
+			name:         "flags over environment",
+			args:         []string{"-port", "3000", "-mounts", "/flag", "-task-interval", "3s"},
+			env:          map[string]string{"CUBE_PORT": "2000", "CUBE_MOUNTS": "/env", "CUBE_TASK_INTERVAL": "2s"},
+			file:         testFile,
+			wantPort:     3000,
+			wantPortFrom: "-port",
+			wantInterval: 3 * time.Second,
+			wantMounts:   []string{"/flag"},
+			wantAuditLog: "/var/log/tesseract/audit.log",
+		},
+		{
+			name:         "last flag wins",
+			args:         []string{"-port", "3000", "-port", "4000"},
+			wantPort:     4000,
+			wantPortFrom: "-port",
+			wantInterval: 10 * time.Second,
+			wantMounts:   []string{"/"},
+		},
+		{
+			name:         "empty environment variable",
+			env:          map[string]string{"CUBE_AUDIT_LOG": ""},
+			file:         testFile,
+			wantPort:     1000,
+			wantPortFrom: "tesseract.toml:6",
+			wantInterval: time.Second,
+			wantMounts:   []string{"/", "/file"},
+			wantAuditLog: "",
+		},
+		{
+			name:         "empty flag",
+			args:         []string{"-audit-log", ""},
+			env:          map[string]string{"CUBE_AUDIT_LOG": "/env/audit.log"},
+			file:         testFile,
+			wantPort:     1000,
+			wantPortFrom: "tesseract.toml:6",
+			wantInterval: time.Second,
+			wantMounts:   []string{"/", "/file"},
+			wantAuditLog: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, l, err := load(t, RoleWorker, tt.args, tt.env, tt.file)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if c.Worker.Port != tt.wantPort {
+				t.Errorf("Worker.Port = %d, want %d", c.Worker.Port, tt.wantPort)
+			}
+			if source := l.Source("worker.port"); !strings.HasSuffix(source, tt.wantPortFrom) {
+				t.Errorf("Source(worker.port) = %s, want %s", source, tt.wantPortFrom)
+			}
+			if c.Worker.TaskInterval != tt.wantInterval {
+				t.Errorf("Worker.TaskInterval = %v, want %v", c.Worker.TaskInterval, tt.wantInterval)
+			}
+			if !slices.Equal(c.Worker.Mounts, tt.wantMounts) {
+				t.Errorf("Worker.Mounts = %q, want %q", c.Worker.Mounts, tt.wantMounts)
+			}
+			if c.Audit.Log != tt.wantAuditLog {
+				t.Errorf("Audit.Log = %q, want %q", c.Audit.Log, tt.wantAuditLog)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tesseract.toml")
+	if err := os.WriteFile(path, []byte(testFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _, err := load(t, RoleWorker, nil, map[string]string{"CUBE_CONFIG": path}, "")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if c.Worker.Port != 1000 {
+		t.Errorf("Worker.Port = %d, want 1000 from CUBE_CONFIG", c.Worker.Port)
+	}
+
+	// -config takes precedence over CUBE_CONFIG.
+	c, _, err = load(t, RoleWorker, nil, map[string]string{"CUBE_CONFIG": "/does/not/exist.toml"}, "[worker]\nport = 2000")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if c.Worker.Port != 2000 {
+		t.Errorf("Worker.Port = %d, want 2000 from -config", c.Worker.Port)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		args    []string
+		env     map[string]string
+		file    string
+		wantErr string
+	}{
+		{name: "unknown setting", role: RoleWorker, file: "[worker]\nports = 1", wantErr: "line 2: unknown setting worker.ports"},
+		{name: "wrong type in the file", role: RoleWorker, file: "[worker]\nport = \"5555\"", wantErr: "line 2: worker.port: expected an integer"},
+		{name: "duration as an integer", role: RoleWorker, file: "[worker]\nport = 5555\ntask-interval = 10", wantErr: "worker.task-interval: expected a duration"},
+		{name: "invalid environment variable", role: RoleWorker, env: map[string]string{"CUBE_PORT": "http"}, wantErr: `CUBE_PORT: invalid integer "http"`},
+		{name: "empty integer in the environment", role: RoleWorker, env: map[string]string{"CUBE_PORT": ""}, wantErr: `CUBE_PORT: invalid integer ""`},
+		{name: "invalid flag", role: RoleWorker, args: []string{"-task-interval", "soon"}, wantErr: "invalid duration"},
+		{name: "missing worker port", role: RoleWorker, wantErr: "worker.port = 0 (default): a port is required"},
+		{name: "missing manager workers", role: RoleManager, args: []string{"-manager-port", "5556"}, wantErr: "manager.workers = [] (default): at least one worker is required"},
+		{name: "invalid trusted proxy", role: RoleWorker, args: []string{"-port", "5555"}, env: map[string]string{"CUBE_AUDIT_TRUSTED_PROXIES": "proxy.local"}, wantErr: "audit.trusted-proxies"},
+		{name: "no mounts", role: RoleWorker, args: []string{"-port", "5555"}, env: map[string]string{"CUBE_MOUNTS": ""}, wantErr: "worker.mounts = [] (CUBE_MOUNTS): at least one mount point is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := load(t, tt.role, tt.args, tt.env, tt.file)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fileValue is a value read from the configuration file: a string, an int64, a bool or a []string.
+type fileValue struct {
+	value any
+	line  int
+}
+
+// bareKey matches the keys and section names which are not quoted.
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// parseTOML reads the subset of TOML the configuration file uses: [section] headers, then key = value
+// lines whose value is a string, an integer, a boolean or an array of strings, which may span lines.
+// Comments start with #. The values are returned keyed by section.key.
+func parseTOML(r io.Reader) (map[string]fileValue, error) {
+	values := map[string]fileValue{}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || !bareKey.MatchString(strings.TrimSpace(line[1:len(line)-1])) {
+				return nil, fmt.Errorf("line %d: invalid section %q, expected [name]", lineNumber, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		if !ok || !bareKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", lineNumber, line)
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", lineNumber, key)
+		}
+
+		// An array goes on until its closing bracket, maybe on a later line.
+		start := lineNumber
+		if strings.HasPrefix(raw, "[") {
+			for !arrayClosed(raw) && scanner.Scan() {
+				lineNumber++
+				raw += " " + strings.TrimSpace(stripComment(scanner.Text()))
+			}
+		}
+		value, err := parseTOMLValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", start, key, err)
+		}
+		values[key] = fileValue{value: value, line: start}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// stripComment drops what follows a # which is not inside a string.
+func stripComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func arrayClosed(raw string) bool {
+	return strings.HasSuffix(strings.TrimSpace(raw), "]")
+}
+
+func parseTOMLValue(raw string) (any, error) {
+	switch {
+	case raw == "":
+		return nil, fmt.Errorf("missing value")
+	case raw == "true" || raw == "false":
+		return raw == "true", nil
+	case strings.HasPrefix(raw, "\"") || strings.HasPrefix(raw, "'"):
+		return parseTOMLString(raw)
+	case strings.HasPrefix(raw, "["):
+		return parseTOMLArray(raw)
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(raw, "_", ""), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %s, expected a quoted string, an integer, true, false or an array of strings", raw)
+	}
+	return n, nil
+}
+
+func parseTOMLString(raw string) (string, error) {
+	if len(raw) < 2 || raw[len(raw)-1] != raw[0] {
+		return "", fmt.Errorf("unterminated string %s", raw)
+	}
+	if raw[0] == '\'' {
+		s := raw[1 : len(raw)-1]
+		if strings.Contains(s, "'") {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return s, nil
+	}
+	s, err := strconv.Unquote(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid string %s", raw)
+	}
+	return s, nil
+}
+
+func parseTOMLArray(raw string) ([]string, error) {
+	if !arrayClosed(raw) {
+		return nil, fmt.Errorf("unterminated array %s", raw)
+	}
+	inner := strings.TrimSpace(raw[1 : len(raw)-1])
+	items := []string{}
+	for inner != "" {
+		if inner[0] != '"' && inner[0] != '\'' {
+			return nil, fmt.Errorf("invalid array %s, expected quoted strings separated by commas", raw)
+		}
+		end := closingQuote(inner)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string in array %s", raw)
+		}
+		item, err := parseTOMLString(inner[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		inner = strings.TrimSpace(inner[end+1:])
+		if inner == "" {
+			break
+		}
+		if inner[0] != ',' {
+			return nil, fmt.Errorf("invalid array %s, expected quoted strings separated by commas", raw)
+		}
+		inner = strings.TrimSpace(inner[1:])
+	}
+	return items, nil
+}
+
+// closingQuote returns the index of the quote closing the string s starts with, -1 when there is none.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[0] == '"' && s[i] == '\\':
+			i++
+		case s[i] == s[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+// formatTOML writes a value of a setting as TOML.
+func formatTOML(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		quoted := []string{}
+		for _, s := range v {
+			quoted = append(quoted, strconv.Quote(s))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
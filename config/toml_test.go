@@ -0,0 +1,100 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want map[string]fileValue
+	}{
+		{name: "empty", file: "", want: map[string]fileValue{}},
+		{name: "comments only", file: "# nothing\n\n  # still nothing\n", want: map[string]fileValue{}},
+		{
+			name: "values",
+			file: `
+[log]
+level = "DEBUG"  # a comment
+format = 'json'
+
+[worker]
+port = 5_555
+wait-for-tasks = true
+`,
+			want: map[string]fileValue{
+				"log.level":             {value: "DEBUG", line: 3},
+				"log.format":            {value: "json", line: 4},
+				"worker.port":           {value: int64(5555), line: 7},
+				"worker.wait-for-tasks": {value: true, line: 8},
+			},
+		},
+		{name: "key before any section", file: "level = \"INFO\"", want: map[string]fileValue{"level": {value: "INFO", line: 1}}},
+		{name: "escapes", file: `path = "C:\\tesseract \"#1\""`, want: map[string]fileValue{"path": {value: `C:\tesseract "#1"`, line: 1}}},
+		{name: "hash in a literal string", file: "path = '/tmp/#1' # comment", want: map[string]fileValue{"path": {value: "/tmp/#1", line: 1}}},
+		{name: "empty array", file: "mounts = []", want: map[string]fileValue{"mounts": {value: []string{}, line: 1}}},
+		{
+			name: "array",
+			file: `mounts = ["/", '/data', "/var/lib/docker"]`,
+			want: map[string]fileValue{"mounts": {value: []string{"/", "/data", "/var/lib/docker"}, line: 1}},
+		},
+		{
+			name: "array over lines",
+			file: "outputs = [\n  \"stdout\",  # the console\n  \"file:/var/log/a.log,level=debug\",\n]\nformat = \"text\"",
+			want: map[string]fileValue{
+				"outputs": {value: []string{"stdout", "file:/var/log/a.log,level=debug"}, line: 1},
+				"format":  {value: "text", line: 5},
+			},
+		},
+		{name: "comma in an array item", file: `workers = ["a:1,b:2"]`, want: map[string]fileValue{"workers": {value: []string{"a:1,b:2"}, line: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("parseTOML() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{name: "unclosed section", file: "[log", wantErr: "line 1: invalid section"},
+		{name: "nested section", file: "[log.sinks]", wantErr: "line 1: invalid section"},
+		{name: "empty section", file: "[]", wantErr: "line 1: invalid section"},
+		{name: "no value", file: "\nlevel", wantErr: "line 2: expected key = value"},
+		{name: "quoted key", file: `"level" = "INFO"`, wantErr: "line 1: expected key = value"},
+		{name: "missing value", file: "level =", wantErr: "line 1: level: missing value"},
+		{name: "set twice", file: "[log]\nlevel = \"INFO\"\nlevel = \"WARN\"", wantErr: "line 3: log.level is set twice"},
+		{name: "bare string", file: "level = INFO", wantErr: "line 1: level: invalid value INFO"},
+		{name: "float", file: "port = 1.5", wantErr: "line 1: port: invalid value 1.5"},
+		{name: "unterminated string", file: `level = "INFO`, wantErr: "line 1: level: unterminated string"},
+		{name: "mismatched quotes", file: `level = "INFO'`, wantErr: "line 1: level: unterminated string"},
+		{name: "invalid escape", file: `level = "\q"`, wantErr: "line 1: level: invalid string"},
+		{name: "unterminated array", file: "mounts = [\"/\",\n\"/data\"", wantErr: "line 1: mounts: unterminated array"},
+		{name: "array of integers", file: "ports = [1, 2]", wantErr: "line 1: ports: invalid array"},
+		{name: "array without commas", file: `mounts = ["/" "/data"]`, wantErr: "line 1: mounts: invalid array"},
+		{name: "unterminated array item", file: `mounts = ["/]`, wantErr: "line 1: mounts: unterminated string in array"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML(strings.NewReader(tt.file))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("parseTOML() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
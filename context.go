@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// defaultManager is the address of the manager when nothing else sets it, the one of make run-manager.
+const defaultManager = "localhost:5556"
+
+// cliContext is the context file of the commands, so that the address of the manager is not repeated
+// on every command. It lives in the user configuration directory, e.g. ~/.config/tesseract/context.json,
+// unless TESSERACT_CONTEXT is the path of another one.
+type cliContext struct {
+	// Manager is the address of the manager API, a host:port or a URL
+	Manager string
+}
+
+func contextPath() (string, error) {
+	if path := os.Getenv("TESSERACT_CONTEXT"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locating the context file: %w, set TESSERACT_CONTEXT", err)
+	}
+	return filepath.Join(dir, "tesseract", "context.json"), nil
+}
+
+// loadContext reads the context file, an empty context when there is none.
+func loadContext() (cliContext, string, error) {
+	c := cliContext{}
+	path, err := contextPath()
+	if err != nil {
+		return c, "", err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, path, nil
+	}
+	if err != nil {
+		return c, path, fmt.Errorf("reading the context file: %w", err)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, path, fmt.Errorf("decoding the context file %s: %w", path, err)
+	}
+	return c, path, nil
+}
+
+func (c cliContext) save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("writing the context file: %w", err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing the context file: %w", err)
+	}
+	return nil
+}
+
+// managerAddress is the address of the manager the commands talk to: the -manager flag, else
+// TESSERACT_MANAGER, else the context file, else defaultManager. It also says where it comes from.
+func managerAddress(flagValue string) (string, string, error) {
+	if flagValue != "" {
+		return flagValue, "-manager flag", nil
+	}
+	if address := os.Getenv("TESSERACT_MANAGER"); address != "" {
+		return address, "TESSERACT_MANAGER", nil
+	}
+	c, path, err := loadContext()
+	if err != nil {
+		return "", "", err
+	}
+	if c.Manager != "" {
+		return c.Manager, path, nil
+	}
+	return defaultManager, "default", nil
+}
+
+// runContext prints the manager the commands talk to, or saves the one given in the context file.
+func runContext(args []string) error {
+	fs := flag.NewFlagSet("context", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "context [ADDRESS]", "Print the address of the manager the commands talk to and where it comes from,\nor save ADDRESS in the context file as the manager to talk to.")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	switch fs.NArg() {
+	case 0:
+		address, source, err := managerAddress("")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (%s)\n", address, source)
+		return nil
+	case 1:
+		c, path, err := loadContext()
+		if err != nil {
+			return err
+		}
+		c.Manager = fs.Arg(0)
+		if err := c.save(path); err != nil {
+			return err
+		}
+		fmt.Printf("Talking to the manager at %s, saved in %s\n", c.Manager, path)
+		return nil
+	}
+	return usageError{errors.New("context takes at most one address")}
+}
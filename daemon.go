@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang-collections/collections/queue"
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/audit"
+	"github.com/praaatik/tesseract/config"
+	"github.com/praaatik/tesseract/logger"
+	"github.com/praaatik/tesseract/manager"
+	"github.com/praaatik/tesseract/task"
+	"github.com/praaatik/tesseract/tracing"
+	"github.com/praaatik/tesseract/worker"
+)
+
+// daemon is what the logging, auditing and tracing settings set up, to be closed once the daemon is shut down.
+type daemon struct {
+	logger       *logger.Logger
+	audit        *audit.Log
+	spanExporter *tracing.OTLPExporter
+}
+
+// logComponents are the components the daemon logs for, the ones whose level can be set.
+var logComponents = []string{"main", "api", "worker", "docker", "stats", "manager", "scheduler", "audit", "tracing"}
+
+// openDaemon sets up the logger, the audit log and the span exporter. The settings are already
+// validated, only opening the log outputs and the audit log can fail.
+func openDaemon(c *config.Config) (*daemon, error) {
+	logLevel, _ := logger.ParseLevel(c.Log.Level)
+	logLevels := logger.NewLevels(logLevel)
+	logLevels.Declare(logComponents...)
+	logLevels.ParseLevels(c.Log.Levels)
+	logFormat, _ := logger.ParseFormat(c.Log.Format)
+
+	sinks := []*logger.Sink{}
+	for _, spec := range c.Log.Outputs {
+		// Sinks take every record unless given a level, the levels of the components do the filtering.
+		sinkConfig, err := logger.ParseSinkConfig(spec, logger.DEBUG, logFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log output %q: %w", spec, err)
+		}
+		sink, err := sinkConfig.Open()
+		if err != nil {
+			return nil, fmt.Errorf("unable to open log output %q: %w", spec, err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	d := &daemon{logger: logger.NewWithSinks("main", logLevels, sinks...)}
+
+	if c.Audit.Log != "" {
+		var err error
+		d.audit, err = audit.Open(c.Audit.Log, d.logger.Named("audit"))
+		if err != nil {
+			d.logger.Close()
+			return nil, fmt.Errorf("unable to open audit log %s: %w", c.Audit.Log, err)
+		}
+		d.audit.TrustedProxies, _ = audit.ParseTrustedProxies(c.Audit.TrustedProxies)
+	}
+
+	if c.Tracing.OTLPEndpoint != "" {
+		d.spanExporter = tracing.NewOTLPExporter(c.Tracing.OTLPEndpoint, c.Tracing.Service, d.logger.Named("tracing"))
+		tracing.Default.SetExporter(d.spanExporter)
+		d.logger.Info("Exporting spans to %s", c.Tracing.OTLPEndpoint)
+	}
+	return d, nil
+}
+
+// close exports the last spans and closes the audit log and the logger.
+func (d *daemon) close(ctx context.Context) {
+	if d.spanExporter != nil {
+		if err := d.spanExporter.Shutdown(ctx); err != nil {
+			d.logger.Error("Error exporting the last spans: %v", err)
+		}
+	}
+	if d.audit != nil {
+		d.audit.Close()
+	}
+	d.logger.Close()
+}
+
+// runWorker runs a worker until it is signalled to stop, with a manager next to it when manager.port
+// is set, managing manager.workers or else the worker alone.
+func runWorker(args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "worker [flags]", "Run a worker, with a manager next to it when -manager-port is set.\nFlags take precedence over environment variables, then the configuration file, then the defaults.")
+	loader := config.NewLoader(fs, config.RoleWorker)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	c, err := loader.Load(os.LookupEnv)
+	if err != nil {
+		return usageError{err}
+	}
+
+	d, err := openDaemon(c)
+	if err != nil {
+		return err
+	}
+	logger := d.logger
+	host, port := c.Worker.Host, c.Worker.Port
+
+	workerName := fmt.Sprintf("%s:%d", host, port)
+	workerLogger := logger.Named("worker").With("worker", workerName)
+
+	w := worker.Worker{
+		Name:            workerName,
+		TaskQueue:       queue.New(),
+		TaskDb:          make(map[uuid.UUID]*task.Task),
+		GroupDb:         make(map[uuid.UUID]*worker.GroupRecord),
+		Logger:          workerLogger,
+		StopGracePeriod: c.Worker.StopGracePeriod,
+		StatsInterval:   c.Worker.StatsInterval,
+		UpdateInterval:  c.Worker.UpdateInterval,
+		History:         worker.NewStatsHistory(c.Worker.StatsWindow, c.Worker.StatsInterval),
+		Mounts:          c.Worker.Mounts,
+		StatsPaths:      worker.StatsPaths{Proc: c.Worker.ProcPath, Cgroup: c.Worker.CgroupPath},
+	}
+
+	api := worker.Api{
+		Address: host,
+		Port:    port,
+		Worker:  &w,
+		Logger:  workerLogger.Named("api"),
+		Audit:   d.audit,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tasksDone := make(chan struct{})
+	go func() {
+		runTasks(ctx, &w, c.Worker.TaskInterval)
+		close(tasksDone)
+	}()
+	go w.CollectStats()
+	go w.UpdateTasksForever()
+
+	apiErr := make(chan error, 2)
+	go func() {
+		apiErr <- api.Start()
+	}()
+
+	// The manager is optional, it runs next to the worker when manager.port is set.
+	var managerApi *manager.Api
+	if c.Manager.Port != 0 {
+		if len(c.Manager.Workers) == 0 {
+			c.Manager.Workers = []string{workerName}
+		}
+		managerApi = startManager(c, d)
+		go func() {
+			apiErr <- managerApi.Start()
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		logger.Info("Received shutdown signal")
+	case err := <-apiErr:
+		logger.Error("API stopped: %v", err)
+		stop()
+	}
+
+	// Stop accepting new tasks first, then let the queue loop finish its current task.
+	w.Drain()
+	<-tasksDone
+
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), c.Worker.ShutdownTimeout)
+	defer cancelWait()
+	w.Shutdown(waitCtx, c.Worker.WaitForTasks)
+	if err := w.Close(); err != nil {
+		logger.Warn("Error closing the Docker client: %v", err)
+	}
+
+	apiCtx, cancelApi := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelApi()
+	if managerApi != nil {
+		if err := managerApi.Shutdown(apiCtx); err != nil {
+			logger.Error("Error shutting down manager API: %v", err)
+		}
+	}
+	if err := api.Shutdown(apiCtx); err != nil {
+		logger.Error("Error shutting down worker API: %v", err)
+	}
+
+	logger.Info("Worker shut down")
+	d.close(apiCtx)
+	return nil
+}
+
+// runManager runs a manager alone, managing manager.workers, until it is signalled to stop.
+func runManager(args []string) error {
+	fs := flag.NewFlagSet("manager", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "manager [flags]", "Run a manager of the workers of -workers.\nFlags take precedence over environment variables, then the configuration file, then the defaults.")
+	loader := config.NewLoader(fs, config.RoleManager)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	c, err := loader.Load(os.LookupEnv)
+	if err != nil {
+		return usageError{err}
+	}
+
+	d, err := openDaemon(c)
+	if err != nil {
+		return err
+	}
+	logger := d.logger
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	managerApi := startManager(c, d)
+	apiErr := make(chan error, 1)
+	go func() {
+		apiErr <- managerApi.Start()
+	}()
+
+	select {
+	case <-ctx.Done():
+		logger.Info("Received shutdown signal")
+	case err := <-apiErr:
+		logger.Error("API stopped: %v", err)
+	}
+
+	apiCtx, cancelApi := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelApi()
+	if err := managerApi.Shutdown(apiCtx); err != nil {
+		logger.Error("Error shutting down manager API: %v", err)
+	}
+
+	logger.Info("Manager shut down")
+	d.close(apiCtx)
+	return nil
+}
+
+// runConfig prints the configuration a worker or a manager run with the same flags and environment
+// would have, each setting with what set it, then whatever makes it invalid.
+func runConfig(args []string) error {
+	role := config.RoleWorker
+	if len(args) > 0 && (args[0] == config.RoleWorker || args[0] == config.RoleManager) {
+		role, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "config [worker|manager] [flags]", "Print the effective configuration of a worker, or of a manager, given the same flags and environment.")
+	loader := config.NewLoader(fs, role)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	c, err := loader.Load(os.LookupEnv)
+	if c != nil {
+		if err := loader.Write(os.Stdout, c); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// startManager starts the loops of the manager of c and returns its API, which is not started yet.
+func startManager(c *config.Config, d *daemon) *manager.Api {
+	managerLogger := d.logger.Named("manager")
+	m := manager.New(c.Manager.Workers, managerLogger)
+	m.ProcessInterval = c.Manager.ProcessInterval
+	m.UpdateInterval = c.Manager.UpdateInterval
+	m.ReconcileInterval = c.Manager.ReconcileInterval
+
+	go m.ProcessTasks()
+	go m.UpdateTasksForever()
+	go m.ReconcileServicesForever()
+
+	host := c.Manager.Host
+	if host == "" {
+		host = c.Worker.Host
+	}
+	return &manager.Api{
+		Address: host,
+		Port:    c.Manager.Port,
+		Manager: m,
+		Logger:  managerLogger.Named("api"),
+		Audit:   d.audit,
+	}
+}
+
+func runTasks(ctx context.Context, w *worker.Worker, interval time.Duration) {
+	for {
+		if w.QueueLen() != 0 {
+			result := w.RunTask()
+			if result.Error != nil {
+				w.Logger.Error("Error running task: %v\n", result.Error)
+			}
+		} else {
+			w.Logger.Info("No tasks to process currently.\n")
+		}
+		w.Logger.Info("Sleeping for %v.", interval)
+
+		select {
+		case <-ctx.Done():
+			w.Logger.Info("Stopping task processing")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
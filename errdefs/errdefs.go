@@ -0,0 +1,161 @@
+// Package errdefs defines the errors of tesseract. Each error carries a Code which clients can
+// match on, stable across releases, and which decides the HTTP status it is reported with.
+// Errors without a Code, e.g. those of the standard library, are Internal.
+
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Code identifies the kind of an error. Codes are part of the API: they are never renamed
+// or reused, new ones may be added.
+type Code string
+
+const (
+	// InvalidArgument is a request which is malformed or fails validation.
+	InvalidArgument Code = "invalid_argument"
+
+	// NotFound is a task, group, service or node which does not exist.
+	NotFound Code = "not_found"
+
+	// AlreadyExists is a task, group or service created with the ID or name of an existing one.
+	AlreadyExists Code = "already_exists"
+
+	// InvalidTransition is a change of state the state machine does not allow.
+	InvalidTransition Code = "invalid_transition"
+
+	// Conflict is a request the current state of its target does not allow, e.g. updating
+	// a task which is not running or draining a node twice.
+	Conflict Code = "conflict"
+
+	// ImagePullFailed is an image Docker could not pull.
+	ImagePullFailed Code = "image_pull_failed"
+
+	// RuntimeUnavailable is a Docker daemon which cannot be reached.
+	RuntimeUnavailable Code = "runtime_unavailable"
+
+	// CapacityExceeded is a task no node has the room, or is schedulable, to run.
+	CapacityExceeded Code = "capacity_exceeded"
+
+	// Unavailable is a worker which is shutting down, or has no statistics yet.
+	Unavailable Code = "unavailable"
+
+	// WorkerUnavailable is a worker the manager could not reach.
+	WorkerUnavailable Code = "worker_unavailable"
+
+	// Internal is any other error.
+	Internal Code = "internal"
+)
+
+// Error is an error with a Code. Err is the error it wraps, if any.
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+
+	// Fields are the fields of the request which failed validation, if the error is about them
+	Fields []FieldViolation
+}
+
+// FieldViolation is a field of a request which failed validation.
+type FieldViolation struct {
+	// Field is the path of the field in the request, e.g. Task.Image
+	Field string
+
+	// Description says what is wrong with the field, e.g. "is required"
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error with the code and the message formatted as fmt.Errorf does, %w included.
+func New(code Code, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	return &Error{Code: code, Message: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// Invalid returns an InvalidArgument error listing the violations, which FieldsOf returns.
+func Invalid(violations []FieldViolation) error {
+	descriptions := []string{}
+	for _, v := range violations {
+		descriptions = append(descriptions, v.Field+" "+v.Description)
+	}
+	return &Error{
+		Code:    InvalidArgument,
+		Message: "invalid request: " + strings.Join(descriptions, "; "),
+		Fields:  violations,
+	}
+}
+
+// FieldsOf returns the FieldViolations of the first Error in the chain of err which has some.
+func FieldsOf(err error) []FieldViolation {
+	for err != nil {
+		if e, ok := err.(*Error); ok && len(e.Fields) > 0 {
+			return e.Fields
+		}
+		err = errors.Unwrap(err)
+	}
+	return nil
+}
+
+// CodeOf returns the Code of the first Error in the chain of err, Internal when there is none.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return Internal
+}
+
+// Is reports whether the chain of err holds an Error with the code.
+func Is(err error, code Code) bool {
+	return err != nil && CodeOf(err) == code
+}
+
+// statuses maps each Code to the HTTP status it is reported with.
+var statuses = map[Code]int{
+	InvalidArgument:    http.StatusBadRequest,
+	NotFound:           http.StatusNotFound,
+	AlreadyExists:      http.StatusConflict,
+	InvalidTransition:  http.StatusConflict,
+	Conflict:           http.StatusConflict,
+	ImagePullFailed:    http.StatusUnprocessableEntity,
+	RuntimeUnavailable: http.StatusServiceUnavailable,
+	CapacityExceeded:   http.StatusServiceUnavailable,
+	Unavailable:        http.StatusServiceUnavailable,
+	WorkerUnavailable:  http.StatusBadGateway,
+	Internal:           http.StatusInternalServerError,
+}
+
+// HTTPStatus returns the HTTP status errors with the code are reported with.
+func HTTPStatus(code Code) int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus guesses the Code of an error response which has none, e.g. from an older worker.
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return InvalidArgument
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	}
+	return Internal
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+// LevelsHandler serves the levels of the components log logs for. GET returns the level of every
+// component, e.g. {"api":"INFO","scheduler":"DEBUG"}. PUT changes the levels of the components in
+// the body, e.g. {"scheduler":"DEBUG"}, without a restart, and returns the level of every component.
+// A body naming a component which is not Known changes nothing. Errors are written with writeError,
+// in the error format of the API serving the levels.
+func LevelsHandler(log *Logger, writeError func(w http.ResponseWriter, err error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			levels := map[string]Level{}
+			if err := json.NewDecoder(r.Body).Decode(&levels); err != nil {
+				writeError(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+				return
+			}
+			if err := log.levels.check(levels); err != nil {
+				writeError(w, err)
+				return
+			}
+
+			for component, level := range levels {
+				log.levels.Set(component, level)
+				log.Info("Log level of %s set to %v", component, level)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(log.levels.All())
+	}
+}
+
+// check rejects the levels of components which are not Known, listing each of them.
+func (l *Levels) check(levels map[string]Level) error {
+	l.mu.Lock()
+	known := make([]string, 0, len(l.known))
+	for component := range l.known {
+		known = append(known, component)
+	}
+	l.mu.Unlock()
+	slices.Sort(known)
+
+	violations := []errdefs.FieldViolation{}
+	for component := range levels {
+		if !slices.Contains(known, component) {
+			violations = append(violations, errdefs.FieldViolation{
+				Field:       component,
+				Description: "is not a component, expected one of " + strings.Join(known, ", "),
+			})
+		}
+	}
+	if len(violations) > 0 {
+		slices.SortFunc(violations, func(a, b errdefs.FieldViolation) int { return strings.Compare(a.Field, b.Field) })
+		return errdefs.Invalid(violations)
+	}
+	return nil
+}
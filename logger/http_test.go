@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+func TestLevelsHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantLevel  Level
+	}{
+		{name: "get", method: http.MethodGet, wantStatus: http.StatusOK, wantLevel: INFO},
+		{name: "set", method: http.MethodPut, body: `{"scheduler":"DEBUG"}`, wantStatus: http.StatusOK, wantLevel: DEBUG},
+		{name: "declared component", method: http.MethodPut, body: `{"scheduler":"WARN","stats":"ERROR"}`, wantStatus: http.StatusOK, wantLevel: WARN},
+		{name: "unknown component", method: http.MethodPut, body: `{"scheduler":"DEBUG","shceduler":"DEBUG"}`, wantStatus: http.StatusBadRequest, wantLevel: INFO},
+		{name: "unknown level", method: http.MethodPut, body: `{"scheduler":"TRACE"}`, wantStatus: http.StatusBadRequest, wantLevel: INFO},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := NewWithSinks("main", NewLevels(INFO), NewSink(io.Discard, DEBUG, TEXT))
+			log.Named("scheduler")
+			log.Levels().Declare("stats")
+
+			var written error
+			handler := LevelsHandler(log, func(w http.ResponseWriter, err error) {
+				written = err
+				w.WriteHeader(errdefs.HTTPStatus(errdefs.CodeOf(err)))
+			})
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tt.method, "/admin/loglevels", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, error %v", rec.Code, tt.wantStatus, written)
+			}
+			if got := log.Levels().Get("scheduler"); got != tt.wantLevel {
+				t.Errorf("level of scheduler = %v, want %v", got, tt.wantLevel)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			levels := map[string]Level{}
+			if err := json.NewDecoder(rec.Body).Decode(&levels); err != nil {
+				t.Fatalf("decoding the levels: %v", err)
+			}
+			if levels["scheduler"] != tt.wantLevel {
+				t.Errorf("levels = %v, want scheduler at %v", levels, tt.wantLevel)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Levels holds the minimum level of each component. Components without a level of their own
+// log at the default level.
+type Levels struct {
+	def Level
+
+	mu     sync.Mutex
+	levels map[string]*atomic.Int32
+
+	// known are the components a logger was created for or which were declared
+	known map[string]bool
+}
+
+// NewLevels creates the levels of the components, starting at def.
+func NewLevels(def Level) *Levels {
+	return &Levels{def: def, levels: make(map[string]*atomic.Int32), known: make(map[string]bool)}
+}
+
+// Declare makes the components known before a logger is created for them, which some are only
+// when they first log.
+func (l *Levels) Declare(components ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, component := range components {
+		l.known[component] = true
+	}
+}
+
+// Known reports whether a logger was created for the component or it was declared.
+func (l *Levels) Known(component string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.known[component]
+}
+
+// Set changes the level of a component, loggers already created for it follow straight away.
+func (l *Levels) Set(component string, level Level) {
+	l.level(component).Store(int32(level))
+}
+
+// Get returns the level of a component.
+func (l *Levels) Get(component string) Level {
+	return Level(l.level(component).Load())
+}
+
+// All returns the level of every component a logger was created for, or whose level was set.
+func (l *Levels) All() map[string]Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	all := make(map[string]Level)
+	for component, level := range l.levels {
+		all[component] = Level(level.Load())
+	}
+	return all
+}
+
+// ParseLevels sets the levels given as comma-separated component=level pairs,
+// e.g. scheduler=debug,stats=warn.
+func (l *Levels) ParseLevels(spec string) error {
+	if spec == "" {
+		return nil
+	}
+
+	parsed := make(map[string]Level)
+	for _, pair := range strings.Split(spec, ",") {
+		component, levelStr, ok := strings.Cut(pair, "=")
+		if !ok || component == "" {
+			return fmt.Errorf("invalid component level %q, expected component=level", pair)
+		}
+		level, err := ParseLevel(levelStr)
+		if err != nil {
+			return err
+		}
+		parsed[component] = level
+	}
+
+	for component, level := range parsed {
+		l.Set(component, level)
+	}
+	return nil
+}
+
+// logger returns the level of a component a logger is created for, which makes it known.
+func (l *Levels) logger(component string) *atomic.Int32 {
+	l.Declare(component)
+	return l.level(component)
+}
+
+func (l *Levels) level(component string) *atomic.Int32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	level, ok := l.levels[component]
+	if !ok {
+		level = &atomic.Int32{}
+		level.Store(int32(l.def))
+		l.levels[component] = level
+	}
+	return level
+}
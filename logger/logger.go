@@ -1,9 +1,14 @@
 package logger
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Level represents the severity of the log message
@@ -17,38 +22,165 @@ const (
 	ERROR              // 3
 )
 
-// Logger wraps the standard logger with level-based filtering
+// Format is how log records are written
+type Format int
+
+// log formats
+const (
+	// TEXT writes one human readable line per record, with the fields as key=value pairs
+	TEXT Format = iota
+
+	// JSON writes one JSON object per record, with timestamp, level, component, message and the fields
+	JSON
+)
+
+// Logger filters records by the level of its component and writes them to one or more sinks.
+// Records can carry key/value fields, added with With, and be written as text or JSON.
 type Logger struct {
-	*log.Logger
-	level Level
+	component string
+	fields    []any
+
+	// level is the minimum level of the component, it can be changed at runtime through levels
+	level *atomic.Int32
+
+	// levels and sinks are shared with the loggers derived with With and Named
+	levels *Levels
+	sinks  []*Sink
 }
 
-// NewLogger creates a logger with a prefix and minimum log level
+// NewLogger creates a logger with a prefix and minimum log level, writing text to stdout
 func NewLogger(prefix string, level Level) *Logger {
-	return &Logger{
-		Logger: log.New(os.Stdout, prefix, log.LstdFlags),
-		level:  level,
+	component := strings.TrimSuffix(strings.TrimSpace(prefix), ":")
+	return NewWithSinks(component, NewLevels(level), NewSink(os.Stdout, DEBUG, TEXT))
+}
+
+// NewJSONLogger creates a logger writing one JSON object per record for the component to stdout,
+// with a minimum log level
+func NewJSONLogger(component string, level Level) *Logger {
+	return NewWithSinks(component, NewLevels(level), NewSink(os.Stdout, DEBUG, JSON))
+}
+
+// New creates a logger for the component writing to stdout in the given format
+func New(component string, level Level, format Format) *Logger {
+	return NewWithSinks(component, NewLevels(level), NewSink(os.Stdout, DEBUG, format))
+}
+
+// NewWithSinks creates a logger for the component writing every record which meets the level
+// of its component to each sink whose own level it meets
+func NewWithSinks(component string, levels *Levels, sinks ...*Sink) *Logger {
+	return &Logger{component: component, level: levels.logger(component), levels: levels, sinks: sinks}
+}
+
+// Levels returns the levels of the components, shared by every logger derived from this one.
+func (l *Logger) Levels() *Levels {
+	return l.levels
+}
+
+// Close closes the files and syslog connections of the sinks. It is meant to be called once,
+// on the root logger, when the program exits.
+func (l *Logger) Close() error {
+	var errs []error
+	for _, s := range l.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
 }
 
-// ParseLevel converts a string to a Level
+// ParseLevel converts a string to a Level, it fails on anything but DEBUG, INFO, WARN or ERROR
 func ParseLevel(levelStr string) (Level, error) {
 	switch strings.ToUpper(levelStr) {
 	case "DEBUG":
 		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
 	case "WARN":
 		return WARN, nil
 	case "ERROR":
 		return ERROR, nil
 	default:
-		return INFO, nil
+		return INFO, fmt.Errorf("unknown log level %q, expected DEBUG, INFO, WARN or ERROR", levelStr)
+	}
+}
+
+func (level Level) String() string {
+	switch level {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("Level(%d)", int(level))
 	}
 }
 
+// MarshalText writes the level by name, so that levels read as "DEBUG" rather than 0 in JSON.
+func (level Level) MarshalText() ([]byte, error) {
+	return []byte(level.String()), nil
+}
+
+// UnmarshalText parses a level name with ParseLevel.
+func (level *Level) UnmarshalText(text []byte) error {
+	l, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*level = l
+	return nil
+}
+
+// ParseFormat converts "text" or "json" to a Format
+func ParseFormat(formatStr string) (Format, error) {
+	switch strings.ToLower(formatStr) {
+	case "text":
+		return TEXT, nil
+	case "json":
+		return JSON, nil
+	default:
+		return TEXT, fmt.Errorf("unknown log format %q", formatStr)
+	}
+}
+
+// With returns a child logger adding the key/value pairs to every record, e.g.
+// With("task_id", t.ID, "worker", name). The parent is left unchanged.
+func (l *Logger) With(fields ...any) *Logger {
+	child := *l
+	child.fields = append(l.fields[:len(l.fields):len(l.fields)], fields...)
+	return &child
+}
+
+// Named returns a child logger for another component, keeping the sinks and fields.
+// The child logs at the level of its component.
+func (l *Logger) Named(component string) *Logger {
+	child := *l
+	child.component = component
+	child.level = l.levels.logger(component)
+	return &child
+}
+
 // Log logs a message if its level meets the logger's level
 func (l *Logger) Log(level Level, format string, v ...any) {
-	if level >= l.level {
-		l.Printf(format, v...)
+	if level < Level(l.level.Load()) {
+		return
+	}
+
+	// Records are one line each, fields included, so trailing newlines are dropped.
+	r := record{
+		time:      time.Now(),
+		level:     level,
+		component: l.component,
+		message:   strings.TrimRight(fmt.Sprintf(format, v...), "\n"),
+		fields:    l.fields,
+	}
+	for _, s := range l.sinks {
+		if err := s.write(r); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing log record: %v\n", err)
+		}
 	}
 }
 
@@ -71,3 +203,35 @@ func (l *Logger) Warn(format string, v ...any) {
 func (l *Logger) Error(format string, v ...any) {
 	l.Log(ERROR, format, v...)
 }
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case DEBUG:
+		return slog.LevelDebug
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// formatFields renders the fields of a text record as " key=value" pairs,
+// quoting values with spaces. A key without a value is written as !BADKEY like slog does.
+func formatFields(fields []any) string {
+	var b strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		key, value := "!BADKEY", fields[i]
+		if i+1 < len(fields) {
+			key, value = fmt.Sprint(fields[i]), fields[i+1]
+		}
+
+		v := fmt.Sprint(value)
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, v)
+	}
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to the name of a rotated file, e.g. tesseract.log.20240102T150405.000
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingFile is a log file which is rotated when it grows past MaxSize or gets older than
+// RotateEvery. Rotated files are renamed with a timestamp suffix and deleted past MaxBackups or MaxAge.
+type RotatingFile struct {
+	// Path of the current log file, rotated files are kept next to it
+	Path string
+
+	// MaxSize is the size in bytes past which the file is rotated, 0 for no limit
+	MaxSize int64
+
+	// RotateEvery is the age past which the file is rotated, 0 for no limit
+	RotateEvery time.Duration
+
+	// MaxBackups is the number of rotated files kept, 0 keeps them all
+	MaxBackups int
+
+	// MaxAge is how long rotated files are kept, 0 keeps them forever
+	MaxAge time.Duration
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// Write appends p to the file, rotating it first if p would not fit or the file is too old.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	tooBig := f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize
+	tooOld := f.RotateEvery > 0 && time.Since(f.openedAt) >= f.RotateEvery
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file, the next Write opens it again.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open opens the file for appending, the age of an existing file counts from its last modification.
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if f.size > 0 {
+		f.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	backup := fmt.Sprintf("%s.%s", f.Path, time.Now().UTC().Format(backupTimeFormat))
+	if err := os.Rename(f.Path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.removeBackups()
+}
+
+// removeBackups deletes the rotated files past MaxBackups, oldest first, and the ones older than MaxAge.
+func (f *RotatingFile) removeBackups() error {
+	backups, err := filepath.Glob(f.Path + ".*")
+	if err != nil {
+		return err
+	}
+	// The timestamp suffix sorts in time order.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	kept := 0
+	for _, backup := range backups {
+		suffix := strings.TrimPrefix(backup, f.Path+".")
+		rotatedAt, err := time.Parse(backupTimeFormat, suffix)
+		if err != nil {
+			continue
+		}
+
+		expired := f.MaxAge > 0 && time.Since(rotatedAt) > f.MaxAge
+		if (f.MaxBackups > 0 && kept >= f.MaxBackups) || expired {
+			if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		kept++
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink is a destination of log records, with its own minimum level and format.
+type Sink struct {
+	level  Level
+	format Format
+
+	mu     sync.Mutex
+	out    io.Writer
+	syslog *syslog.Writer
+}
+
+// NewSink creates a sink writing the records of at least level to w, in the given format.
+func NewSink(w io.Writer, level Level, format Format) *Sink {
+	return &Sink{level: level, format: format, out: w}
+}
+
+// NewSyslogSink creates a sink sending the records of at least level to the local syslog daemon,
+// tagged with tag. The severity of each message follows its level.
+func NewSyslogSink(tag string, level Level, format Format) (*Sink, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &Sink{level: level, format: format, syslog: w}, nil
+}
+
+// Close closes the file or syslog connection behind the sink, if any.
+func (s *Sink) Close() error {
+	if s.syslog != nil {
+		return s.syslog.Close()
+	}
+	if c, ok := s.out.(io.Closer); ok && s.out != os.Stdout && s.out != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+// record is a log record before it is formatted by each sink.
+type record struct {
+	time      time.Time
+	level     Level
+	component string
+	message   string
+	fields    []any
+}
+
+func (s *Sink) write(r record) error {
+	if r.level < s.level {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.syslog != nil {
+		// syslog adds its own timestamp.
+		line := r.component + ": " + r.message + formatFields(r.fields)
+		if s.format == JSON {
+			line = string(bytes.TrimSpace(formatJSON(r)))
+		}
+		switch r.level {
+		case DEBUG:
+			return s.syslog.Debug(line)
+		case WARN:
+			return s.syslog.Warning(line)
+		case ERROR:
+			return s.syslog.Err(line)
+		default:
+			return s.syslog.Info(line)
+		}
+	}
+
+	if s.format == JSON {
+		_, err := s.out.Write(formatJSON(r))
+		return err
+	}
+	_, err := fmt.Fprintf(s.out, "%s: %s %s%s\n", r.component, r.time.Format("2006/01/02 15:04:05"), r.message, formatFields(r.fields))
+	return err
+}
+
+// formatJSON renders a record as one JSON object on a line, with timestamp, level, component,
+// message and the fields.
+func formatJSON(r record) []byte {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey:
+				a.Key = "timestamp"
+			case slog.MessageKey:
+				a.Key = "message"
+			}
+			return a
+		},
+	})
+
+	sr := slog.NewRecord(r.time, slogLevel(r.level), r.message, 0)
+	sr.Add("component", r.component)
+	sr.Add(r.fields...)
+	handler.Handle(context.Background(), sr)
+	return buf.Bytes()
+}
+
+// SinkConfig describes a sink, see ParseSinkConfig for its text form.
+type SinkConfig struct {
+	// Type is one of stdout, stderr, file or syslog
+	Type string
+
+	// Path is the log file of a file sink
+	Path string
+
+	// Tag is the syslog tag of a syslog sink, tesseract when empty
+	Tag string
+
+	Level  Level
+	Format Format
+
+	// Rotation of a file sink, see RotatingFile
+	MaxSize     int64
+	RotateEvery time.Duration
+	MaxBackups  int
+	MaxAge      time.Duration
+}
+
+// ParseSinkConfig parses a sink from its text form: the type, the path of a file sink after a colon,
+// then comma-separated options. Level and format default to the given ones. For example:
+//
+//	stdout,level=info
+//	file:/var/log/tesseract.log,level=debug,format=json,max-size=10MB,max-backups=5,max-age=168h,rotate-every=24h
+//	syslog,level=warn,tag=tesseract
+func ParseSinkConfig(spec string, level Level, format Format) (SinkConfig, error) {
+	options := strings.Split(spec, ",")
+	c := SinkConfig{Level: level, Format: format}
+	c.Type, c.Path, _ = strings.Cut(options[0], ":")
+
+	switch c.Type {
+	case "stdout", "stderr", "syslog":
+		if c.Path != "" {
+			return SinkConfig{}, fmt.Errorf("sink %s takes no path", c.Type)
+		}
+	case "file":
+		if c.Path == "" {
+			return SinkConfig{}, fmt.Errorf("file sink needs a path, e.g. file:/var/log/tesseract.log")
+		}
+	default:
+		return SinkConfig{}, fmt.Errorf("unknown sink type %q", c.Type)
+	}
+
+	for _, option := range options[1:] {
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return SinkConfig{}, fmt.Errorf("invalid sink option %q, expected key=value", option)
+		}
+
+		var err error
+		switch key {
+		case "level":
+			c.Level, err = ParseLevel(value)
+		case "format":
+			c.Format, err = ParseFormat(value)
+		case "tag":
+			c.Tag = value
+		case "max-size":
+			c.MaxSize, err = parseSize(value)
+		case "rotate-every":
+			c.RotateEvery, err = time.ParseDuration(value)
+		case "max-backups":
+			c.MaxBackups, err = strconv.Atoi(value)
+		case "max-age":
+			c.MaxAge, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			return SinkConfig{}, fmt.Errorf("invalid sink option %q: %w", option, err)
+		}
+	}
+	return c, nil
+}
+
+// Open creates the sink described by the config.
+func (c SinkConfig) Open() (*Sink, error) {
+	switch c.Type {
+	case "stdout":
+		return NewSink(os.Stdout, c.Level, c.Format), nil
+	case "stderr":
+		return NewSink(os.Stderr, c.Level, c.Format), nil
+	case "file":
+		f := &RotatingFile{
+			Path:        c.Path,
+			MaxSize:     c.MaxSize,
+			RotateEvery: c.RotateEvery,
+			MaxBackups:  c.MaxBackups,
+			MaxAge:      c.MaxAge,
+		}
+		// Open the file now so that a bad path fails at startup rather than on the first record.
+		f.mu.Lock()
+		err := f.open()
+		f.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return NewSink(f, c.Level, c.Format), nil
+	case "syslog":
+		tag := c.Tag
+		if tag == "" {
+			tag = "tesseract"
+		}
+		return NewSyslogSink(tag, c.Level, c.Format)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", c.Type)
+}
+
+// parseSize parses a number of bytes with an optional KB, MB or GB suffix (powers of 1024).
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	upper := strings.ToUpper(s)
+	for suffix, m := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(upper, suffix) {
+			multiplier = m
+			upper = strings.TrimSuffix(upper, suffix)
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(upper), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
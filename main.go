@@ -1,65 +1,128 @@
+// Command tesseract runs the worker and manager daemons and talks to a manager on behalf of users.
+//
+//	tesseract worker [flags]             run a worker, see tesseract worker -h
+//	tesseract manager [flags]            run a manager
+//	tesseract run [flags] IMAGE [CMD...] run a task
+//	tesseract ps [flags]                 list tasks
+//	tesseract apply -f FILE              create or update the tasks of a manifest
+//
+// Without a command it runs a worker, as it did before it had commands.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"strconv"
-	"time"
-
-	"github.com/golang-collections/collections/queue"
-	"github.com/google/uuid"
-	"github.com/praaatik/tesseract/logger"
-	"github.com/praaatik/tesseract/task"
-	"github.com/praaatik/tesseract/worker"
+	"strings"
+	"text/tabwriter"
 )
 
-func main() {
-	host := os.Getenv("CUBE_HOST")
-	port, _ := strconv.Atoi(os.Getenv("CUBE_PORT"))
+// command is a subcommand of tesseract, run with the arguments following its name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
 
-	logLevelStr := flag.String("loglevel", "INFO", "Set logging level (DEBUG, INFO, WARN, ERROR)")
-	flag.Parse()
+// commands lists the subcommands in the order of the usage.
+var commands = []command{
+	{"worker", "Run a worker", runWorker},
+	{"manager", "Run a manager", runManager},
+	{"config", "Print the effective configuration of a worker or a manager", runConfig},
+	{"run", "Run a task", runRun},
+	{"ps", "List tasks", runPs},
+	{"inspect", "Show the details of tasks", runInspect},
+	{"stop", "Stop tasks", runStop},
+	{"logs", "Print the output of the container of a task", runLogs},
+	{"stats", "Show the resource usage of a task or of the nodes", runStats},
+	{"apply", "Create or update the tasks of a manifest, keyed by name", runApply},
+	{"diff", "Show what applying a manifest would change", runDiff},
+	{"delete", "Stop the tasks of a manifest", runDelete},
+	{"nodes", "List the nodes of the cluster", runNodes},
+	{"context", "Show or set the manager the commands talk to", runContext},
+}
 
-	logLevel, err := logger.ParseLevel(*logLevelStr)
+// usageError is an error in the arguments of a command, which exits with status 2.
+type usageError struct {
+	err error
+}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid log level %q, defaulting to INFO: %v\n", *logLevelStr, err)
-		logLevel = logger.INFO
-	}
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+// errFlags is returned for invalid flags, which the flag package already printed with the usage.
+var errFlags = errors.New("invalid flags")
 
-	logger := logger.NewLogger("main: ", logLevel)
+func main() {
+	args := os.Args[1:]
 
-	w := worker.Worker{
-		TaskQueue: queue.New(),
-		TaskDb:    make(map[uuid.UUID]*task.Task),
-		Logger:    logger,
+	// Without a command the binary runs a worker, as it always did.
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelp(args[0])) {
+		exit(runWorker(args))
 	}
 
-	api := worker.Api{
-		Address: host,
-		Port:    port,
-		Worker:  &w,
-		Logger:  logger,
+	name := args[0]
+	if name == "help" || isHelp(name) {
+		usage()
+		os.Exit(0)
+	}
+	for _, c := range commands {
+		if c.name == name {
+			exit(c.run(args[1:]))
+		}
 	}
+	fmt.Fprintf(os.Stderr, "tesseract: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	go runTasks(&w)
-	go w.CollectStats()
+// exit exits with the status matching err, printing it unless it was already.
+func exit(err error) {
+	var u usageError
+	switch {
+	case err == nil:
+		os.Exit(0)
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.Is(err, errFlags):
+		os.Exit(2)
+	case errors.As(err, &u):
+		fmt.Fprintf(os.Stderr, "tesseract: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Fprintf(os.Stderr, "tesseract: %v\n", err)
+	os.Exit(1)
+}
 
-	api.Start()
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
 }
 
-func runTasks(w *worker.Worker) {
-	for {
-		if w.TaskQueue.Len() != 0 {
-			result := w.RunTask()
-			if result.Error != nil {
-				w.Logger.Error("Error running task: %v\n", result.Error)
-			}
-		} else {
-			w.Logger.Info("No tasks to process currently.\n")
-		}
-		w.Logger.Info("Sleeping for 10 seconds.")
-		time.Sleep(10 * time.Second)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: tesseract <command> [flags] [arguments]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 3, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(os.Stderr, "\nRun tesseract <command> -h for the flags of a command. Without a command, tesseract runs a worker.\n")
+}
+
+// usageFunc returns the usage of a command, printed by its flag set on -h or an invalid flag.
+func usageFunc(fs *flag.FlagSet, synopsis string, description string) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: tesseract %s\n\n%s\n\nFlags:\n", synopsis, description)
+		fs.PrintDefaults()
+	}
+}
+
+// parseFlags parses the flags of a command, see errFlags.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return errFlags
 	}
+	return err
 }
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+// TaskPreview is the answer to a dry run of a task submission: the Task as it would be queued and
+// the workers it could be scheduled on.
+type TaskPreview struct {
+	Task task.Task
+
+	// Candidates are the names of the workers the Scheduler would choose from now, none means the
+	// Task would wait in the queue until one can run it
+	Candidates []string
+
+	// Message explains the preview when the Task would not be scheduled right away
+	Message string `json:",omitempty"`
+}
+
+// AdmitTask normalizes a submitted Event, see task.Event.Normalize, and checks it, rejecting the ID
+// of a known Task.
+func (m *Manager) AdmitTask(te *task.Event) error {
+	te.Normalize()
+	if err := te.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	_, exists := m.TaskDb[te.Task.ID]
+	m.mu.Unlock()
+	if exists {
+		return duplicateTask(te.Task.ID)
+	}
+	return nil
+}
+
+// SubmitTask admits the Event, see AdmitTask, and queues it like AddTask. It returns the Task as queued.
+func (m *Manager) SubmitTask(te task.Event) (*task.Task, error) {
+	if err := m.AdmitTask(&te); err != nil {
+		return nil, err
+	}
+
+	te.Task.SetState(task.Pending, "Submitted")
+	t := te.Task
+	m.mu.Lock()
+	// Another submission of the same ID may have come in since it was admitted.
+	if _, exists := m.TaskDb[t.ID]; exists {
+		m.mu.Unlock()
+		return nil, duplicateTask(t.ID)
+	}
+	m.TaskDb[t.ID] = &t
+	m.mu.Unlock()
+
+	te.Task.QueuedAt = time.Now()
+	m.enqueue(te)
+	m.Logger.Debug("Task %v added to the Pending queue", t.ID)
+	return &t, nil
+}
+
+// PreviewTask returns what submitting the admitted Task would do, without queueing it. The
+// candidates are not scored, since scoring may advance the state of the Scheduler.
+func (m *Manager) PreviewTask(t task.Task) TaskPreview {
+	t.SetState(task.Pending, "Submitted")
+	p := TaskPreview{Task: t, Candidates: []string{}}
+
+	m.mu.Lock()
+	for _, n := range m.Scheduler.SelectCandidateNodes(t, m.WorkerNodes) {
+		p.Candidates = append(p.Candidates, n.Name)
+	}
+	workers := len(m.WorkerNodes)
+	m.mu.Unlock()
+
+	if len(p.Candidates) == 0 {
+		p.Message = fmt.Sprintf("None of the %d workers is schedulable, the task would wait in the queue", workers)
+	}
+	return p
+}
+
+func duplicateTask(id uuid.UUID) error {
+	return &errdefs.Error{
+		Code:    errdefs.AlreadyExists,
+		Message: fmt.Sprintf("task %v already exists", id),
+		Fields:  []errdefs.FieldViolation{{Field: "Task.ID", Description: "is the ID of an existing task"}},
+	}
+}
@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/praaatik/tesseract/audit"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/logger"
+	"github.com/praaatik/tesseract/metrics"
+	"github.com/praaatik/tesseract/tracing"
+)
+
+// NextCursorHeader carries the cursor of the next page of the task listing, whose body is a bare list.
+const NextCursorHeader = "X-Next-Cursor"
+
+// eventsInterval is how often GET /events looks for changes of state.
+const eventsInterval = time.Second
+
+// ErrResponse is the body of every error response.
+type ErrResponse struct {
+	HTTPStatusCode int
+
+	// Code is the errdefs.Code of the error, which clients can match on
+	Code    errdefs.Code
+	Message string
+
+	// Fields are the fields of the request which failed validation, when the error is about them
+	Fields []errdefs.FieldViolation `json:",omitempty"`
+}
+
+type Api struct {
+	Address string
+	Port    int
+	Manager *Manager
+	Logger  *logger.Logger
+	Router  *http.ServeMux
+
+	// Audit records the calls which change state, none are recorded when it is nil
+	Audit *audit.Log
+
+	// server is the HTTP server started by Start, kept around to shut it down.
+	server *http.Server
+}
+
+func (a *Api) initRouter() {
+	a.Router = http.NewServeMux()
+
+	// Task creation
+	a.Router.HandleFunc("POST /tasks", a.StartTaskHandler)
+
+	// Getting all tasks
+	a.Router.HandleFunc("GET /tasks", a.GetTasksHandler)
+
+	// A single task, with the status of its container
+	a.Router.HandleFunc("GET /tasks/{taskID}", a.GetTaskHandler)
+
+	// Updating running tasks
+	a.Router.HandleFunc("PATCH /tasks/{taskID}", a.PatchTaskHandler)
+
+	// Stopping tasks (deleting)
+	a.Router.HandleFunc("DELETE /tasks/{taskID}", a.StopTaskHandler)
+
+	// Streaming the output of tasks and their changes of state
+	a.Router.HandleFunc("GET /tasks/{taskID}/logs", a.GetTaskLogsHandler)
+	a.Router.HandleFunc("GET /events", a.GetEventsHandler)
+
+	// Nodes and their schedulable status
+	a.Router.HandleFunc("GET /nodes", a.GetNodesHandler)
+
+	// Node maintenance
+	a.Router.HandleFunc("POST /nodes/{name}/cordon", a.CordonNodeHandler)
+	a.Router.HandleFunc("POST /nodes/{name}/uncordon", a.UncordonNodeHandler)
+	a.Router.HandleFunc("POST /nodes/{name}/drain", a.DrainNodeHandler)
+
+	// Task groups
+	a.Router.HandleFunc("POST /groups", a.StartGroupHandler)
+	a.Router.HandleFunc("GET /groups", a.GetGroupsHandler)
+	a.Router.HandleFunc("GET /groups/{groupID}", a.GetGroupHandler)
+	a.Router.HandleFunc("DELETE /groups/{groupID}", a.StopGroupHandler)
+
+	// Replicated services
+	a.Router.HandleFunc("POST /services", a.CreateServiceHandler)
+	a.Router.HandleFunc("GET /services", a.GetServicesHandler)
+	a.Router.HandleFunc("GET /services/{name}", a.GetServiceHandler)
+	a.Router.HandleFunc("POST /services/{name}/scale", a.ScaleServiceHandler)
+	a.Router.HandleFunc("DELETE /services/{name}", a.DeleteServiceHandler)
+
+	// Rolling updates
+	a.Router.HandleFunc("POST /services/{name}/update", a.UpdateServiceHandler)
+	a.Router.HandleFunc("POST /services/{name}/rollback", a.RollbackServiceHandler)
+
+	// Declarative manifests, keyed by task name
+	a.Router.HandleFunc("POST /manifests/apply", a.ApplyManifestHandler)
+	a.Router.HandleFunc("POST /manifests/diff", a.DiffManifestHandler)
+	a.Router.HandleFunc("POST /manifests/delete", a.DeleteManifestHandler)
+
+	// Log levels of the components, adjustable at runtime
+	logLevels := logger.LevelsHandler(a.Logger, writeError)
+	a.Router.HandleFunc("GET /admin/loglevels", logLevels)
+	a.Router.HandleFunc("PUT /admin/loglevels", logLevels)
+
+	// Audit trail of the calls which changed state
+	if a.Audit != nil {
+		a.Router.HandleFunc("GET /audit", audit.Handler(a.Audit, writeError))
+	}
+
+	// Prometheus metrics
+	a.Router.HandleFunc("GET /metrics", metrics.Handler(metrics.Default))
+	if err := a.Manager.registerMetrics(metrics.Default); err != nil {
+		a.Logger.Warn("Manager metrics not registered: %v", err)
+	}
+}
+
+// Start serves the API until Shutdown is called. It only returns an error when the server fails.
+func (a *Api) Start() error {
+	a.initRouter()
+	var handler http.Handler = a.Router
+	if a.Audit != nil {
+		handler = audit.Instrument(a.Audit, "manager", handler)
+	}
+	a.server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", a.Address, a.Port),
+		Handler: tracing.Instrument(tracing.Default, "manager", metrics.Instrument("manager", handler)),
+	}
+
+	a.Logger.Info("Manager API listening on %s", a.server.Addr)
+	err := a.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to finish or ctx to be done.
+func (a *Api) Shutdown(ctx context.Context) error {
+	if a.server == nil {
+		return nil
+	}
+	a.Logger.Info("Shutting down manager API")
+	return a.server.Shutdown(ctx)
+}
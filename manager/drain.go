@@ -0,0 +1,217 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/node"
+	"github.com/praaatik/tesseract/task"
+)
+
+// migrationTimeout is how long a replacement Task is given to reach Running during a drain.
+const migrationTimeout = 2 * time.Minute
+
+// Cordon marks the named Node unschedulable so no new Tasks are sent to it.
+func (m *Manager) Cordon(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.node(name)
+	if n == nil {
+		return errdefs.New(errdefs.NotFound, "no node named %s", name)
+	}
+	n.Cordon()
+	return nil
+}
+
+// Uncordon makes the named Node schedulable again.
+func (m *Manager) Uncordon(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.node(name)
+	if n == nil {
+		return errdefs.New(errdefs.NotFound, "no node named %s", name)
+	}
+	if n.Draining {
+		return errdefs.New(errdefs.Conflict, "node %s is being drained", name)
+	}
+	n.Uncordon()
+	return nil
+}
+
+// Drain cordons the named Node and moves its running Tasks to other Nodes.
+// At most budget Tasks are disrupted at a time: a batch is started elsewhere and each original
+// is only stopped once its replacement is Running. Drain returns as soon as the Node is cordoned,
+// the migration carries on in the background.
+func (m *Manager) Drain(name string, budget int) error {
+	if budget < 1 {
+		return errdefs.New(errdefs.InvalidArgument, "disruption budget must be at least 1, got %d", budget)
+	}
+
+	m.mu.Lock()
+	n := m.node(name)
+	if n == nil {
+		m.mu.Unlock()
+		return errdefs.New(errdefs.NotFound, "no node named %s", name)
+	}
+	if n.Draining {
+		m.mu.Unlock()
+		return errdefs.New(errdefs.Conflict, "node %s is already being drained", name)
+	}
+	n.Cordon()
+	n.Draining = true
+
+	// Groups are moved as a whole, so their Tasks are not migrated one by one.
+	migrations := []migration{}
+	for _, t := range m.tasksOnNode(name) {
+		if t.GroupID != uuid.Nil {
+			continue
+		}
+		migrations = append(migrations, migration{
+			what: fmt.Sprintf("task %v", t.ID),
+			run:  func() error { return m.migrateTask(t) },
+		})
+	}
+	for _, g := range m.groupsOnNode(name) {
+		migrations = append(migrations, migration{
+			what: fmt.Sprintf("group %v", g.ID),
+			run:  func() error { return m.migrateGroup(g) },
+		})
+	}
+	m.mu.Unlock()
+
+	go m.drain(n, migrations, budget)
+	return nil
+}
+
+// migration moves one Task or Group off a Node being drained.
+type migration struct {
+	what string
+	run  func() error
+}
+
+func (m *Manager) drain(n *node.Node, migrations []migration, budget int) {
+	m.Logger.Info("Draining %d tasks and groups from node %s with a disruption budget of %d", len(migrations), n.Name, budget)
+
+	failed := 0
+	for start := 0; start < len(migrations); start += budget {
+		end := min(start+budget, len(migrations))
+
+		var wg sync.WaitGroup
+		errs := make([]error, end-start)
+		for i, mig := range migrations[start:end] {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = mig.run()
+			}()
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				failed++
+				m.Logger.Error("Could not migrate %s off node %s: %v", migrations[start+i].what, n.Name, err)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	n.Draining = false
+	m.mu.Unlock()
+
+	if failed > 0 {
+		m.Logger.Warn("Drain of node %s finished with %d tasks or groups left behind", n.Name, failed)
+		return
+	}
+	m.Logger.Info("Drain of node %s finished", n.Name)
+}
+
+// migrateTask starts a copy of t on another Node, waits for it to be Running and then stops t.
+// If the replacement never comes up the original is left running. A replica of a Service is
+// replaced in the Service as soon as its copy is sent, so that reconciliation does not create
+// another one, and takes its place back if the copy fails.
+func (m *Manager) migrateTask(t task.Task) error {
+	replacement := t
+	replacement.ID = uuid.New()
+	replacement.ContainerID = ""
+	replacement.StartTime = time.Time{}
+	replacement.FinishTime = time.Time{}
+	replacement.History = nil
+
+	target, err := m.SelectWorker(replacement)
+	if err != nil {
+		return err
+	}
+
+	te := task.Event{
+		ID:        uuid.New(),
+		State:     task.Scheduled,
+		Timestamp: time.Now().UTC(),
+		Task:      replacement,
+	}
+	if err := m.sendTask(target, te); err != nil {
+		return fmt.Errorf("unable to start replacement on %s: %w", target.Name, err)
+	}
+	m.mu.Lock()
+	replica := m.replaceReplica(t.ID, replacement.ID)
+	m.mu.Unlock()
+
+	if err := m.waitForRunning(target, replacement.ID, migrationTimeout); err != nil {
+		if replica {
+			m.mu.Lock()
+			m.replaceReplica(replacement.ID, t.ID)
+			m.mu.Unlock()
+			m.removeReplica(replacement.ID)
+		}
+		return err
+	}
+
+	m.Logger.Info("Task %v replaced by %v on node %s", t.ID, replacement.ID, target.Name)
+	return m.StopTask(t.ID)
+}
+
+// waitForRunning polls the worker on n until the Task is Running, fails or timeout elapses.
+func (m *Manager) waitForRunning(n *node.Node, id uuid.UUID, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		tasks, err := m.workerTasks(n)
+		if err != nil {
+			m.Logger.Warn("Error getting tasks from worker %s: %v", n.Name, err)
+		}
+		for _, t := range tasks {
+			if t.ID != id {
+				continue
+			}
+			m.updateTask(t)
+			switch t.State {
+			case task.Running:
+				return nil
+			case task.Failed, task.Completed:
+				return fmt.Errorf("task %v ended in state %v on %s", id, t.State, n.Name)
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("task %v was not running on %s after %v", id, n.Name, timeout)
+}
+
+// tasksOnNode returns copies of the Tasks which are running or about to run on the named Node.
+// The caller must hold mu.
+func (m *Manager) tasksOnNode(name string) []task.Task {
+	tasks := []task.Task{}
+	for _, id := range m.WorkerTaskMap[name] {
+		t, ok := m.TaskDb[id]
+		if !ok {
+			continue
+		}
+		if t.State == task.Scheduled || t.State == task.Running {
+			tasks = append(tasks, *t)
+		}
+	}
+	return tasks
+}
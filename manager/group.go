@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/node"
+	"github.com/praaatik/tesseract/task"
+)
+
+// AddGroup queues a Group so that SendWork sends all of its Tasks to the same worker.
+// Missing IDs and names of the Tasks are filled in.
+func (m *Manager) AddGroup(g task.Group) (task.Group, error) {
+	if len(g.Tasks) == 0 {
+		return task.Group{}, errdefs.New(errdefs.InvalidArgument, "group %s has no tasks", g.Name)
+	}
+
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	g.State = task.Pending
+	g.Tasks = prepareMembers(g)
+
+	m.mu.Lock()
+	if _, ok := m.GroupDb[g.ID]; ok {
+		m.mu.Unlock()
+		return task.Group{}, errdefs.New(errdefs.AlreadyExists, "group %v already exists", g.ID)
+	}
+	m.GroupDb[g.ID] = &g
+	for _, t := range g.Tasks {
+		m.TaskDb[t.ID] = &t
+	}
+	m.mu.Unlock()
+
+	m.enqueue(g)
+	m.Logger.Debug("Group %v added to the Pending queue", g.ID)
+	return g, nil
+}
+
+// prepareMembers returns the Tasks of g tied to the Group, with an ID and a name each.
+func prepareMembers(g task.Group) []task.Task {
+	members := []task.Task{}
+	for i, t := range g.Tasks {
+		if t.ID == uuid.Nil {
+			t.ID = uuid.New()
+		}
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("%s-%d", g.Name, i)
+		}
+		t.GroupID = g.ID
+		t.SetState(task.Pending, "Submitted")
+		members = append(members, t)
+	}
+	return members
+}
+
+// GetGroups returns every Group with the current state of each of its Tasks.
+func (m *Manager) GetGroups() []task.Group {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups := []task.Group{}
+	for _, g := range m.GroupDb {
+		groups = append(groups, m.groupStatus(g))
+	}
+	return groups
+}
+
+// GetGroup returns the Group with the current state of each of its Tasks.
+func (m *Manager) GetGroup(id uuid.UUID) (task.Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.GroupDb[id]
+	if !ok {
+		return task.Group{}, errdefs.New(errdefs.NotFound, "no group with ID %v", id)
+	}
+	return m.groupStatus(g), nil
+}
+
+// groupStatus copies g with the Tasks as last reported by the worker. The caller must hold mu.
+func (m *Manager) groupStatus(g *task.Group) task.Group {
+	status := *g
+	status.Tasks = []task.Task{}
+	for _, member := range g.Tasks {
+		if t, ok := m.TaskDb[member.ID]; ok {
+			status.Tasks = append(status.Tasks, *t)
+		}
+	}
+	status.State = task.GroupState(status.Tasks)
+	return status
+}
+
+// sendPendingGroup schedules a Group taken off the Pending queue, putting it back on a transient
+// failure. Its Tasks fail when the worker rejects it.
+func (m *Manager) sendPendingGroup(g task.Group) {
+	m.mu.Lock()
+	_, ok := m.GroupDb[g.ID]
+	m.mu.Unlock()
+	if !ok {
+		m.Logger.Info("Group %v was removed before being scheduled, discarding it", g.ID)
+		return
+	}
+
+	n, err := m.SelectWorker(g.Resources())
+	if err != nil {
+		m.Logger.Warn("Could not schedule group %v: %v", g.ID, err)
+		m.enqueue(g)
+		return
+	}
+
+	if err := m.sendGroup(n, g); err != nil {
+		m.Logger.Error("Error sending group %v to worker %s: %v", g.ID, n.Name, err)
+		if retriable(err) {
+			m.enqueue(g)
+			return
+		}
+		for _, t := range g.Tasks {
+			m.failTask(t.ID, fmt.Sprintf("Group rejected by worker %s: %v", n.Name, err))
+		}
+	}
+}
+
+// sendGroup sends every Task of the Group to the worker running on n in one request.
+func (m *Manager) sendGroup(n *node.Node, g task.Group) error {
+	g.State = task.Scheduled
+	for i := range g.Tasks {
+		g.Tasks[i].SetState(task.Scheduled, fmt.Sprintf("Sent to worker %s", n.Name))
+	}
+
+	// The worker already has the Group when the response to an earlier attempt was lost.
+	if _, err := m.workerClient(n).CreateGroup(context.Background(), g); err != nil && !errdefs.Is(err, errdefs.AlreadyExists) {
+		return workerError(n, err)
+	}
+
+	m.mu.Lock()
+	m.GroupDb[g.ID] = &g
+	m.GroupWorkerMap[g.ID] = n.Name
+	for _, t := range g.Tasks {
+		m.TaskDb[t.ID] = &t
+		m.TaskWorkerMap[t.ID] = n.Name
+		m.WorkerTaskMap[n.Name] = append(m.WorkerTaskMap[n.Name], t.ID)
+	}
+	n.TaskCount += len(g.Tasks)
+	m.mu.Unlock()
+
+	m.Logger.Info("Sent group %v with %d tasks to worker %s", g.ID, len(g.Tasks), n.Name)
+	return nil
+}
+
+// StopGroup asks the worker running the Group to stop all of its Tasks.
+func (m *Manager) StopGroup(id uuid.UUID) error {
+	m.mu.Lock()
+	_, known := m.GroupDb[id]
+	n := m.node(m.GroupWorkerMap[id])
+	m.mu.Unlock()
+
+	if !known {
+		return errdefs.New(errdefs.NotFound, "no group with ID %v", id)
+	}
+	if n == nil {
+		return errdefs.New(errdefs.Conflict, "group %v has not been sent to a worker yet", id)
+	}
+
+	if err := m.workerClient(n).StopGroup(context.Background(), id); err != nil {
+		return workerError(n, err)
+	}
+
+	m.Logger.Info("Requested worker %s to stop group %v", n.Name, id)
+	return nil
+}
+
+// migrateGroup starts a copy of the Group on another Node, waits for all of its Tasks to be Running
+// and then stops the original Group.
+func (m *Manager) migrateGroup(g task.Group) error {
+	replacement := g
+	replacement.ID = uuid.New()
+	replacement.StartTime = time.Time{}
+	replacement.FinishTime = time.Time{}
+	replacement.Tasks = []task.Task{}
+	for _, t := range g.Tasks {
+		t.ID = uuid.New()
+		t.ContainerID = ""
+		t.NetworkMode = ""
+		t.StartTime = time.Time{}
+		t.FinishTime = time.Time{}
+		t.History = nil
+		replacement.Tasks = append(replacement.Tasks, t)
+	}
+	replacement.Tasks = prepareMembers(replacement)
+
+	target, err := m.SelectWorker(replacement.Resources())
+	if err != nil {
+		return err
+	}
+	if err := m.sendGroup(target, replacement); err != nil {
+		return fmt.Errorf("unable to start replacement group on %s: %w", target.Name, err)
+	}
+
+	for _, t := range replacement.Tasks {
+		if err := m.waitForRunning(target, t.ID, migrationTimeout); err != nil {
+			return err
+		}
+	}
+
+	m.Logger.Info("Group %v replaced by %v on node %s", g.ID, replacement.ID, target.Name)
+	return m.StopGroup(g.ID)
+}
+
+// groupsOnNode returns the Groups which are running or about to run on the named Node.
+// The caller must hold mu.
+func (m *Manager) groupsOnNode(name string) []task.Group {
+	groups := []task.Group{}
+	for id, workerName := range m.GroupWorkerMap {
+		g, ok := m.GroupDb[id]
+		if !ok || workerName != name {
+			continue
+		}
+		status := m.groupStatus(g)
+		if status.State == task.Scheduled || status.State == task.Running {
+			groups = append(groups, *g)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,355 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+	"github.com/praaatik/tesseract/tracing"
+)
+
+// StartTaskHandler accepts a task event from a user, normalizes and checks it, and queues it for
+// scheduling. With dryRun=true nothing is queued, the response is a TaskPreview.
+func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	te := task.Event{}
+	err := d.Decode(&te)
+	if err != nil {
+		err := errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err)
+		a.Logger.Error("%v", err)
+		writeError(w, err)
+		return
+	}
+
+	dryRun, err := task.ParseDryRun(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if dryRun {
+		if err := a.Manager.AdmitTask(&te); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(a.Manager.PreviewTask(te.Task))
+		return
+	}
+
+	te.Task.TraceParent = tracing.TraceParent(r.Context())
+	t, err := a.Manager.SubmitTask(te)
+	if err != nil {
+		a.Logger.Warn("Rejected task: %v", err)
+		writeError(w, err)
+		return
+	}
+	a.Logger.Info("Added task %v\n", t.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// GetTasksHandler lists the tasks selected by the query parameters, see task.ParseQuery. When there
+// are more tasks than the limit, the cursor of the next page is in the X-Next-Cursor header.
+func (a *Api) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := task.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tasks, next := q.Apply(a.Manager.GetTasks())
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// GetTaskHandler returns a task with the worker running it, the status of its container and the
+// history of its states.
+func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
+		return
+	}
+
+	detail, ok := a.Manager.GetTask(tID)
+	if !ok {
+		writeError(w, errdefs.New(errdefs.NotFound, "No task with ID %v found", tID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(detail)
+}
+
+// PatchTaskHandler updates a running task with the task.Patch in the body, see Manager.UpdateTask.
+// The task, as it will be once updated, is returned with 202 Accepted.
+func (a *Api) PatchTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
+		return
+	}
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	p := task.Patch{}
+	if err := d.Decode(&p); err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+		return
+	}
+	if err := p.Validate(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	updated, err := a.Manager.UpdateTask(tID, p)
+	if err != nil {
+		a.Logger.Error("Error updating task %v: %v", tID, err)
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		a.Logger.Error("Invalid taskID format: %v\n", err)
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
+		return
+	}
+
+	if err := a.Manager.StopTask(tID); err != nil {
+		a.Logger.Error("Error stopping task %v: %v", tID, err)
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTaskLogsHandler streams the output of the container of a task from the worker running it, selected
+// by the query parameters, see task.ParseLogOptions.
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
+		return
+	}
+	o, err := task.ParseLogOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	logs, err := a.Manager.TaskLogs(r.Context(), tID, o)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(flushWriter{w: w, rc: http.NewResponseController(w)}, logs); err != nil && r.Context().Err() == nil {
+		a.Logger.Warn("Error streaming logs of task %v: %v", tID, err)
+	}
+}
+
+// GetEventsHandler streams the changes of state of the tasks as JSON lines, one task.StateEvent each,
+// until the client goes away. The changes recorded after the optional since query parameter, an RFC 3339
+// timestamp, are sent first, otherwise only the changes to come are. Changes recorded by the workers
+// show up once the Manager has fetched them, see UpdateTasks.
+func (a *Api) GetEventsHandler(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().UTC()
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid since %q, expected an RFC 3339 timestamp", value))
+			return
+		}
+		since = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	watcher := task.NewWatcher(since)
+	ticker := time.NewTicker(eventsInterval)
+	defer ticker.Stop()
+	for {
+		for _, e := range watcher.Changes(a.Manager.GetTasks()) {
+			if err := encoder.Encode(e); err != nil {
+				return
+			}
+		}
+		rc.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Api) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.Manager.GetNodes())
+}
+
+func (a *Api) CordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := a.Manager.Cordon(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) UncordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := a.Manager.Uncordon(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DrainNodeHandler cordons the node and starts moving its tasks elsewhere.
+// The optional budget query parameter caps how many tasks are disrupted at once, defaulting to 1.
+func (a *Api) DrainNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	budget := 1
+	if b := r.URL.Query().Get("budget"); b != "" {
+		parsed, err := strconv.Atoi(b)
+		if err != nil {
+			writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid budget %q: %v", b, err))
+			return
+		}
+		budget = parsed
+	}
+
+	if err := a.Manager.Drain(name, budget); err != nil {
+		a.Logger.Error("Error draining node %s: %v", name, err)
+		writeError(w, err)
+		return
+	}
+
+	a.Logger.Info("Draining node %s", name)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// StartGroupHandler accepts a task group from a user and queues it for scheduling.
+func (a *Api) StartGroupHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	g := task.Group{}
+	if err := d.Decode(&g); err != nil {
+		err := errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err)
+		a.Logger.Error("%v", err)
+		writeError(w, err)
+		return
+	}
+
+	added, err := a.Manager.AddGroup(g)
+	if err != nil {
+		a.Logger.Error("Error adding group: %v", err)
+		writeError(w, err)
+		return
+	}
+
+	a.Logger.Info("Added group %v\n", added.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(added)
+}
+
+func (a *Api) GetGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.Manager.GetGroups())
+}
+
+func (a *Api) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	gID, err := uuid.Parse(r.PathValue("groupID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid groupID format: %v", err))
+		return
+	}
+
+	g, err := a.Manager.GetGroup(gID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(g)
+}
+
+func (a *Api) StopGroupHandler(w http.ResponseWriter, r *http.Request) {
+	gID, err := uuid.Parse(r.PathValue("groupID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid groupID format: %v", err))
+		return
+	}
+
+	if err := a.Manager.StopGroup(gID); err != nil {
+		a.Logger.Error("Error stopping group %v: %v", gID, err)
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// flushWriter flushes every write, so that streamed output reaches the client as it comes.
+type flushWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = f.rc.Flush()
+	}
+	return n, err
+}
+
+// writeError writes err as an ErrResponse, with the HTTP status of its errdefs.Code.
+func writeError(w http.ResponseWriter, err error) {
+	code := errdefs.CodeOf(err)
+	status := errdefs.HTTPStatus(code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	e := ErrResponse{
+		HTTPStatusCode: status,
+		Code:           code,
+		Message:        err.Error(),
+		Fields:         errdefs.FieldsOf(err),
+	}
+	json.NewEncoder(w).Encode(e)
+}
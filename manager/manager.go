@@ -6,47 +6,524 @@
 package manager
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
 	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/client"
+	"github.com/praaatik/tesseract/errdefs"
 	"github.com/praaatik/tesseract/logger"
+	"github.com/praaatik/tesseract/node"
+	"github.com/praaatik/tesseract/scheduler"
 	"github.com/praaatik/tesseract/task"
+	"github.com/praaatik/tesseract/tracing"
 )
 
+// workerTimeout bounds the calls the Manager makes to the workers.
+const workerTimeout = 10 * time.Second
+
 type Manager struct {
 	// Pending is a queue having the Task which are in the pending state of their lifecycle.
-	Pending queue.Queue
+	// It is guarded by pendingMu, see enqueue, dequeue and PendingLen.
+	Pending   *queue.Queue
+	pendingMu sync.Mutex
 
 	// TaskDb stores the tasks
-	TaskDb map[string][]*task.Task
+	TaskDb map[uuid.UUID]*task.Task
 
 	// EventDb stores the events
-	EventDb map[string][]*task.Event
+	EventDb map[uuid.UUID]*task.Event
 
 	// Workers will keep a track of all the workers which are currently running Tasks.
 	Workers []string
 
-	// TODO: check the use of WorkerTaskMap, not entirely sure yet
+	// WorkerNodes holds a Node for every worker, in the same order as Workers.
+	WorkerNodes []*node.Node
+
+	// WorkerTaskMap lists the IDs of the Tasks sent to each worker.
 	WorkerTaskMap map[string][]uuid.UUID
 
-	// TODO: check the use of TaskWorkerMap , not entirely sure yet
+	// TaskWorkerMap points from a Task ID to the worker the Task was sent to.
 	TaskWorkerMap map[uuid.UUID]string
-	Logger        *logger.Logger
+
+	// GroupDb stores the task groups, the state of their Tasks is kept in TaskDb.
+	GroupDb map[uuid.UUID]*task.Group
+
+	// GroupWorkerMap points from a Group ID to the worker the Group was sent to.
+	GroupWorkerMap map[uuid.UUID]string
+
+	// Services holds the replicated Services, keyed by name.
+	Services map[string]*Service
+
+	// Scheduler picks the worker each pending Task is sent to.
+	Scheduler scheduler.Scheduler
+
+	// ProcessInterval, UpdateInterval and ReconcileInterval are the times between two runs of
+	// ProcessTasks, UpdateTasksForever and ReconcileServicesForever, their defaults when left at zero.
+	ProcessInterval   time.Duration
+	UpdateInterval    time.Duration
+	ReconcileInterval time.Duration
+
+	Logger *logger.Logger
+
+	// mu guards the maps and Nodes above, which are shared by the API handlers and the background loops.
+	mu sync.Mutex
 }
 
-func (m *Manager) SelectWorker() {
-	// TODO: Implement worker selection logic
-	m.Logger.Info("Selecting worker for task scheduling")
-	m.Logger.Debug("Worker selection not implemented yet")
+// New creates a Manager for the workers listening on the given addresses (host:port).
+func New(workers []string, logger *logger.Logger) *Manager {
+	nodes := []*node.Node{}
+	workerTaskMap := make(map[string][]uuid.UUID)
+	for _, w := range workers {
+		nodes = append(nodes, node.NewNode(w, w, "worker", logger))
+		workerTaskMap[w] = []uuid.UUID{}
+	}
+
+	return &Manager{
+		Pending:        queue.New(),
+		TaskDb:         make(map[uuid.UUID]*task.Task),
+		EventDb:        make(map[uuid.UUID]*task.Event),
+		Workers:        workers,
+		WorkerNodes:    nodes,
+		WorkerTaskMap:  workerTaskMap,
+		TaskWorkerMap:  make(map[uuid.UUID]string),
+		GroupDb:        make(map[uuid.UUID]*task.Group),
+		GroupWorkerMap: make(map[uuid.UUID]string),
+		Services:       make(map[string]*Service),
+		Scheduler:      &scheduler.RoundRobin{Name: "roundrobin"},
+		Logger:         logger,
+	}
 }
 
-func (m *Manager) UpdateTasks() {
-	// TODO: Implement update tasks logic
-	m.Logger.Info("Updating task states")
-	m.Logger.Debug("Task update not implemented yet")
+// SelectWorker asks the Scheduler for the Node the Task should run on.
+func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	log := m.Logger.Named("scheduler").With("task_id", t.ID)
+	candidates := m.Scheduler.SelectCandidateNodes(t, m.WorkerNodes)
+	if len(candidates) == 0 {
+		return nil, errdefs.New(errdefs.CapacityExceeded, "no schedulable worker available for task %v", t.ID)
+	}
+
+	scores := m.Scheduler.Score(t, candidates)
+	log.Debug("Scores of the %d candidate workers: %v", len(candidates), scores)
+	selected := m.Scheduler.Pick(scores, candidates)
+	log.Debug("Selected worker %s for task %v", selected.Name, t.ID)
+	return selected, nil
+}
+
+// AddTask queues the event so that its Task is sent to a worker by SendWork.
+func (m *Manager) AddTask(te task.Event) {
+	te.Task.SetState(task.Pending, "Submitted")
+	t := te.Task
+	m.mu.Lock()
+	m.TaskDb[t.ID] = &t
+	m.mu.Unlock()
+
+	te.Task.QueuedAt = time.Now()
+	m.enqueue(te)
+	m.Logger.Debug("Task %v added to the Pending queue", te.Task.ID)
+}
+
+func (m *Manager) enqueue(item any) {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	m.Pending.Enqueue(item)
+}
+
+// dequeue takes the next Event or Group off the Pending queue, nil when it is empty.
+func (m *Manager) dequeue() any {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	return m.Pending.Dequeue()
 }
 
+// PendingLen returns the number of Events and Groups waiting in the Pending queue.
+func (m *Manager) PendingLen() int {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	return m.Pending.Len()
+}
+
+// GetTasks returns copies of every Task known to the Manager.
+func (m *Manager) GetTasks() []*task.Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := []*task.Task{}
+	for _, t := range m.TaskDb {
+		copied := *t
+		tasks = append(tasks, &copied)
+	}
+	return tasks
+}
+
+// GetTask returns the Task with the given ID, the worker it was sent to and the status of its
+// container as reported by that worker, or false when the Task is unknown. The state of the Task
+// is refreshed from the worker on the way.
+func (m *Manager) GetTask(id uuid.UUID) (*task.Detail, bool) {
+	m.mu.Lock()
+	t, ok := m.TaskDb[id]
+	workerName := m.TaskWorkerMap[id]
+	n := m.node(workerName)
+	m.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	detail := &task.Detail{Node: workerName}
+	if n != nil {
+		wd, err := m.workerTask(n, id)
+		if err != nil {
+			detail.ContainerError = fmt.Sprintf("Error getting the task from worker %s: %v", n.Name, err)
+		} else {
+			m.updateTask(wd.Task)
+			detail.Container = wd.Container
+			detail.ContainerError = wd.ContainerError
+		}
+	}
+
+	m.mu.Lock()
+	copied := *t
+	m.mu.Unlock()
+	detail.Task = &copied
+	return detail, true
+}
+
+// workerTask fetches a Task and the status of its container from the worker running on n.
+func (m *Manager) workerTask(n *node.Node, id uuid.UUID) (*task.Detail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	detail, err := m.workerClient(n).GetTask(ctx, id)
+	if err != nil {
+		return nil, workerError(n, err)
+	}
+	return detail, nil
+}
+
+// GetNodes returns copies of the Nodes of every worker.
+func (m *Manager) GetNodes() []*node.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := []*node.Node{}
+	for _, n := range m.WorkerNodes {
+		copied := *n
+		nodes = append(nodes, &copied)
+	}
+	return nodes
+}
+
+// SendWork takes the next event off the Pending queue and sends its Task to a worker.
 func (m *Manager) SendWork() {
-	// TODO: Implement work distribution logic
-	m.Logger.Info("Sending work to workers")
-	m.Logger.Debug("Work sending not implemented yet")
+	item := m.dequeue()
+	if item == nil {
+		m.Logger.Info("No work in the queue")
+		return
+	}
+	if g, ok := item.(task.Group); ok {
+		m.sendPendingGroup(g)
+		return
+	}
+
+	te := item.(task.Event)
+	t := te.Task
+
+	m.mu.Lock()
+	_, ok := m.TaskDb[t.ID]
+	m.mu.Unlock()
+	if !ok {
+		m.Logger.Info("Task %v was removed before being scheduled, discarding it", t.ID)
+		return
+	}
+
+	ctx := tracing.ContextWithTraceParent(context.Background(), t.TraceParent)
+	ctx, queued := tracing.Default.Start(ctx, "manager.queue", tracing.WithStartTime(t.QueuedAt),
+		tracing.WithAttributes("task_id", t.ID.String()))
+	queued.End()
+
+	// Scheduling follows the wait in the queue, as its child.
+	ctx, span := tracing.Default.Start(ctx, "manager.schedule", tracing.WithAttributes("task_id", t.ID.String()))
+	defer span.End()
+
+	// On a transient failure the Task goes back on the queue, where its wait starts over.
+	requeued := te
+	requeued.Task.QueuedAt = time.Now()
+
+	n, err := m.SelectWorker(t)
+	if err != nil {
+		m.Logger.Warn("Could not schedule task %v: %v", t.ID, err)
+		span.RecordError(err)
+		m.enqueue(requeued)
+		return
+	}
+	span.SetAttributes("worker", n.Name)
+
+	// The request to the worker is traced as a child of the scheduling span.
+	te.Task.TraceParent = tracing.TraceParent(ctx)
+	if err := m.sendTask(n, te); err != nil {
+		m.Logger.Error("Error sending task %v to worker %s: %v", t.ID, n.Name, err)
+		span.RecordError(err)
+		if retriable(err) {
+			m.enqueue(requeued)
+			return
+		}
+		m.failTask(t.ID, fmt.Sprintf("Rejected by worker %s: %v", n.Name, err))
+	}
+}
+
+// retriable reports whether sending a Task or Group to a worker failed because the worker could
+// not take it at the time, rather than because it rejected it.
+func retriable(err error) bool {
+	return errdefs.Is(err, errdefs.Unavailable) || errdefs.Is(err, errdefs.WorkerUnavailable)
+}
+
+// failTask marks a Task which could not be sent to a worker as Failed.
+func (m *Manager) failTask(id uuid.UUID, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.TaskDb[id]; ok {
+		t.FinishTime = time.Now().UTC()
+		t.SetState(task.Failed, reason)
+	}
+}
+
+// sendTask marks the Task as Scheduled and sends it to the worker running on n.
+func (m *Manager) sendTask(n *node.Node, te task.Event) error {
+	te.State = task.Scheduled
+	te.Task.SetState(task.Scheduled, fmt.Sprintf("Sent to worker %s", n.Name))
+	te.Timestamp = time.Now().UTC()
+
+	ctx := tracing.ContextWithTraceParent(context.Background(), te.Task.TraceParent)
+	ctx, span := tracing.Default.Start(ctx, "POST /tasks", tracing.WithKind(tracing.KindClient),
+		tracing.WithAttributes("task_id", te.Task.ID.String(), "worker", n.Name))
+	defer span.End()
+
+	// The client sends the trace context of ctx along with the request.
+	// The worker already has the Task when the response to an earlier attempt was lost.
+	if _, err := m.workerClient(n).SendEvent(ctx, te); err != nil && !errdefs.Is(err, errdefs.AlreadyExists) {
+		span.RecordError(err)
+		return workerError(n, err)
+	}
+
+	t := te.Task
+	m.mu.Lock()
+	m.TaskDb[t.ID] = &t
+	m.EventDb[te.ID] = &te
+	m.TaskWorkerMap[t.ID] = n.Name
+	m.WorkerTaskMap[n.Name] = append(m.WorkerTaskMap[n.Name], t.ID)
+	n.TaskCount++
+	m.mu.Unlock()
+
+	m.Logger.With("task_id", t.ID, "worker", n.Name).Info("Sent task %v to worker %s", t.ID, n.Name)
+	return nil
+}
+
+// TaskLogs streams the output of the container of a Task from the worker running it, see
+// client.Client.Logs. The stream is bound by ctx.
+func (m *Manager) TaskLogs(ctx context.Context, id uuid.UUID, o task.LogOptions) (io.ReadCloser, error) {
+	n, err := m.taskNode(id)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := m.workerClient(n).Logs(ctx, id, o)
+	if err != nil {
+		return nil, workerError(n, err)
+	}
+	return logs, nil
+}
+
+// UpdateTask sends a patch of a running Task to the worker running it and records the spec the
+// worker accepted. The worker applies it in the background, replacing the container if needed.
+func (m *Manager) UpdateTask(id uuid.UUID, p task.Patch) (*task.Task, error) {
+	n, err := m.taskNode(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := m.workerClient(n).UpdateTask(context.Background(), id, p)
+	if err != nil {
+		return nil, workerError(n, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	known, ok := m.TaskDb[id]
+	if !ok {
+		return nil, errdefs.New(errdefs.NotFound, "task %v is no longer known", id)
+	}
+	copySpec(known, updated)
+	copied := *known
+
+	m.Logger.With("task_id", id, "worker", n.Name).Info("Requested worker %s to update task %v", n.Name, id)
+	return &copied, nil
+}
+
+// copySpec copies the part of the spec of a Task which can be updated from src to dst.
+func copySpec(dst *task.Task, src *task.Task) {
+	dst.Image = src.Image
+	dst.Env = src.Env
+	dst.Cmd = src.Cmd
+	dst.Memory = src.Memory
+	dst.Cpu = src.Cpu
+	dst.RestartPolicy = src.RestartPolicy
+	dst.Labels = src.Labels
+	dst.Revision = src.Revision
+}
+
+// StopTask asks the worker running the Task to stop it.
+func (m *Manager) StopTask(id uuid.UUID) error {
+	n, err := m.taskNode(id)
+	if err != nil {
+		return err
+	}
+
+	if err := m.workerClient(n).StopTask(context.Background(), id); err != nil {
+		return workerError(n, err)
+	}
+
+	m.Logger.With("task_id", id, "worker", n.Name).Info("Requested worker %s to stop task %v", n.Name, id)
+	return nil
+}
+
+// UpdateTasks asks every worker for its Tasks and copies their state into TaskDb.
+func (m *Manager) UpdateTasks() {
+	for _, n := range m.GetNodes() {
+		m.Logger.Debug("Checking worker %s for task updates", n.Name)
+
+		tasks, err := m.workerTasks(n)
+		if err != nil {
+			m.Logger.Error("Error getting tasks from worker %s: %v", n.Name, err)
+			continue
+		}
+
+		running := 0
+		for _, t := range tasks {
+			if t.State == task.Running {
+				running++
+			}
+			m.updateTask(t)
+		}
+
+		m.mu.Lock()
+		if live := m.node(n.Name); live != nil {
+			live.TaskCount = running
+		}
+		m.mu.Unlock()
+	}
+}
+
+// updateTask copies the state reported by a worker into TaskDb, and its spec unless it is of an
+// older Revision than the known one.
+func (m *Manager) updateTask(t *task.Task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	known, ok := m.TaskDb[t.ID]
+	if !ok {
+		m.Logger.Warn("Worker reported unknown task %v", t.ID)
+		return
+	}
+	if known.State != t.State {
+		m.Logger.Debug("Task %v changed state from %v to %v", t.ID, known.State, t.State)
+	}
+	known.State = t.State
+	// A replacing update bumps the Revision right away, while the worker only reports it once the
+	// update has been applied: an older spec is the one the update is about to replace.
+	if t.Revision >= known.Revision {
+		copySpec(known, t)
+	}
+	if len(t.History) > 0 {
+		known.History = t.History
+	}
+	known.StartTime = t.StartTime
+	known.FinishTime = t.FinishTime
+	known.ContainerID = t.ContainerID
+	known.Health = t.Health
+}
+
+// workerTasks fetches the Tasks the worker running on n knows about.
+func (m *Manager) workerTasks(n *node.Node) ([]*task.Task, error) {
+	tasks, _, err := m.workerClient(n).ListTasks(context.Background(), task.Query{})
+	if err != nil {
+		return nil, workerError(n, err)
+	}
+	return tasks, nil
+}
+
+// ProcessTasks sends pending work to the workers every ProcessInterval, 10 seconds by default.
+func (m *Manager) ProcessTasks() {
+	interval := orDefault(m.ProcessInterval, 10*time.Second)
+	for {
+		m.Logger.Debug("Processing any tasks in the queue")
+		m.SendWork()
+		time.Sleep(interval)
+	}
+}
+
+// UpdateTasksForever refreshes the Task states from the workers every UpdateInterval, 15 seconds by default.
+func (m *Manager) UpdateTasksForever() {
+	interval := orDefault(m.UpdateInterval, 15*time.Second)
+	for {
+		m.Logger.Debug("Checking for task updates from workers")
+		m.UpdateTasks()
+		time.Sleep(interval)
+	}
+}
+
+// orDefault is interval, or def when it is not positive.
+func orDefault(interval time.Duration, def time.Duration) time.Duration {
+	if interval <= 0 {
+		return def
+	}
+	return interval
+}
+
+// taskNode returns the Node the Task was sent to. It fails with errdefs.NotFound for unknown Tasks
+// and errdefs.Conflict for Tasks still waiting to be scheduled.
+func (m *Manager) taskNode(id uuid.UUID) (*node.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.TaskDb[id]; !ok {
+		return nil, errdefs.New(errdefs.NotFound, "no task with ID %v", id)
+	}
+	n := m.node(m.TaskWorkerMap[id])
+	if n == nil {
+		return nil, errdefs.New(errdefs.Conflict, "task %v has not been sent to a worker yet", id)
+	}
+	return n, nil
+}
+
+// node returns the Node with the given name, the caller must hold mu.
+func (m *Manager) node(name string) *node.Node {
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// workerClient returns a client of the worker API running on n.
+func (m *Manager) workerClient(n *node.Node) *client.Client {
+	c := client.New(n.Api)
+	c.Timeout = workerTimeout
+	return c
+}
+
+// workerError describes a failed call to the worker running on n. Calls which got no response are
+// errdefs.WorkerUnavailable, the others keep the errdefs.Code the worker reported.
+func workerError(n *node.Node, err error) error {
+	if client.IsUnreachable(err) {
+		return errdefs.New(errdefs.WorkerUnavailable, "worker %s: %w", n.Name, err)
+	}
+	return err
 }
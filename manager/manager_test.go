@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/logger"
+	"github.com/praaatik/tesseract/task"
+)
+
+func TestUpdateTask(t *testing.T) {
+	tests := []struct {
+		name      string
+		known     task.Task
+		reported  task.Task
+		wantImage string
+	}{
+		{
+			name:      "same revision",
+			known:     task.Task{Image: "nginx:1.26", Revision: 1, State: task.Scheduled},
+			reported:  task.Task{Image: "nginx:1.27", Revision: 1, State: task.Running},
+			wantImage: "nginx:1.27",
+		},
+		{
+			name:      "newer revision",
+			known:     task.Task{Image: "nginx:1.26", Revision: 1, State: task.Running},
+			reported:  task.Task{Image: "nginx:1.27", Revision: 2, State: task.Running},
+			wantImage: "nginx:1.27",
+		},
+		{
+			// The replacement was requested, the worker still runs the previous spec.
+			name:      "older revision",
+			known:     task.Task{Image: "nginx:1.27", Revision: 2, State: task.Running},
+			reported:  task.Task{Image: "nginx:1.26", Revision: 1, State: task.Running, Health: "healthy"},
+			wantImage: "nginx:1.27",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(nil, logger.NewWithSinks("manager", logger.NewLevels(logger.ERROR), logger.NewSink(io.Discard, logger.DEBUG, logger.TEXT)))
+			id := uuid.New()
+			known, reported := tt.known, tt.reported
+			known.ID, reported.ID = id, id
+			m.TaskDb[id] = &known
+
+			m.updateTask(&reported)
+
+			got := m.TaskDb[id]
+			if got.Image != tt.wantImage {
+				t.Errorf("Image = %q, want %q", got.Image, tt.wantImage)
+			}
+			if got.Revision < tt.reported.Revision {
+				t.Errorf("Revision = %d, want at least the reported %d", got.Revision, tt.reported.Revision)
+			}
+			// The state is taken whatever the revision.
+			if got.State != tt.reported.State || got.Health != tt.reported.Health {
+				t.Errorf("State, Health = %v, %q, want %v, %q", got.State, got.Health, tt.reported.State, tt.reported.Health)
+			}
+		})
+	}
+}
+
+func TestPendingConcurrent(t *testing.T) {
+	// Without workers, SendWork puts every Task it takes back on the queue.
+	m := New(nil, logger.NewWithSinks("manager", logger.NewLevels(logger.ERROR), logger.NewSink(io.Discard, logger.DEBUG, logger.TEXT)))
+	const tasks = 50
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range tasks {
+			m.AddTask(task.Event{ID: uuid.New(), Task: task.Task{ID: uuid.New(), Image: "nginx"}})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range tasks {
+			m.SendWork()
+		}
+	}()
+	wg.Wait()
+
+	if n := m.PendingLen(); n != tasks {
+		t.Errorf("PendingLen() = %d, want %d", n, tasks)
+	}
+}
+
+func TestGetTasksAndNodesCopies(t *testing.T) {
+	m := New([]string{"localhost:5555"}, logger.NewWithSinks("manager", logger.NewLevels(logger.ERROR), logger.NewSink(io.Discard, logger.DEBUG, logger.TEXT)))
+	id := uuid.New()
+	m.TaskDb[id] = &task.Task{ID: id, State: task.Running}
+
+	m.GetTasks()[0].State = task.Failed
+	if got := m.TaskDb[id].State; got != task.Running {
+		t.Errorf("TaskDb state = %v after changing the result of GetTasks(), want %v", got, task.Running)
+	}
+	m.GetNodes()[0].TaskCount = 3
+	if got := m.WorkerNodes[0].TaskCount; got != 0 {
+		t.Errorf("TaskCount = %d after changing the result of GetNodes(), want 0", got)
+	}
+}
+
+func TestSendWorkRejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		code        errdefs.Code
+		wantPending int
+		wantState   task.State
+	}{
+		{name: "rejected", status: http.StatusBadRequest, code: errdefs.InvalidArgument, wantPending: 0, wantState: task.Failed},
+		{name: "worker unavailable", status: http.StatusServiceUnavailable, code: errdefs.Unavailable, wantPending: 1, wantState: task.Pending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(map[string]any{"HTTPStatusCode": tt.status, "Code": tt.code, "Message": "no"})
+			}))
+			defer worker.Close()
+
+			m := New([]string{strings.TrimPrefix(worker.URL, "http://")}, logger.NewWithSinks("manager", logger.NewLevels(logger.ERROR), logger.NewSink(io.Discard, logger.DEBUG, logger.TEXT)))
+			id := uuid.New()
+			m.AddTask(task.Event{ID: uuid.New(), Task: task.Task{ID: id, Image: "nginx"}})
+			m.SendWork()
+
+			if n := m.PendingLen(); n != tt.wantPending {
+				t.Errorf("PendingLen() = %d, want %d", n, tt.wantPending)
+			}
+			if got := m.TaskDb[id].State; got != tt.wantState {
+				t.Errorf("State = %v, want %v", got, tt.wantState)
+			}
+		})
+	}
+}
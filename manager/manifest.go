@@ -0,0 +1,169 @@
+package manager
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "github.com/praaatik/tesseract/api/v1"
+	"github.com/praaatik/tesseract/task"
+)
+
+// liveStates are the States of the Tasks a manifest is matched with, the others are over.
+var liveStates = []task.State{task.Pending, task.Scheduled, task.Running}
+
+// manifestStep is what applying a manifest does to one of its Tasks.
+type manifestStep struct {
+	change  v1.ManifestChange
+	current *task.Task
+	desired task.Task
+	patch   task.Patch
+}
+
+// PlanManifest returns what ApplyManifest would do to each of the desired Tasks, in their order.
+func (m *Manager) PlanManifest(desired []task.Task) []v1.ManifestChange {
+	return changes(m.planManifest(desired))
+}
+
+// ApplyManifest makes one Task of the name of each desired Task run with its spec: it creates the
+// Tasks missing, patches the ones whose changes can be patched and replaces the others. A failure is
+// recorded in the change of its Task, the others are still acted upon.
+func (m *Manager) ApplyManifest(desired []task.Task) []v1.ManifestChange {
+	steps := m.planManifest(desired)
+	for i := range steps {
+		s := &steps[i]
+		log := m.Logger.With("task_name", s.change.Name)
+
+		switch s.change.Action {
+		case v1.ActionCreate:
+			id := m.addManifestTask(s.desired)
+			s.change.NewTaskID = &id
+			log.Info("Created task %v for %s", id, s.change.Name)
+		case v1.ActionUpdate:
+			if _, err := m.UpdateTask(s.current.ID, s.patch); err != nil {
+				s.change.Error = err.Error()
+				continue
+			}
+			log.Info("Updated task %v for %s", s.current.ID, s.change.Name)
+		case v1.ActionReplace:
+			if err := m.removeTask(s.current.ID); err != nil {
+				s.change.Error = err.Error()
+				continue
+			}
+			s.desired.Revision = s.current.Revision + 1
+			id := m.addManifestTask(s.desired)
+			s.change.NewTaskID = &id
+			log.Info("Replaced task %v by %v for %s", s.current.ID, id, s.change.Name)
+		}
+	}
+	return changes(steps)
+}
+
+// DeleteManifest stops the Tasks of the given names, unless dryRun is set. A failure is recorded in
+// the change of its Task, the others are still stopped.
+func (m *Manager) DeleteManifest(names []string, dryRun bool) []v1.ManifestChange {
+	m.mu.Lock()
+	live := map[string][]*task.Task{}
+	for _, name := range names {
+		live[name] = m.liveTasks(name)
+	}
+	m.mu.Unlock()
+
+	all := []v1.ManifestChange{}
+	for _, name := range names {
+		if len(live[name]) == 0 {
+			all = append(all, v1.ManifestChange{Name: name, Action: v1.ActionAbsent})
+			continue
+		}
+		// Every running Task of the name goes, including the ones left over by earlier replacements.
+		for _, t := range live[name] {
+			id := t.ID
+			change := v1.ManifestChange{Name: name, Action: v1.ActionDelete, TaskID: &id}
+			if !dryRun {
+				if err := m.removeTask(id); err != nil {
+					change.Error = err.Error()
+				} else {
+					m.Logger.With("task_name", name).Info("Stopped task %v of %s", id, name)
+				}
+			}
+			all = append(all, change)
+		}
+	}
+	return all
+}
+
+func (m *Manager) planManifest(desired []task.Task) []manifestStep {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	steps := []manifestStep{}
+	for _, d := range desired {
+		s := manifestStep{change: v1.ManifestChange{Name: d.Name}, desired: d}
+		live := m.liveTasks(d.Name)
+		if len(live) == 0 {
+			s.change.Action = v1.ActionCreate
+			steps = append(steps, s)
+			continue
+		}
+
+		s.current = live[0]
+		id := s.current.ID
+		s.change.TaskID = &id
+		diff := task.Diff(s.current, &s.desired)
+		s.change.Changes = v1.FromFieldChanges(diff)
+
+		patch, patchable := task.PatchFor(s.current, &s.desired)
+		switch {
+		case len(diff) == 0:
+			s.change.Action = v1.ActionUnchanged
+		case patchable && s.current.State != task.Pending:
+			s.change.Action = v1.ActionUpdate
+			s.patch = patch
+		default:
+			// A Pending Task has no worker to patch it yet, it is dropped from the queue instead.
+			s.change.Action = v1.ActionReplace
+		}
+		steps = append(steps, s)
+	}
+	return steps
+}
+
+// liveTasks returns copies of the Tasks named name which are not over, the last submitted first.
+// The caller holds m.mu.
+func (m *Manager) liveTasks(name string) []*task.Task {
+	live := []*task.Task{}
+	for _, t := range m.TaskDb {
+		if t.Name == name && task.Contains(liveStates, t.State) {
+			copied := *t
+			live = append(live, &copied)
+		}
+	}
+	slices.SortFunc(live, func(a, b *task.Task) int {
+		return submitted(b).Compare(submitted(a))
+	})
+	return live
+}
+
+// submitted is when the Task was submitted, the time of the first entry of its History.
+func submitted(t *task.Task) time.Time {
+	if len(t.History) == 0 {
+		return time.Time{}
+	}
+	return t.History[0].Time
+}
+
+// addManifestTask queues a new Task with the spec of t and returns its ID.
+func (m *Manager) addManifestTask(t task.Task) uuid.UUID {
+	t.ID = uuid.New()
+	t.State = task.Pending
+	m.AddTask(task.Event{ID: uuid.New(), State: task.Scheduled, Timestamp: time.Now().UTC(), Task: t})
+	return t.ID
+}
+
+func changes(steps []manifestStep) []v1.ManifestChange {
+	all := []v1.ManifestChange{}
+	for _, s := range steps {
+		all = append(all, s.change)
+	}
+	return all
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+
+	v1 "github.com/praaatik/tesseract/api/v1"
+	"github.com/praaatik/tesseract/task"
+)
+
+// ApplyManifestHandler makes the running tasks match the manifest of the body and returns what was
+// done to each of its tasks. With dryRun=true it only returns what would be done.
+func (a *Api) ApplyManifestHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := task.ParseDryRun(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	tasks, _, ok := a.decodeManifest(w, r)
+	if !ok {
+		return
+	}
+
+	if dryRun {
+		writeChanges(w, a.Manager.PlanManifest(tasks))
+		return
+	}
+	writeChanges(w, a.Manager.ApplyManifest(tasks))
+}
+
+// DiffManifestHandler returns what applying the manifest of the body would do, with the fields of
+// the running tasks which differ.
+func (a *Api) DiffManifestHandler(w http.ResponseWriter, r *http.Request) {
+	tasks, _, ok := a.decodeManifest(w, r)
+	if !ok {
+		return
+	}
+	writeChanges(w, a.Manager.PlanManifest(tasks))
+}
+
+// DeleteManifestHandler stops the running tasks named in the manifest of the body. With dryRun=true
+// it only returns the tasks which would be stopped.
+func (a *Api) DeleteManifestHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := task.ParseDryRun(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	_, m, ok := a.decodeManifest(w, r)
+	if !ok {
+		return
+	}
+	writeChanges(w, a.Manager.DeleteManifest(m.Names(), dryRun))
+}
+
+// decodeManifest reads and checks the manifest of the body, writing the error response when it is invalid.
+func (a *Api) decodeManifest(w http.ResponseWriter, r *http.Request) ([]task.Task, v1.Manifest, bool) {
+	m, err := v1.DecodeManifest(r.Body)
+	if err == nil {
+		var tasks []task.Task
+		if tasks, err = m.ToTasks(); err == nil {
+			return tasks, m, true
+		}
+	}
+	a.Logger.Error("%v", err)
+	writeError(w, err)
+	return nil, v1.Manifest{}, false
+}
+
+func writeChanges(w http.ResponseWriter, changes []v1.ManifestChange) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(changes)
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"strconv"
+
+	"github.com/praaatik/tesseract/metrics"
+	"github.com/praaatik/tesseract/task"
+)
+
+// registerMetrics adds the gauges read from the Manager at scrape time to the registry.
+func (m *Manager) registerMetrics(r *metrics.Registry) error {
+	return r.Register(
+		metrics.NewGaugeFunc("tesseract_manager_tasks", "Number of tasks known to the manager, by state.",
+			[]string{"state"}, m.taskStateSamples),
+		metrics.NewGaugeFunc("tesseract_manager_pending_queue_depth", "Number of tasks and groups waiting to be scheduled.",
+			nil, func() []metrics.Sample {
+				return []metrics.Sample{{Value: float64(m.PendingLen())}}
+			}),
+		metrics.NewGaugeFunc("tesseract_manager_nodes", "Number of worker nodes, by schedulable status.",
+			[]string{"schedulable"}, m.nodeSamples),
+		metrics.NewGaugeFunc("tesseract_manager_service_replicas", "Replicas of each service, desired and running.",
+			[]string{"service", "kind"}, m.serviceSamples),
+	)
+}
+
+func (m *Manager) taskStateSamples() []metrics.Sample {
+	m.mu.Lock()
+	counts := make(map[task.State]int)
+	for _, t := range m.TaskDb {
+		counts[t.State]++
+	}
+	m.mu.Unlock()
+
+	samples := []metrics.Sample{}
+	for _, s := range task.States {
+		samples = append(samples, metrics.Sample{LabelValues: []string{s.String()}, Value: float64(counts[s])})
+	}
+	return samples
+}
+
+func (m *Manager) nodeSamples() []metrics.Sample {
+	counts := make(map[bool]int)
+	for _, n := range m.GetNodes() {
+		counts[n.Schedulable()]++
+	}
+	return []metrics.Sample{
+		{LabelValues: []string{strconv.FormatBool(true)}, Value: float64(counts[true])},
+		{LabelValues: []string{strconv.FormatBool(false)}, Value: float64(counts[false])},
+	}
+}
+
+func (m *Manager) serviceSamples() []metrics.Sample {
+	samples := []metrics.Sample{}
+	for _, s := range m.GetServices() {
+		samples = append(samples,
+			metrics.Sample{LabelValues: []string{s.Name, "desired"}, Value: float64(s.Replicas)},
+			metrics.Sample{LabelValues: []string{s.Name, "running"}, Value: float64(s.RunningReplicas)},
+		)
+	}
+	return samples
+}
@@ -0,0 +1,363 @@
+package manager
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+// revisionHistoryLimit is the number of previous templates kept per Service.
+const revisionHistoryLimit = 10
+
+// UpdateState is the progress of the last rolling update of a Service.
+type UpdateState string
+
+const (
+	// UpdateInProgress means replicas are being replaced with the new template.
+	UpdateInProgress UpdateState = "updating"
+
+	// UpdateRollingBack means a failed update is being reverted to the previous template.
+	UpdateRollingBack UpdateState = "rolling_back"
+
+	// UpdatePaused means the update stopped on a failure and waits for the user.
+	// The replica count of a paused Service is not reconciled.
+	UpdatePaused UpdateState = "paused"
+
+	// UpdateCompleted means every replica runs the current template.
+	UpdateCompleted UpdateState = "completed"
+
+	// UpdateRolledBack means a rollback finished and every replica runs the restored template.
+	UpdateRolledBack UpdateState = "rolled_back"
+)
+
+// FailureAction values tell a rolling update what to do when a new replica does not come up.
+const (
+	FailurePause    = "pause"
+	FailureRollback = "rollback"
+)
+
+// UpdateConfig controls how a rolling update replaces the replicas of a Service.
+type UpdateConfig struct {
+	// MaxSurge is how many replicas may run above the desired count during the update.
+	MaxSurge int
+
+	// MaxUnavailable is how many replicas may be stopped before their replacement is running.
+	MaxUnavailable int
+
+	// MonitorTimeout is how long a new replica is given to become Running (and healthy).
+	MonitorTimeout time.Duration
+
+	// FailureAction is either "pause" or "rollback".
+	FailureAction string
+}
+
+// UpdateStatus describes the last rolling update of a Service.
+type UpdateStatus struct {
+	State       UpdateState
+	StartedAt   time.Time
+	CompletedAt time.Time
+	Message     string
+}
+
+// ServiceRevision is a template a Service used to run.
+type ServiceRevision struct {
+	Revision  int
+	Template  task.Task
+	CreatedAt time.Time
+}
+
+// withDefaults fills in the zero fields: one replica of surge, two minutes to come up and pausing on failure.
+func (c UpdateConfig) withDefaults() UpdateConfig {
+	if c.MaxSurge == 0 && c.MaxUnavailable == 0 {
+		c.MaxSurge = 1
+	}
+	if c.MonitorTimeout == 0 {
+		c.MonitorTimeout = 2 * time.Minute
+	}
+	if c.FailureAction == "" {
+		c.FailureAction = FailurePause
+	}
+	return c
+}
+
+func (c UpdateConfig) validate() error {
+	if c.MaxSurge < 0 || c.MaxUnavailable < 0 {
+		return errdefs.New(errdefs.InvalidArgument, "max surge and max unavailable must not be negative")
+	}
+	if c.FailureAction != FailurePause && c.FailureAction != FailureRollback {
+		return errdefs.New(errdefs.InvalidArgument, "unknown failure action %q", c.FailureAction)
+	}
+	return nil
+}
+
+// UpdateService starts a rolling update of the named Service to a new template.
+// The current template is kept in the revision history so it can be rolled back to.
+// A nil config keeps the update config of the Service.
+func (m *Manager) UpdateService(name string, template task.Task, config *UpdateConfig) error {
+	if err := checkTemplate(&template); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.Services[name]
+	if !ok {
+		return errdefs.New(errdefs.NotFound, "no service named %s", name)
+	}
+	if s.updateRunning() {
+		return errdefs.New(errdefs.Conflict, "service %s is already being updated", name)
+	}
+
+	if config != nil {
+		c := config.withDefaults()
+		if err := c.validate(); err != nil {
+			return err
+		}
+		s.UpdateConfig = c
+	}
+
+	s.setTemplate(template)
+	s.UpdateStatus = UpdateStatus{State: UpdateInProgress, StartedAt: time.Now().UTC()}
+	m.Logger.Info("Rolling update of service %s to revision %d started", name, s.Revision)
+
+	go m.rollingUpdate(name)
+	return nil
+}
+
+// RollbackService rolls the named Service back to a previous revision, or to the latest one in
+// its history when revision is 0. The rollback is a rolling update which pauses on failure.
+func (m *Manager) RollbackService(name string, revision int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.Services[name]
+	if !ok {
+		return errdefs.New(errdefs.NotFound, "no service named %s", name)
+	}
+	if s.updateRunning() {
+		return errdefs.New(errdefs.Conflict, "service %s is being updated", name)
+	}
+
+	if err := s.rollback(revision); err != nil {
+		return err
+	}
+	m.Logger.Info("Rollback of service %s to revision %d started", name, s.Revision)
+
+	go m.rollingUpdate(name)
+	return nil
+}
+
+// rollingUpdate replaces the replicas of the named Service which run an older revision, in batches
+// of MaxSurge+MaxUnavailable. Up to MaxUnavailable old replicas of a batch are stopped straight away,
+// the rest only once every new replica of the batch is Running and healthy.
+func (m *Manager) rollingUpdate(name string) {
+	for {
+		m.mu.Lock()
+		s, ok := m.Services[name]
+		if !ok || !s.updateRunning() {
+			m.mu.Unlock()
+			return
+		}
+
+		outdated := m.outdatedReplicas(s)
+		if len(outdated) == 0 {
+			s.finishUpdate()
+			m.Logger.Info("Update of service %s finished, all replicas run revision %d", name, s.Revision)
+			m.mu.Unlock()
+			return
+		}
+
+		c := s.UpdateConfig
+		batch := outdated[:min(c.MaxSurge+c.MaxUnavailable, len(outdated))]
+		early := batch[:min(c.MaxUnavailable, len(batch))]
+		late := batch[len(early):]
+
+		replacements := []task.Task{}
+		for range batch {
+			t := s.newReplica()
+			replacements = append(replacements, t)
+			s.Tasks = append(s.Tasks, t.ID)
+		}
+		s.dropTasks(early)
+		m.mu.Unlock()
+
+		for _, id := range early {
+			m.removeReplica(id)
+		}
+
+		ids := []uuid.UUID{}
+		for _, t := range replacements {
+			ids = append(ids, t.ID)
+			m.AddTask(task.Event{
+				ID:        uuid.New(),
+				State:     task.Pending,
+				Timestamp: time.Now().UTC(),
+				Task:      t,
+			})
+		}
+
+		if err := m.waitForReplicas(ids, c.MonitorTimeout); err != nil {
+			m.failUpdate(name, err)
+			return
+		}
+
+		m.mu.Lock()
+		s.dropTasks(late)
+		m.mu.Unlock()
+
+		for _, id := range late {
+			m.removeReplica(id)
+		}
+	}
+}
+
+// failUpdate pauses the update of the named Service or, if configured, rolls it back.
+func (m *Manager) failUpdate(name string, cause error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.Services[name]
+	if !ok {
+		return
+	}
+
+	m.Logger.Error("Update of service %s to revision %d failed: %v", name, s.Revision, cause)
+
+	if s.UpdateStatus.State == UpdateInProgress && s.UpdateConfig.FailureAction == FailureRollback && len(s.History) > 0 {
+		if err := s.rollback(0); err == nil {
+			s.UpdateStatus.Message = fmt.Sprintf("rolling back after failure: %v", cause)
+			m.Logger.Info("Rolling back service %s to revision %d", name, s.Revision)
+			go m.rollingUpdate(name)
+			return
+		}
+	}
+
+	s.UpdateStatus.State = UpdatePaused
+	s.UpdateStatus.Message = cause.Error()
+}
+
+// waitForReplicas refreshes the Task states until every Task is Running and, if it has a health
+// check, healthy. It fails as soon as one of them fails, turns unhealthy or timeout elapses.
+func (m *Manager) waitForReplicas(ids []uuid.UUID, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(2 * time.Second)
+		m.UpdateTasks()
+
+		ready := 0
+		m.mu.Lock()
+		for _, id := range ids {
+			t, ok := m.TaskDb[id]
+			if !ok {
+				continue
+			}
+			switch {
+			case t.State == task.Failed || t.State == task.Completed:
+				m.mu.Unlock()
+				return fmt.Errorf("replica %v ended in state %v", id, t.State)
+			case t.Health == "unhealthy":
+				m.mu.Unlock()
+				return fmt.Errorf("replica %v is unhealthy", id)
+			case t.Health == "starting":
+				// The health check has not passed yet, the replica is waited for.
+			case t.State == task.Running && (t.Health == "" || t.Health == "healthy"):
+				ready++
+			}
+		}
+		m.mu.Unlock()
+
+		if ready == len(ids) {
+			return nil
+		}
+	}
+	return fmt.Errorf("replicas were not ready after %v", timeout)
+}
+
+// outdatedReplicas returns the active replicas of s which run an older revision. The caller must hold mu.
+func (m *Manager) outdatedReplicas(s *Service) []uuid.UUID {
+	outdated := []uuid.UUID{}
+	for _, id := range s.Tasks {
+		t, ok := m.TaskDb[id]
+		if !ok || t.State == task.Failed || t.State == task.Completed {
+			continue
+		}
+		if t.Revision != s.Revision {
+			outdated = append(outdated, id)
+		}
+	}
+	return outdated
+}
+
+// updateRunning reports whether a rolling update or rollback of the Service is in flight.
+func (s *Service) updateRunning() bool {
+	return s.UpdateStatus.State == UpdateInProgress || s.UpdateStatus.State == UpdateRollingBack
+}
+
+// setTemplate moves the current template into the history and makes template the next revision.
+func (s *Service) setTemplate(template task.Task) {
+	s.History = append(s.History, ServiceRevision{
+		Revision:  s.Revision,
+		Template:  s.Template,
+		CreatedAt: time.Now().UTC(),
+	})
+	if len(s.History) > revisionHistoryLimit {
+		s.History = s.History[len(s.History)-revisionHistoryLimit:]
+	}
+
+	s.Template = template
+	s.Revision++
+}
+
+// rollback makes the template of a previous revision current again, as a new revision.
+func (s *Service) rollback(revision int) error {
+	if len(s.History) == 0 {
+		return errdefs.New(errdefs.Conflict, "service %s has no previous revision", s.Name)
+	}
+
+	target := s.History[len(s.History)-1]
+	if revision != 0 {
+		found := false
+		for _, r := range s.History {
+			if r.Revision == revision {
+				target = r
+				found = true
+			}
+		}
+		if !found {
+			return errdefs.New(errdefs.NotFound, "service %s has no revision %d", s.Name, revision)
+		}
+	}
+
+	s.setTemplate(target.Template)
+	s.UpdateStatus = UpdateStatus{
+		State:     UpdateRollingBack,
+		StartedAt: time.Now().UTC(),
+		Message:   fmt.Sprintf("rolling back to the template of revision %d", target.Revision),
+	}
+	return nil
+}
+
+func (s *Service) finishUpdate() {
+	if s.UpdateStatus.State == UpdateRollingBack {
+		s.UpdateStatus.State = UpdateRolledBack
+	} else {
+		s.UpdateStatus.State = UpdateCompleted
+	}
+	s.UpdateStatus.CompletedAt = time.Now().UTC()
+}
+
+// dropTasks removes the given replicas from the Service.
+func (s *Service) dropTasks(ids []uuid.UUID) {
+	kept := []uuid.UUID{}
+	for _, id := range s.Tasks {
+		if !slices.Contains(ids, id) {
+			kept = append(kept, id)
+		}
+	}
+	s.Tasks = kept
+}
@@ -0,0 +1,282 @@
+package manager
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+// Service keeps a desired number of identical Tasks, its replicas, alive.
+type Service struct {
+	// ID is a unique identifier field for the Service.
+	ID uuid.UUID
+
+	// Name identifies the Service in the API, it must be unique.
+	Name string
+
+	// Template is the Task every replica is created from. Its ID, Name and State are ignored.
+	Template task.Task
+
+	// Revision is bumped every time Template changes, replicas record the revision they were created from.
+	Revision int
+
+	// History holds the previous templates, oldest first, so that the Service can be rolled back.
+	History []ServiceRevision
+
+	// UpdateConfig controls how replicas are replaced when Template changes.
+	UpdateConfig UpdateConfig
+
+	// UpdateStatus describes the last rolling update.
+	UpdateStatus UpdateStatus
+
+	// Replicas is the desired number of running copies of Template.
+	Replicas int
+
+	// RunningReplicas is the number of replicas seen Running at the last reconciliation.
+	RunningReplicas int
+
+	// Tasks holds the IDs of the replicas currently owned by the Service.
+	Tasks []uuid.UUID
+}
+
+// AddService registers a new Service, its replicas are created by the next reconciliation.
+func (m *Manager) AddService(s Service) (*Service, error) {
+	if s.Name == "" {
+		return nil, errdefs.New(errdefs.InvalidArgument, "service name is required")
+	}
+	if s.Replicas < 0 {
+		return nil, errdefs.New(errdefs.InvalidArgument, "replicas must not be negative, got %d", s.Replicas)
+	}
+	if err := checkTemplate(&s.Template); err != nil {
+		return nil, err
+	}
+	s.UpdateConfig = s.UpdateConfig.withDefaults()
+	if err := s.UpdateConfig.validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.Services[s.Name]; ok {
+		return nil, errdefs.New(errdefs.AlreadyExists, "service %s already exists", s.Name)
+	}
+
+	s.ID = uuid.New()
+	s.Revision = 1
+	s.History = []ServiceRevision{}
+	s.UpdateStatus = UpdateStatus{}
+	s.RunningReplicas = 0
+	s.Tasks = []uuid.UUID{}
+	m.Services[s.Name] = &s
+	m.Logger.Info("Added service %s with %d replicas", s.Name, s.Replicas)
+	return &s, nil
+}
+
+// GetServices returns a copy of every Service.
+func (m *Manager) GetServices() []Service {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	services := []Service{}
+	for _, s := range m.Services {
+		services = append(services, s.copy())
+	}
+	return services
+}
+
+// GetService returns a copy of the named Service.
+func (m *Manager) GetService(name string) (Service, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.Services[name]
+	if !ok {
+		return Service{}, errdefs.New(errdefs.NotFound, "no service named %s", name)
+	}
+	return s.copy(), nil
+}
+
+// ScaleService changes the desired number of replicas of the named Service.
+func (m *Manager) ScaleService(name string, replicas int) error {
+	if replicas < 0 {
+		return errdefs.New(errdefs.InvalidArgument, "replicas must not be negative, got %d", replicas)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.Services[name]
+	if !ok {
+		return errdefs.New(errdefs.NotFound, "no service named %s", name)
+	}
+	m.Logger.Info("Scaling service %s from %d to %d replicas", name, s.Replicas, replicas)
+	s.Replicas = replicas
+	return nil
+}
+
+// RemoveService stops every replica of the named Service and forgets about it.
+func (m *Manager) RemoveService(name string) error {
+	m.mu.Lock()
+	s, ok := m.Services[name]
+	if !ok {
+		m.mu.Unlock()
+		return errdefs.New(errdefs.NotFound, "no service named %s", name)
+	}
+	delete(m.Services, name)
+	replicas := slices.Clone(s.Tasks)
+	m.mu.Unlock()
+
+	for _, id := range replicas {
+		m.removeReplica(id)
+	}
+	m.Logger.Info("Removed service %s", name)
+	return nil
+}
+
+// ReconcileServices creates or removes replicas until every Service has the desired number of them.
+// Replicas which failed or completed are dropped from the Service and replaced.
+// Services being updated, or whose update is paused, are left alone.
+func (m *Manager) ReconcileServices() {
+	m.mu.Lock()
+	toCreate := []task.Task{}
+	toRemove := []uuid.UUID{}
+
+	for _, s := range m.Services {
+		active := []uuid.UUID{}
+		running := 0
+		for _, id := range s.Tasks {
+			t, ok := m.TaskDb[id]
+			if !ok {
+				continue
+			}
+			switch t.State {
+			case task.Failed, task.Completed:
+				m.Logger.Warn("Replica %v of service %s is %v, replacing it", id, s.Name, t.State)
+				continue
+			case task.Running:
+				running++
+			}
+			active = append(active, id)
+		}
+		s.RunningReplicas = running
+
+		if s.updateRunning() || s.UpdateStatus.State == UpdatePaused {
+			continue
+		}
+
+		// Remove the most recently created replicas first, they are the least likely to be running yet.
+		for len(active) > s.Replicas {
+			toRemove = append(toRemove, active[len(active)-1])
+			active = active[:len(active)-1]
+		}
+
+		for len(active) < s.Replicas {
+			t := s.newReplica()
+			toCreate = append(toCreate, t)
+			active = append(active, t.ID)
+		}
+
+		s.Tasks = active
+	}
+	m.mu.Unlock()
+
+	for _, id := range toRemove {
+		m.removeReplica(id)
+	}
+
+	for _, t := range toCreate {
+		m.AddTask(task.Event{
+			ID:        uuid.New(),
+			State:     task.Pending,
+			Timestamp: time.Now().UTC(),
+			Task:      t,
+		})
+	}
+}
+
+// ReconcileServicesForever reconciles the Services every ReconcileInterval, 10 seconds by default.
+func (m *Manager) ReconcileServicesForever() {
+	interval := orDefault(m.ReconcileInterval, 10*time.Second)
+	for {
+		m.Logger.Debug("Reconciling services")
+		m.ReconcileServices()
+		time.Sleep(interval)
+	}
+}
+
+// removeReplica stops a replica, see removeTask.
+func (m *Manager) removeReplica(id uuid.UUID) {
+	if err := m.removeTask(id); err != nil {
+		m.Logger.Error("Error stopping replica %v: %v", id, err)
+	}
+}
+
+// removeTask stops a Task, or drops it from TaskDb if it was never sent to a worker so that
+// SendWork discards it. Unknown Tasks are ignored.
+func (m *Manager) removeTask(id uuid.UUID) error {
+	m.mu.Lock()
+	t, ok := m.TaskDb[id]
+	pending := ok && t.State == task.Pending
+	if pending {
+		delete(m.TaskDb, id)
+	}
+	m.mu.Unlock()
+
+	if !ok || pending {
+		return nil
+	}
+	return m.StopTask(id)
+}
+
+// replaceReplica gives the place of the replica old in the Service owning it to the Task new, and
+// reports whether a Service owned old. The caller holds mu.
+func (m *Manager) replaceReplica(old uuid.UUID, new uuid.UUID) bool {
+	for _, s := range m.Services {
+		if i := slices.Index(s.Tasks, old); i >= 0 {
+			s.Tasks[i] = new
+			return true
+		}
+	}
+	return false
+}
+
+// checkTemplate fills in the defaults of the template of a Service and checks its spec, as for a
+// Task submitted alone. The fields of the error are those of the template, e.g. Template.Image.
+func checkTemplate(t *task.Task) error {
+	t.SetDefaults()
+	violations := errdefs.FieldsOf(task.ValidateSpec(*t))
+	if len(violations) == 0 {
+		return nil
+	}
+	for i := range violations {
+		violations[i].Field = "Template." + violations[i].Field
+	}
+	return errdefs.Invalid(violations)
+}
+
+// newReplica creates a Pending Task from the Service template.
+func (s *Service) newReplica() task.Task {
+	t := s.Template
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%s", s.Name, t.ID.String()[:8])
+	t.State = task.Pending
+	t.History = nil
+	t.Revision = s.Revision
+	t.Health = ""
+	t.ContainerID = ""
+	t.StartTime = time.Time{}
+	t.FinishTime = time.Time{}
+	return t
+}
+
+func (s *Service) copy() Service {
+	c := *s
+	c.Tasks = slices.Clone(s.Tasks)
+	c.History = slices.Clone(s.History)
+	return c
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+// ScaleRequest is the body of a scale call on a service.
+type ScaleRequest struct {
+	Replicas int
+}
+
+// UpdateRequest is the body of a rolling update call on a service.
+// UpdateConfig is optional, the service keeps its current one when it is left out.
+type UpdateRequest struct {
+	Template     task.Task
+	UpdateConfig *UpdateConfig
+}
+
+// RollbackRequest is the optional body of a rollback call on a service.
+// A zero Revision rolls back to the previous template.
+type RollbackRequest struct {
+	Revision int
+}
+
+func (a *Api) CreateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	s := Service{}
+	if err := d.Decode(&s); err != nil {
+		err := errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err)
+		a.Logger.Error("%v", err)
+		writeError(w, err)
+		return
+	}
+
+	created, err := a.Manager.AddService(s)
+	if err != nil {
+		a.Logger.Error("Error adding service %s: %v", s.Name, err)
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (a *Api) GetServicesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.Manager.GetServices())
+}
+
+func (a *Api) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := a.Manager.GetService(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) ScaleServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	sr := ScaleRequest{}
+	if err := d.Decode(&sr); err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+		return
+	}
+
+	if err := a.Manager.ScaleService(name, sr.Replicas); err != nil {
+		a.Logger.Error("Error scaling service %s: %v", name, err)
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) DeleteServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := a.Manager.RemoveService(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) UpdateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	ur := UpdateRequest{}
+	if err := d.Decode(&ur); err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+		return
+	}
+
+	if err := a.Manager.UpdateService(name, ur.Template, ur.UpdateConfig); err != nil {
+		a.Logger.Error("Error updating service %s: %v", name, err)
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *Api) RollbackServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	// The body is optional.
+	rr := RollbackRequest{}
+	if err := d.Decode(&rr); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+		return
+	}
+
+	if err := a.Manager.RollbackService(name, rr.Revision); err != nil {
+		a.Logger.Error("Error rolling back service %s: %v", name, err)
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
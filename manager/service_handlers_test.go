@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/praaatik/tesseract/logger"
+	"github.com/praaatik/tesseract/task"
+)
+
+func TestScaleServiceHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantReplicas int
+	}{
+		{name: "scale", body: `{"Replicas": 3}`, wantStatus: http.StatusNoContent, wantReplicas: 3},
+		{name: "misspelled field", body: `{"Replicas": 3, "Replica": 0}`, wantStatus: http.StatusBadRequest, wantReplicas: 2},
+		{name: "only a misspelled field", body: `{"replica": 0}`, wantStatus: http.StatusBadRequest, wantReplicas: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := logger.NewWithSinks("manager", logger.NewLevels(logger.ERROR), logger.NewSink(io.Discard, logger.DEBUG, logger.TEXT))
+			a := &Api{Manager: New(nil, log), Logger: log}
+			if _, err := a.Manager.AddService(Service{Name: "web", Replicas: 2, Template: task.Task{Image: "nginx"}}); err != nil {
+				t.Fatalf("AddService() error = %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/services/web/scale", strings.NewReader(tt.body))
+			r.SetPathValue("name", "web")
+			rec := httptest.NewRecorder()
+			a.ScaleServiceHandler(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := a.Manager.Services["web"].Replicas; got != tt.wantReplicas {
+				t.Errorf("Replicas = %d, want %d", got, tt.wantReplicas)
+			}
+		})
+	}
+}
+
+func TestRollbackServiceHandler(t *testing.T) {
+	// The service has no previous revision to roll back to once the body is accepted.
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "no body", body: "", wantStatus: http.StatusConflict},
+		{name: "revision", body: `{"Revision": 1}`, wantStatus: http.StatusConflict},
+		{name: "misspelled field", body: `{"Revison": 1}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := logger.NewWithSinks("manager", logger.NewLevels(logger.ERROR), logger.NewSink(io.Discard, logger.DEBUG, logger.TEXT))
+			a := &Api{Manager: New(nil, log), Logger: log}
+			if _, err := a.Manager.AddService(Service{Name: "web", Replicas: 2, Template: task.Task{Image: "nginx"}}); err != nil {
+				t.Fatalf("AddService() error = %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/services/web/rollback", strings.NewReader(tt.body))
+			r.SetPathValue("name", "web")
+			rec := httptest.NewRecorder()
+			a.RollbackServiceHandler(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
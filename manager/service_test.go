@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/logger"
+	"github.com/praaatik/tesseract/task"
+)
+
+func TestReconcileServicesAfterMigration(t *testing.T) {
+	m := New(nil, logger.NewWithSinks("manager", logger.NewLevels(logger.ERROR), logger.NewSink(io.Discard, logger.DEBUG, logger.TEXT)))
+	if _, err := m.AddService(Service{Name: "web", Replicas: 2, Template: task.Task{Image: "nginx"}}); err != nil {
+		t.Fatalf("AddService() error = %v", err)
+	}
+	m.ReconcileServices()
+	replicas := slices.Clone(m.Services["web"].Tasks)
+	for _, id := range replicas {
+		m.TaskDb[id].State = task.Running
+		m.dequeue()
+	}
+
+	// A drain sends a copy of the first replica to another node.
+	moved := uuid.New()
+	m.TaskDb[moved] = &task.Task{ID: moved, State: task.Scheduled}
+	if !m.replaceReplica(replicas[0], moved) {
+		t.Fatalf("replaceReplica() = false, want the replica of the service replaced")
+	}
+	if m.replaceReplica(uuid.New(), uuid.New()) {
+		t.Errorf("replaceReplica() = true for a task of no service")
+	}
+
+	m.ReconcileServices()
+	if got, want := m.Services["web"].Tasks, []uuid.UUID{moved, replicas[1]}; !slices.Equal(got, want) {
+		t.Errorf("Tasks = %v, want %v", got, want)
+	}
+	if n := m.PendingLen(); n != 0 {
+		t.Errorf("PendingLen() = %d, want no replica added", n)
+	}
+}
+
+func TestServiceTemplateValidation(t *testing.T) {
+	m := New(nil, logger.NewWithSinks("manager", logger.NewLevels(logger.ERROR), logger.NewSink(io.Discard, logger.DEBUG, logger.TEXT)))
+	invalid := task.Task{Memory: -1}
+
+	_, err := m.AddService(Service{Name: "web", Replicas: 1, Template: invalid})
+	fields := []string{}
+	for _, f := range errdefs.FieldsOf(err) {
+		fields = append(fields, f.Field)
+	}
+	if !errdefs.Is(err, errdefs.InvalidArgument) || !slices.Equal(fields, []string{"Template.Image", "Template.Memory"}) {
+		t.Fatalf("AddService() error = %v with fields %v, want Template.Image and Template.Memory", err, fields)
+	}
+
+	s, err := m.AddService(Service{Name: "web", Replicas: 1, Template: task.Task{Image: "nginx"}})
+	if err != nil {
+		t.Fatalf("AddService() error = %v", err)
+	}
+	if s.Template.RestartPolicy != task.DefaultRestartPolicy {
+		t.Errorf("Template.RestartPolicy = %q, want the default %q", s.Template.RestartPolicy, task.DefaultRestartPolicy)
+	}
+	if err := m.UpdateService("web", invalid, nil); !errdefs.Is(err, errdefs.InvalidArgument) {
+		t.Errorf("UpdateService() error = %v, want %s", err, errdefs.InvalidArgument)
+	}
+	if got := m.Services["web"].Revision; got != 1 {
+		t.Errorf("Revision = %d after an invalid update, want 1", got)
+	}
+}
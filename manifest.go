@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	v1 "github.com/praaatik/tesseract/api/v1"
+	"github.com/praaatik/tesseract/client"
+)
+
+// manifestFlags are the flags of the commands taking a manifest.
+type manifestFlags struct {
+	clientFlags
+	file string
+}
+
+func (f *manifestFlags) register(fs *flag.FlagSet) {
+	f.clientFlags.register(fs)
+	fs.StringVar(&f.file, "f", "", "Manifest file, - for the standard input")
+}
+
+// read decodes the manifest of -f.
+func (f *manifestFlags) read() (v1.Manifest, error) {
+	if f.file == "" {
+		return v1.Manifest{}, usageError{errors.New("expected a manifest, -f FILE")}
+	}
+	var r io.Reader = os.Stdin
+	if f.file != "-" {
+		file, err := os.Open(f.file)
+		if err != nil {
+			return v1.Manifest{}, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	m, err := v1.DecodeManifest(r)
+	if err != nil {
+		return v1.Manifest{}, fmt.Errorf("%s: %w", f.file, err)
+	}
+	return m, nil
+}
+
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "apply -f FILE [flags]",
+		"Create, update or replace tasks so that one task of each name of the manifest runs with its spec.")
+	flags := &manifestFlags{}
+	flags.register(fs)
+	dryRun := fs.Bool("dry-run", false, "Only print what would be done")
+	return manifestCommand(fs, args, flags, func(c manifestCall) ([]v1.ManifestChange, error) {
+		return c.client.ApplyManifest(c.ctx, c.manifest, *dryRun)
+	})
+}
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "diff -f FILE [flags]",
+		"Show what apply would do to the tasks of the manifest, with the fields of the running tasks which differ.")
+	flags := &manifestFlags{}
+	flags.register(fs)
+	return manifestCommand(fs, args, flags, func(c manifestCall) ([]v1.ManifestChange, error) {
+		return c.client.DiffManifest(c.ctx, c.manifest)
+	})
+}
+
+func runDelete(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	fs.Usage = usageFunc(fs, "delete -f FILE [flags]", "Stop the running tasks named in the manifest.")
+	flags := &manifestFlags{}
+	flags.register(fs)
+	dryRun := fs.Bool("dry-run", false, "Only print the tasks which would be stopped")
+	return manifestCommand(fs, args, flags, func(c manifestCall) ([]v1.ManifestChange, error) {
+		return c.client.DeleteManifest(c.ctx, c.manifest, *dryRun)
+	})
+}
+
+// manifestCommand parses the flags of a manifest command, makes its call and prints the changes. It
+// fails when the change of any task failed.
+func manifestCommand(fs *flag.FlagSet, args []string, flags *manifestFlags, call func(c manifestCall) ([]v1.ManifestChange, error)) error {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Errorf("%s takes no arguments", fs.Name())}
+	}
+	output, err := flags.format()
+	if err != nil {
+		return err
+	}
+	m, err := flags.read()
+	if err != nil {
+		return err
+	}
+
+	c, err := flags.client()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	changes, err := call(manifestCall{ctx: ctx, client: c, manifest: m})
+	if err != nil {
+		return err
+	}
+	if err := output.print(os.Stdout, changes, changeTable(changes)); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, change := range changes {
+		if change.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tasks failed", failed, len(changes))
+	}
+	return nil
+}
+
+// changeTable writes the changes as a table, with a row per field changed.
+func changeTable(changes []v1.ManifestChange) func(w io.Writer) {
+	return func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tACTION\tTASK\tCHANGES")
+		for _, c := range changes {
+			id := "-"
+			switch {
+			case c.NewTaskID != nil:
+				id = c.NewTaskID.String()
+			case c.TaskID != nil:
+				id = c.TaskID.String()
+			}
+			details := []string{}
+			for _, f := range c.Changes {
+				details = append(details, fmt.Sprintf("%s: %s -> %s", f.Field, compact(f.Old), compact(f.New)))
+			}
+			if c.Error != "" {
+				details = append(details, "error: "+c.Error)
+			}
+			if len(details) == 0 {
+				details = append(details, "-")
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Name, c.Action, id, details[0])
+			for _, d := range details[1:] {
+				fmt.Fprintf(w, "\t\t\t%s\n", d)
+			}
+		}
+	}
+}
+
+// compact writes a value of a field as compact JSON.
+func compact(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// manifestCall is what the call of a manifest command is made with.
+type manifestCall struct {
+	ctx      context.Context
+	client   *client.Client
+	manifest v1.Manifest
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/praaatik/tesseract/middleware"
+)
+
+var (
+	httpRequests = NewCounter(
+		"tesseract_http_requests_total",
+		"Number of HTTP requests handled, by component, method, route and status code.",
+		"component", "method", "route", "code",
+	)
+	httpRequestDuration = NewHistogram(
+		"tesseract_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by component, method and route.",
+		DefBuckets,
+		"component", "method", "route",
+	)
+)
+
+func init() {
+	Default.MustRegister(httpRequests, httpRequestDuration)
+}
+
+// Handler serves the metrics of the registry in the text exposition format.
+func Handler(r *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		r.Write(w)
+	}
+}
+
+// Instrument records the number and duration of the requests handled by next.
+// Requests are labelled with the route pattern which matched them, rather than the raw path,
+// to keep IDs out of the label values.
+func Instrument(component string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := middleware.NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.Inc(component, r.Method, route, strconv.Itoa(sw.Status))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), component, r.Method, route)
+	})
+}
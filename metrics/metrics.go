@@ -0,0 +1,361 @@
+// Package metrics is a small implementation of the Prometheus text exposition format.
+// It covers counters, gauges and histograms with labels, which is all tesseract needs,
+// without pulling in the Prometheus client library.
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default is the registry served on the /metrics endpoints of the worker and the manager.
+var Default = NewRegistry()
+
+// Collector is a metric family which can write itself in the text exposition format.
+type Collector interface {
+	// Name is the metric name, unique within a Registry.
+	Name() string
+
+	// Write writes the HELP and TYPE lines followed by every sample.
+	Write(w io.Writer) error
+}
+
+// Registry holds the Collectors exposed together.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Register adds collectors to the registry. It fails if one of the names is already taken.
+func (r *Registry) Register(collectors ...Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range collectors {
+		if _, ok := r.collectors[c.Name()]; ok {
+			return fmt.Errorf("metric %s is already registered", c.Name())
+		}
+		r.collectors[c.Name()] = c
+	}
+	return nil
+}
+
+// MustRegister is Register for package level metrics, it panics on a duplicate name.
+func (r *Registry) MustRegister(collectors ...Collector) {
+	if err := r.Register(collectors...); err != nil {
+		panic(err)
+	}
+}
+
+// Write writes every metric family, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := []Collector{}
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].Name() < collectors[j].Name() })
+	for _, c := range collectors {
+		if err := c.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sample is a single value of a metric with its label values, in the order of the label names.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// family holds what counters, gauges and histograms have in common.
+type family struct {
+	name       string
+	help       string
+	labelNames []string
+}
+
+func (f *family) Name() string {
+	return f.name
+}
+
+func (f *family) writeHeader(w io.Writer, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, typ)
+	return err
+}
+
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// labels renders the label set, with an optional extra label such as the le of a histogram bucket.
+func (f *family) labels(labelValues []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range f.labelNames {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabel(labelValues[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func writeSamples(w io.Writer, f *family, samples []Sample) error {
+	sort.Slice(samples, func(i, j int) bool {
+		return slices.Compare(samples[i].LabelValues, samples[j].LabelValues) < 0
+	})
+	for _, s := range samples {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, f.labels(s.LabelValues), formatValue(s.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counter is a value which only goes up, such as a number of requests or errors.
+type Counter struct {
+	family
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{
+		family: family{name: name, help: help, labelNames: labelNames},
+		values: make(map[string]*Sample),
+	}
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter with the given label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	k := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[k]
+	if !ok {
+		s = &Sample{LabelValues: slices.Clone(labelValues)}
+		c.values[k] = s
+	}
+	s.Value += v
+}
+
+func (c *Counter) Write(w io.Writer) error {
+	c.mu.Lock()
+	samples := []Sample{}
+	for _, s := range c.values {
+		samples = append(samples, *s)
+	}
+	c.mu.Unlock()
+
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+	return writeSamples(w, &c.family, samples)
+}
+
+// Gauge is a value which can go up and down, such as a number of running tasks.
+type Gauge struct {
+	family
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{
+		family: family{name: name, help: help, labelNames: labelNames},
+		values: make(map[string]*Sample),
+	}
+}
+
+// Set sets the gauge with the given label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(s *Sample) { s.Value = v })
+}
+
+// Add adds v, which may be negative, to the gauge with the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.update(labelValues, func(s *Sample) { s.Value += v })
+}
+
+func (g *Gauge) update(labelValues []string, fn func(s *Sample)) {
+	k := g.key(labelValues)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.values[k]
+	if !ok {
+		s = &Sample{LabelValues: slices.Clone(labelValues)}
+		g.values[k] = s
+	}
+	fn(s)
+}
+
+func (g *Gauge) Write(w io.Writer) error {
+	g.mu.Lock()
+	samples := []Sample{}
+	for _, s := range g.values {
+		samples = append(samples, *s)
+	}
+	g.mu.Unlock()
+
+	if err := g.writeHeader(w, "gauge"); err != nil {
+		return err
+	}
+	return writeSamples(w, &g.family, samples)
+}
+
+// GaugeFunc is a gauge whose samples are computed when the metrics are scraped,
+// for values which already live somewhere else such as the host stats or a queue length.
+type GaugeFunc struct {
+	family
+	collect func() []Sample
+}
+
+func NewGaugeFunc(name string, help string, labelNames []string, collect func() []Sample) *GaugeFunc {
+	return &GaugeFunc{
+		family:  family{name: name, help: help, labelNames: labelNames},
+		collect: collect,
+	}
+}
+
+func (g *GaugeFunc) Write(w io.Writer) error {
+	if err := g.writeHeader(w, "gauge"); err != nil {
+		return err
+	}
+	return writeSamples(w, &g.family, g.collect())
+}
+
+// Histogram counts observations, such as latencies, into cumulative buckets.
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// DefBuckets suit the latency of HTTP requests, in seconds.
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// NewHistogram creates a histogram with the given upper bounds, the +Inf bucket is implicit.
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	b := slices.Clone(buckets)
+	slices.Sort(b)
+	return &Histogram{
+		family:  family{name: name, help: help, labelNames: labelNames},
+		buckets: b,
+		values:  make(map[string]*histogramValue),
+	}
+}
+
+// Observe records v in the histogram with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[k]
+	if !ok {
+		hv = &histogramValue{labelValues: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.values[k] = hv
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hv.counts[i]++
+		}
+	}
+	hv.sum += v
+	hv.count++
+}
+
+func (h *Histogram) Write(w io.Writer) error {
+	h.mu.Lock()
+	values := []histogramValue{}
+	for _, hv := range h.values {
+		c := *hv
+		c.counts = slices.Clone(hv.counts)
+		values = append(values, c)
+	}
+	h.mu.Unlock()
+
+	sort.Slice(values, func(i, j int) bool {
+		return slices.Compare(values[i].labelValues, values[j].labelValues) < 0
+	})
+
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	for _, hv := range values {
+		for i, upper := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(hv.labelValues, "le", formatValue(upper)), hv.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(hv.labelValues, "le", "+Inf"), hv.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(hv.labelValues), formatValue(hv.sum)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(hv.labelValues), hv.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes backslashes, double quotes and line feeds, the only escapes of the format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
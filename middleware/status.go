@@ -0,0 +1,28 @@
+// Package middleware holds what the HTTP middlewares of the daemons, such as auditing, metrics and
+// tracing, have in common.
+package middleware
+
+import "net/http"
+
+// StatusWriter records the status code written by a handler.
+type StatusWriter struct {
+	http.ResponseWriter
+
+	// Status is the status code of the response, 200 until the handler writes another one
+	Status int
+}
+
+// NewStatusWriter wraps w to record the status code written to it.
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (w *StatusWriter) WriteHeader(status int) {
+	w.Status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter, e.g. to flush.
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
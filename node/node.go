@@ -10,6 +10,9 @@ type Node struct {
 	// Ip is the IP address which manager requires to send tasks to Nodes.
 	Ip string
 
+	// Api is the address (host:port) of the worker API running on the Node.
+	Api string
+
 	Cores int
 
 	// Memory is the maximum amount of Memory a Task can use.
@@ -24,10 +27,43 @@ type Node struct {
 	// DiskAllocated is the amount of Disk which is currently being used by the Node executing a Task.
 	DiskAllocated int
 
-	// TODO: Check what does this do?
+	// Role is the part the Node plays in the cluster, currently always "worker".
 	Role string
 
+	// Unschedulable marks a cordoned Node, schedulers skip it when placing new Tasks.
+	Unschedulable bool
+
+	// Draining is true while the Tasks of the Node are being moved to other Nodes.
+	Draining bool
+
 	// TaskCount is the number of Tasks the Node uses to keep track.
 	TaskCount int
-	Logger    *logger.Logger
+	Logger    *logger.Logger `json:"-"`
+}
+
+// NewNode creates a schedulable Node for the worker API listening on api.
+func NewNode(name string, api string, role string, logger *logger.Logger) *Node {
+	return &Node{
+		Name:   name,
+		Api:    api,
+		Role:   role,
+		Logger: logger,
+	}
+}
+
+// Cordon marks the Node as unschedulable, Tasks already running on it are left alone.
+func (n *Node) Cordon() {
+	n.Unschedulable = true
+	n.Logger.Info("Node %s cordoned", n.Name)
+}
+
+// Uncordon makes the Node available to schedulers again.
+func (n *Node) Uncordon() {
+	n.Unschedulable = false
+	n.Logger.Info("Node %s uncordoned", n.Name)
+}
+
+// Schedulable reports whether new Tasks may be placed on the Node.
+func (n *Node) Schedulable() bool {
+	return !n.Unschedulable
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// format is how the commands print what the API returned: a table for people, or the JSON or YAML
+// encoding of the API response for scripts.
+type format string
+
+const (
+	formatTable format = "table"
+	formatJSON  format = "json"
+	formatYAML  format = "yaml"
+)
+
+func parseFormat(s string) (format, error) {
+	switch f := format(strings.ToLower(s)); f {
+	case formatTable, formatJSON, formatYAML:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid output format %q, expected table, json or yaml", s)
+}
+
+// print writes v in the format f, calling table to write the table format. The columns written by
+// table are separated by tabs and aligned once it returns.
+func (f format) print(w io.Writer, v any, table func(w io.Writer)) error {
+	switch f {
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case formatYAML:
+		return writeYAML(w, v)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+// writeYAML writes v as YAML. v is encoded as JSON first, so that the YAML has the field names and
+// values of the JSON API, in the same order.
+func writeYAML(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	n, err := readYAMLNode(decoder)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if n.container() && len(n.items) > 0 {
+		n.write(buf, 0)
+	} else {
+		buf.WriteString(n.inline() + "\n")
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// yamlNode is a JSON value keeping the order of the keys of its objects.
+type yamlNode struct {
+	object bool
+	array  bool
+
+	// keys are the keys of an object, items the values of its keys or the items of an array
+	keys  []string
+	items []*yamlNode
+
+	// scalar is the value of anything else: a string, a json.Number, a bool or nil
+	scalar any
+}
+
+func readYAMLNode(d *json.Decoder) (*yamlNode, error) {
+	token, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return &yamlNode{scalar: token}, nil
+	}
+
+	n := &yamlNode{object: delim == '{', array: delim == '['}
+	for d.More() {
+		if n.object {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, key.(string))
+		}
+		item, err := readYAMLNode(d)
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+	}
+	// The closing delimiter
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *yamlNode) container() bool {
+	return n.object || n.array
+}
+
+// inline is the node on a single line, only used for scalars and empty containers.
+func (n *yamlNode) inline() string {
+	switch {
+	case n.object:
+		return "{}"
+	case n.array:
+		return "[]"
+	}
+	switch s := n.scalar.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(s)
+	case json.Number:
+		return s.String()
+	case string:
+		return yamlString(s)
+	}
+	return fmt.Sprint(n.scalar)
+}
+
+// write writes a non-empty container, each line indented by indent spaces. The first line is not
+// indented when the node is an item of an array, it follows the dash of the item.
+func (n *yamlNode) write(buf *bytes.Buffer, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for i, item := range n.items {
+		if i > 0 || buf.Len() == 0 || buf.Bytes()[buf.Len()-1] == '\n' {
+			buf.WriteString(pad)
+		}
+		if n.object {
+			buf.WriteString(yamlString(n.keys[i]) + ":")
+		} else {
+			buf.WriteString("-")
+		}
+
+		switch {
+		case item.container() && len(item.items) > 0 && n.array:
+			buf.WriteString(" ")
+			item.write(buf, indent+2)
+		case item.container() && len(item.items) > 0:
+			buf.WriteString("\n")
+			item.write(buf, indent+2)
+		default:
+			buf.WriteString(" " + item.inline() + "\n")
+		}
+	}
+}
+
+// yamlPlain matches the strings which YAML reads back as the same string without quotes.
+var yamlPlain = regexp.MustCompile(`^[A-Za-z0-9_./][A-Za-z0-9_./=+@, -]*$`)
+
+// yamlString quotes s unless YAML reads it back as a string without quotes. JSON strings are valid
+// double-quoted YAML strings.
+func yamlString(s string) string {
+	if !yamlPlain.MatchString(s) || strings.HasSuffix(s, " ") {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return strconv.Quote(s)
+	}
+	if yamlImplicit.MatchString(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// yamlImplicit matches the plain strings which YAML 1.1 or 1.2 reads as a number or a timestamp:
+// integers in base 2, 8, 10 or 16 with _ separators, sexagesimal numbers such as 12:30, floats,
+// infinities, NaN and dates.
+var yamlImplicit = regexp.MustCompile(`^(?:` +
+	`[-+]?[0-9][0-9_]*(?::[0-5]?[0-9])*(?:\.[0-9_.]*)?(?:[eE][-+]?[0-9]+)?` +
+	`|[-+]?\.[0-9_]+(?:[eE][-+]?[0-9]+)?` +
+	`|[-+]?0[bBoOxX][0-9a-fA-F_]+` +
+	`|[-+]?\.(?:inf|Inf|INF)|\.(?:nan|NaN|NAN)` +
+	`|[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}(?:[Tt ].*)?` +
+	`)$`)
+
+// ago is the time elapsed since t for people, e.g. 5m ago, or - when t is zero.
+func ago(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+}
+
+// bytesSize is a number of bytes for people, e.g. 256MiB, or - when it is zero.
+func bytesSize(n uint64) string {
+	if n == 0 {
+		return "-"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, prefix := float64(n), 0
+	for value >= unit && prefix < 5 {
+		value /= unit
+		prefix++
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + string("KMGTP"[prefix-1]) + "iB"
+}
+
+// labels are key=value pairs in the order of their keys, or - when there are none.
+func labels(l map[string]string) string {
+	if len(l) == 0 {
+		return "-"
+	}
+	pairs := []string{}
+	for _, key := range slices.Sorted(maps.Keys(l)) {
+		pairs = append(pairs, key+"="+l[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// orDash is s, or - when it is empty, so that table cells are never blank.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestYAMLString(t *testing.T) {
+	tests := []struct {
+		s      string
+		quoted bool
+	}{
+		{s: "nginx", quoted: false},
+		{s: "nginx:1.27", quoted: true},
+		{s: "web-1", quoted: false},
+		{s: "registry.local/app/web", quoted: false},
+		{s: "env=prod, tier=web", quoted: false},
+		{s: "v1.2.3", quoted: false},
+		{s: "0xdeadbeef-cafe", quoted: false},
+		{s: "", quoted: true},
+		{s: " leading", quoted: true},
+		{s: "trailing ", quoted: true},
+		{s: "two\nlines", quoted: true},
+		{s: "# comment", quoted: true},
+		{s: "-1", quoted: true},
+		{s: "~", quoted: true},
+
+		// YAML reads these as bools or null.
+		{s: "true", quoted: true},
+		{s: "False", quoted: true},
+		{s: "yes", quoted: true},
+		{s: "OFF", quoted: true},
+		{s: "y", quoted: true},
+		{s: "null", quoted: true},
+		{s: "Null", quoted: true},
+
+		// YAML reads these as numbers.
+		{s: "10", quoted: true},
+		{s: "010", quoted: true},
+		{s: "0x10", quoted: true},
+		{s: "0o17", quoted: true},
+		{s: "0b101", quoted: true},
+		{s: "1_000", quoted: true},
+		{s: "12:30", quoted: true},
+		{s: "1:20:30.5", quoted: true},
+		{s: "1.5", quoted: true},
+		{s: "1.", quoted: true},
+		{s: ".5", quoted: true},
+		{s: "1e5", quoted: true},
+		{s: "1.2.3", quoted: true},
+		{s: ".inf", quoted: true},
+		{s: ".Inf", quoted: true},
+		{s: ".NaN", quoted: true},
+
+		// YAML reads these as timestamps.
+		{s: "2024-01-01", quoted: true},
+		{s: "2024-1-1", quoted: true},
+		{s: "2024-01-01T10:00:00Z", quoted: true},
+		{s: "2024-01-01 10:00:00", quoted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got := yamlString(tt.s)
+			if quoted := strings.HasPrefix(got, `"`); quoted != tt.quoted {
+				t.Fatalf("yamlString(%q) = %s, want quoted %v", tt.s, got, tt.quoted)
+			}
+			if !tt.quoted {
+				if got != tt.s {
+					t.Errorf("yamlString(%q) = %s, want the string as is", tt.s, got)
+				}
+				return
+			}
+			// Double-quoted YAML strings have the escapes of Go strings.
+			if s, err := strconv.Unquote(got); err != nil || s != tt.s {
+				t.Errorf("yamlString(%q) = %s, reads back as %q, %v", tt.s, got, s, err)
+			}
+		})
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{name: "scalar", v: "0x10", want: "\"0x10\"\n"},
+		{name: "empty object", v: map[string]any{}, want: "{}\n"},
+		{
+			name: "object",
+			v: map[string]any{
+				"image":  "nginx",
+				"labels": map[string]string{"2024-01-01": "1_000"},
+				"ports":  []any{8080, "8080/tcp"},
+				"args":   []string{},
+				"limit":  .5,
+				"env":    nil,
+			},
+			want: `args: []
+env: null
+image: nginx
+labels:
+  "2024-01-01": "1_000"
+limit: 0.5
+ports:
+  - 8080
+  - 8080/tcp
+`,
+		},
+		{
+			name: "array of objects",
+			v:    []any{map[string]any{"name": "web", "restart": "no"}},
+			want: `- name: web
+  restart: "no"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := writeYAML(buf, tt.v); err != nil {
+				t.Fatalf("writeYAML() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("writeYAML() =\n%s\nwant\n%s", buf, tt.want)
+			}
+		})
+	}
+}
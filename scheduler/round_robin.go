@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"github.com/praaatik/tesseract/node"
+	"github.com/praaatik/tesseract/task"
+)
+
+// RoundRobin hands out Tasks to the schedulable Nodes in turn.
+type RoundRobin struct {
+	Name string
+
+	// LastWorker is the index of the Node which received the previous Task.
+	LastWorker int
+}
+
+func (r *RoundRobin) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	return schedulable(nodes)
+}
+
+func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	scores := make(map[string]float64)
+	if len(nodes) == 0 {
+		return scores
+	}
+
+	next := (r.LastWorker + 1) % len(nodes)
+	r.LastWorker = next
+
+	for idx, n := range nodes {
+		if idx == next {
+			scores[n.Name] = 0.1
+		} else {
+			scores[n.Name] = 1.0
+		}
+	}
+	return scores
+}
+
+func (r *RoundRobin) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	var best *node.Node
+	var lowest float64
+	for idx, n := range candidates {
+		if idx == 0 || scores[n.Name] < lowest {
+			best = n
+			lowest = scores[n.Name]
+		}
+	}
+	return best
+}
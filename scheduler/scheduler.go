@@ -1,7 +1,29 @@
 package scheduler
 
+import (
+	"github.com/praaatik/tesseract/node"
+	"github.com/praaatik/tesseract/task"
+)
+
+// Scheduler decides which Node a Task should run on.
 type Scheduler interface {
-	SelectCandidateNodes()
-	Score()
-	Pick()
+	// SelectCandidateNodes filters out the Nodes which cannot run the Task.
+	SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node
+
+	// Score rates each candidate Node, keyed by Node name. A lower score is a better fit.
+	Score(t task.Task, nodes []*node.Node) map[string]float64
+
+	// Pick returns the candidate with the best score.
+	Pick(scores map[string]float64, candidates []*node.Node) *node.Node
+}
+
+// schedulable returns the Nodes which are not cordoned.
+func schedulable(nodes []*node.Node) []*node.Node {
+	candidates := []*node.Node{}
+	for _, n := range nodes {
+		if n.Schedulable() {
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates
 }
@@ -0,0 +1,134 @@
+package task
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+// DefaultRestartPolicy is the RestartPolicy of a submitted Task which sets none.
+const DefaultRestartPolicy = "no"
+
+// ParseDryRun reads the dryRun query parameter, which asks for a submission to only be checked and
+// previewed. It is false when left out.
+func ParseDryRun(values url.Values) (bool, error) {
+	value := values.Get("dryRun")
+	if value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errdefs.New(errdefs.InvalidArgument, "Invalid dryRun %q, expected true or false", value)
+	}
+	return dryRun, nil
+}
+
+// Normalize fills in the defaults of a submitted Event: its ID and Timestamp, the ID of its Task, a
+// name derived from the image and the DefaultRestartPolicy.
+func (te *Event) Normalize() {
+	if te.ID == uuid.Nil {
+		te.ID = uuid.New()
+	}
+	if te.Timestamp.IsZero() {
+		te.Timestamp = time.Now().UTC()
+	}
+	if te.Task.ID == uuid.Nil {
+		te.Task.ID = uuid.New()
+	}
+	te.Task.SetDefaults()
+}
+
+// SetDefaults fills in the fields of the spec of t left empty which have a default: a name derived
+// from the image and the ID, and the DefaultRestartPolicy.
+func (t *Task) SetDefaults() {
+	if t.Name == "" && t.Image != "" && t.ID != uuid.Nil {
+		t.Name = imageName(t.Image) + "-" + t.ID.String()[:8]
+	}
+	if t.RestartPolicy == "" {
+		t.RestartPolicy = DefaultRestartPolicy
+	}
+}
+
+// imageName is the last element of the path of an image reference, without tag or digest, e.g.
+// helloworld-http for docker.io/strm/helloworld-http:latest.
+func imageName(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	name := ref[strings.LastIndex(ref, "/")+1:]
+	name, _, _ = strings.Cut(name, ":")
+	if name == "" {
+		return "task"
+	}
+	return name
+}
+
+// Validate checks a submitted Event: the spec of its Task, and States which start it, the State of
+// the Event being one the Task can move to. The error lists every invalid field, see errdefs.FieldsOf.
+func (te Event) Validate() error {
+	violations := specViolations(te.Task, "Task.")
+	if !Contains([]State{Pending, Scheduled}, te.Task.State) {
+		violations = append(violations, errdefs.FieldViolation{
+			Field:       "Task.State",
+			Description: fmt.Sprintf("must be pending or scheduled for a new task, got %s", te.Task.State),
+		})
+	} else if !Contains([]State{Scheduled, Running}, te.State) || !ValidStateTransition(te.Task.State, te.State) {
+		violations = append(violations, errdefs.FieldViolation{
+			Field:       "State",
+			Description: fmt.Sprintf("must be a state the task can move to from %s to start it, got %s", te.Task.State, te.State),
+		})
+	}
+	if len(violations) > 0 {
+		return errdefs.Invalid(violations)
+	}
+	return nil
+}
+
+// ValidateSpec checks the fields of the spec of t. The error lists every invalid field, see errdefs.FieldsOf.
+func ValidateSpec(t Task) error {
+	if violations := specViolations(t, ""); len(violations) > 0 {
+		return errdefs.Invalid(violations)
+	}
+	return nil
+}
+
+func specViolations(t Task, prefix string) []errdefs.FieldViolation {
+	violations := []errdefs.FieldViolation{}
+	invalid := func(field string, format string, args ...any) {
+		violations = append(violations, errdefs.FieldViolation{Field: prefix + field, Description: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.IndexFunc(t.Name, unicode.IsSpace) >= 0 {
+		invalid("Name", "must not contain spaces, got %q", t.Name)
+	}
+	if strings.TrimSpace(t.Image) == "" {
+		invalid("Image", "is required")
+	}
+	if t.Cpu < 0 {
+		invalid("Cpu", "must not be negative, got %g", t.Cpu)
+	}
+	if t.Memory < 0 {
+		invalid("Memory", "must not be negative, got %d", t.Memory)
+	}
+	if t.Disk < 0 {
+		invalid("Disk", "must not be negative, got %d", t.Disk)
+	}
+	if !slices.Contains(RestartPolicies, t.RestartPolicy) {
+		invalid("RestartPolicy", "must be one of no, always, unless-stopped or on-failure, got %q", t.RestartPolicy)
+	}
+	if t.StopGracePeriod < 0 {
+		invalid("StopGracePeriod", "must not be negative, got %v", t.StopGracePeriod)
+	}
+	for key := range t.Labels {
+		if key == "" {
+			invalid("Labels", "keys must not be empty")
+			break
+		}
+	}
+	return violations
+}
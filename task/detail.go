@@ -0,0 +1,102 @@
+package task
+
+import (
+	"net"
+	"slices"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Detail is a Task with the Node running it and what Docker reports about its container,
+// returned by GET /tasks/{taskID} on the worker and the manager.
+type Detail struct {
+	Task *Task
+
+	// Node is the name of the worker the Task was sent to, empty while it is Pending
+	Node string
+
+	// Container is nil when there is no container yet or it could not be inspected,
+	// ContainerError then says why in the latter case
+	Container      *ContainerStatus
+	ContainerError string `json:",omitempty"`
+}
+
+// ContainerStatus is what Docker reports about the container of a Task.
+type ContainerStatus struct {
+	ID string
+
+	// Status is one of created, running, paused, restarting, removing, exited or dead
+	Status   string
+	Running  bool
+	ExitCode int
+
+	// Error is the error Docker met running the container, if any
+	Error string `json:",omitempty"`
+
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	RestartCount int
+
+	// IPAddresses maps the networks of the container to its address in each of them
+	IPAddresses map[string]string
+
+	// Ports maps the exposed ports to the host addresses they are bound to, e.g. "80/tcp": ["0.0.0.0:8080"]
+	Ports map[string][]string
+
+	// Health is starting, healthy or unhealthy, empty when the image has no health check.
+	// FailingStreak is the number of checks which failed in a row.
+	Health        string
+	FailingStreak int `json:",omitempty"`
+}
+
+// NewContainerStatus picks the status of a container from the response of Docker.Inspect.
+func NewContainerStatus(resp types.ContainerJSON) *ContainerStatus {
+	cs := &ContainerStatus{
+		ID:          resp.ID,
+		IPAddresses: map[string]string{},
+		Ports:       map[string][]string{},
+	}
+	if resp.ContainerJSONBase != nil {
+		cs.RestartCount = resp.RestartCount
+	}
+
+	if s := resp.State; s != nil {
+		cs.Status = s.Status
+		cs.Running = s.Running
+		cs.ExitCode = s.ExitCode
+		cs.Error = s.Error
+		cs.StartedAt = dockerTime(s.StartedAt)
+		cs.FinishedAt = dockerTime(s.FinishedAt)
+		if s.Health != nil {
+			cs.Health = s.Health.Status
+			cs.FailingStreak = s.Health.FailingStreak
+		}
+	}
+
+	if n := resp.NetworkSettings; n != nil {
+		for name, endpoint := range n.Networks {
+			if endpoint != nil && endpoint.IPAddress != "" {
+				cs.IPAddresses[name] = endpoint.IPAddress
+			}
+		}
+		for port, bindings := range n.Ports {
+			hosts := []string{}
+			for _, b := range bindings {
+				hosts = append(hosts, net.JoinHostPort(b.HostIP, b.HostPort))
+			}
+			slices.Sort(hosts)
+			cs.Ports[string(port)] = hosts
+		}
+	}
+	return cs
+}
+
+// dockerTime parses the RFC 3339 times of Docker, which reports 0001-01-01T00:00:00Z for times not yet reached.
+func dockerTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
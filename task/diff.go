@@ -0,0 +1,94 @@
+package task
+
+import (
+	"reflect"
+	"slices"
+)
+
+// FieldChange is a field of the spec of a Task whose value differs between two Tasks.
+type FieldChange struct {
+	// Field is the name of the field of Task, e.g. Image
+	Field string
+	Old   any
+	New   any
+}
+
+// specFields are the fields of Task which make its spec, in the order Diff reports them.
+var specFields = []struct {
+	name  string
+	value func(t *Task) any
+}{
+	{"Image", func(t *Task) any { return t.Image }},
+	{"Cmd", func(t *Task) any { return t.Cmd }},
+	{"Env", func(t *Task) any { return t.Env }},
+	{"Cpu", func(t *Task) any { return t.Cpu }},
+	{"Memory", func(t *Task) any { return t.Memory }},
+	{"Disk", func(t *Task) any { return t.Disk }},
+	{"ExposedPorts", func(t *Task) any { return t.ExposedPorts }},
+	{"PortBindings", func(t *Task) any { return t.PortBindings }},
+	{"RestartPolicy", func(t *Task) any { return t.RestartPolicy }},
+	{"NetworkMode", func(t *Task) any { return t.NetworkMode }},
+	{"StopGracePeriod", func(t *Task) any { return t.StopGracePeriod }},
+	{"Labels", func(t *Task) any { return t.Labels }},
+}
+
+// Diff lists the fields of the spec of current which differ in desired. Empty and nil lists or maps
+// are the same.
+func Diff(current *Task, desired *Task) []FieldChange {
+	changes := []FieldChange{}
+	for _, f := range specFields {
+		old, updated := f.value(current), f.value(desired)
+		if !equalValues(old, updated) {
+			changes = append(changes, FieldChange{Field: f.name, Old: old, New: updated})
+		}
+	}
+	return changes
+}
+
+func equalValues(a any, b any) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch va.Kind() {
+	case reflect.Slice, reflect.Map:
+		if va.Len() == 0 && vb.Len() == 0 {
+			return true
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// PatchFor returns the Patch turning the spec of current into the one of desired, and false when
+// some of the changes cannot be made by a Patch.
+func PatchFor(current *Task, desired *Task) (Patch, bool) {
+	p := Patch{}
+	for _, c := range Diff(current, desired) {
+		switch c.Field {
+		case "Image":
+			p.Image = &desired.Image
+		case "Cmd":
+			cmd := slices.Clone(desired.Cmd)
+			p.Cmd = &cmd
+		case "Env":
+			env := slices.Clone(desired.Env)
+			p.Env = &env
+		case "Cpu":
+			p.Cpu = &desired.Cpu
+		case "Memory":
+			p.Memory = &desired.Memory
+		case "RestartPolicy":
+			p.RestartPolicy = &desired.RestartPolicy
+		case "Labels":
+			p.Labels = map[string]*string{}
+			for key := range current.Labels {
+				if _, ok := desired.Labels[key]; !ok {
+					p.Labels[key] = nil
+				}
+			}
+			for key, value := range desired.Labels {
+				p.Labels[key] = &value
+			}
+		default:
+			return Patch{}, false
+		}
+	}
+	return p, true
+}
@@ -0,0 +1,53 @@
+package task
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StateEvent is a change of State of a Task, as streamed by GET /events on the worker and the manager.
+type StateEvent struct {
+	TaskID uuid.UUID
+	Name   string
+	StateChange
+}
+
+// Watcher finds the changes of State recorded in the History of Tasks which it has not reported yet.
+// The History of a Task only grows, apart from a reset when the Task is replaced, so a Watcher only
+// has to remember how many entries of each History it has reported.
+type Watcher struct {
+	since time.Time
+	seen  map[uuid.UUID]int
+}
+
+// NewWatcher returns a Watcher reporting the changes recorded after since.
+func NewWatcher(since time.Time) *Watcher {
+	return &Watcher{since: since, seen: map[uuid.UUID]int{}}
+}
+
+// Changes returns the changes of the tasks not reported by an earlier call, oldest first.
+func (w *Watcher) Changes(tasks []*Task) []StateEvent {
+	events := []StateEvent{}
+	seen := make(map[uuid.UUID]int, len(tasks))
+	for _, t := range tasks {
+		start, ok := w.seen[t.ID]
+		if !ok {
+			start = slices.IndexFunc(t.History, func(c StateChange) bool { return c.Time.After(w.since) })
+			if start < 0 {
+				start = len(t.History)
+			}
+		}
+		start = min(start, len(t.History))
+
+		for _, c := range t.History[start:] {
+			events = append(events, StateEvent{TaskID: t.ID, Name: t.Name, StateChange: c})
+		}
+		seen[t.ID] = len(t.History)
+	}
+	w.seen = seen
+
+	slices.SortStableFunc(events, func(a, b StateEvent) int { return a.Time.Compare(b.Time) })
+	return events
+}
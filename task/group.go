@@ -0,0 +1,81 @@
+package task
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Group is a set of Tasks which are scheduled together onto one Node, like an app and its sidecars.
+// The Tasks are started in order and share the network namespace of the first one,
+// so they can talk to each other over localhost. They are stopped in reverse order.
+type Group struct {
+	// ID is a unique identifier field for the Group.
+	ID uuid.UUID
+
+	// Human-readable name format of the Group.
+	Name string
+
+	// State is the desired state when the Group is sent to a Worker, and the state computed
+	// from its Tasks when it is reported back.
+	State State
+
+	// Tasks are the containers of the Group, in start order.
+	Tasks []Task
+
+	// StartTime is the time when the Group was started.
+	StartTime time.Time
+
+	// FinishTime is the time when the Group was stopped.
+	FinishTime time.Time
+}
+
+// GroupState sums up the States of the Tasks of a Group into one State.
+// A single failed Task fails the whole Group, which is only Running once every Task is.
+func GroupState(tasks []Task) State {
+	if len(tasks) == 0 {
+		return Pending
+	}
+
+	counts := make(map[State]int)
+	for _, t := range tasks {
+		counts[t.State]++
+	}
+
+	switch {
+	case counts[Failed] > 0:
+		return Failed
+	case counts[Completed] == len(tasks):
+		return Completed
+	case counts[Running] == len(tasks):
+		return Running
+	case counts[Pending] == len(tasks):
+		return Pending
+	case counts[Completed] > 0:
+		// Some Tasks are stopped while others are still up, the Group is no longer whole.
+		return Failed
+	default:
+		return Scheduled
+	}
+}
+
+// Resources returns a Task asking for the sum of the resources of the Tasks of the Group,
+// so that the Group can be scheduled as a single unit.
+func (g *Group) Resources() Task {
+	t := Task{
+		ID:    g.ID,
+		Name:  g.Name,
+		State: g.State,
+	}
+	for _, member := range g.Tasks {
+		t.Memory += member.Memory
+		t.Disk += member.Disk
+		t.Cpu += member.Cpu
+	}
+	return t
+}
+
+// ContainerNetworkMode is the Docker network mode joining the network namespace of another container.
+func ContainerNetworkMode(containerID string) string {
+	return "container:" + containerID
+}
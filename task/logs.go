@@ -0,0 +1,96 @@
+package task
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+// LogOptions selects the output of a container streamed by GET /tasks/{taskID}/logs.
+type LogOptions struct {
+	// Follow keeps the stream open until the container exits
+	Follow bool
+
+	// Tail is the number of lines to start from, counted from the end, all of them when zero
+	Tail int
+
+	// Since drops the lines written before it, ignored when zero
+	Since time.Time
+
+	// Timestamps prefixes each line with the RFC 3339 time it was written at
+	Timestamps bool
+}
+
+// ParseLogOptions reads LogOptions from the parameters follow, tail, since (an RFC 3339 timestamp or
+// a duration such as 10m, counted back from now) and timestamps.
+func ParseLogOptions(values url.Values) (LogOptions, error) {
+	o := LogOptions{}
+	for name, flag := range map[string]*bool{"follow": &o.Follow, "timestamps": &o.Timestamps} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return LogOptions{}, errdefs.New(errdefs.InvalidArgument, "invalid %s %q, expected true or false", name, value)
+		}
+		*flag = b
+	}
+
+	if value := values.Get("tail"); value != "" {
+		tail, err := strconv.Atoi(value)
+		if err != nil || tail < 0 {
+			return LogOptions{}, errdefs.New(errdefs.InvalidArgument, "invalid tail %q, expected a number of lines", value)
+		}
+		o.Tail = tail
+	}
+
+	if value := values.Get("since"); value != "" {
+		if since, err := time.Parse(time.RFC3339, value); err == nil {
+			o.Since = since
+		} else if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			o.Since = time.Now().UTC().Add(-d)
+		} else {
+			return LogOptions{}, errdefs.New(errdefs.InvalidArgument, "invalid since %q, expected an RFC 3339 timestamp or a duration such as 10m", value)
+		}
+	}
+	return o, nil
+}
+
+// Values encodes the LogOptions as the parameters ParseLogOptions reads.
+func (o LogOptions) Values() url.Values {
+	values := url.Values{}
+	if o.Follow {
+		values.Set("follow", "true")
+	}
+	if o.Tail > 0 {
+		values.Set("tail", strconv.Itoa(o.Tail))
+	}
+	if !o.Since.IsZero() {
+		values.Set("since", o.Since.Format(time.RFC3339))
+	}
+	if o.Timestamps {
+		values.Set("timestamps", "true")
+	}
+	return values
+}
+
+func (o LogOptions) docker() container.LogsOptions {
+	options := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     o.Follow,
+		Timestamps: o.Timestamps,
+		Tail:       "all",
+	}
+	if o.Tail > 0 {
+		options.Tail = strconv.Itoa(o.Tail)
+	}
+	if !o.Since.IsZero() {
+		options.Since = strconv.FormatInt(o.Since.Unix(), 10)
+	}
+	return options
+}
@@ -0,0 +1,92 @@
+package task
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+// RestartPolicies are the valid values of the RestartPolicy of a Task, the empty one meaning none.
+var RestartPolicies = []string{"", "no", "always", "unless-stopped", "on-failure"}
+
+// Patch is a partial update of a Task, the fields left out (nil) are unchanged.
+// Memory, Cpu and RestartPolicy are applied to the running container in place and Labels are only
+// recorded, while a new Image, Env or Cmd replaces the container, see NeedsReplace.
+type Patch struct {
+	Memory        *int
+	Cpu           *float64
+	RestartPolicy *string
+
+	// Labels are merged into those of the Task, a null value removes the label.
+	Labels map[string]*string
+
+	Image *string
+	Env   *[]string
+	Cmd   *[]string
+}
+
+// Validate checks the values of the Patch.
+func (p Patch) Validate() error {
+	if p.Memory != nil && *p.Memory < 0 {
+		return errdefs.New(errdefs.InvalidArgument, "invalid Memory %d, it must not be negative", *p.Memory)
+	}
+	if p.Cpu != nil && *p.Cpu < 0 {
+		return errdefs.New(errdefs.InvalidArgument, "invalid Cpu %g, it must not be negative", *p.Cpu)
+	}
+	if p.RestartPolicy != nil && !slices.Contains(RestartPolicies, *p.RestartPolicy) {
+		return errdefs.New(errdefs.InvalidArgument, "invalid RestartPolicy %q, expected one of no, always, unless-stopped or on-failure", *p.RestartPolicy)
+	}
+	if p.Image != nil && *p.Image == "" {
+		return errdefs.New(errdefs.InvalidArgument, "invalid Image, it must not be empty")
+	}
+	for key := range p.Labels {
+		if key == "" {
+			return errdefs.New(errdefs.InvalidArgument, "label keys must not be empty")
+		}
+	}
+	return nil
+}
+
+// Apply returns a copy of t with the Patch applied.
+func (p Patch) Apply(t Task) Task {
+	if p.Memory != nil {
+		t.Memory = *p.Memory
+	}
+	if p.Cpu != nil {
+		t.Cpu = *p.Cpu
+	}
+	if p.RestartPolicy != nil {
+		t.RestartPolicy = *p.RestartPolicy
+	}
+	if p.Labels != nil {
+		labels := maps.Clone(t.Labels)
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for key, value := range p.Labels {
+			if value == nil {
+				delete(labels, key)
+			} else {
+				labels[key] = *value
+			}
+		}
+		t.Labels = labels
+	}
+	if p.Image != nil {
+		t.Image = *p.Image
+	}
+	if p.Env != nil {
+		t.Env = *p.Env
+	}
+	if p.Cmd != nil {
+		t.Cmd = *p.Cmd
+	}
+	return t
+}
+
+// NeedsReplace reports whether going from the spec of old to the one of updated needs a new
+// container, rather than an update of the running one.
+func NeedsReplace(old *Task, updated *Task) bool {
+	return old.Image != updated.Image || !slices.Equal(old.Env, updated.Env) || !slices.Equal(old.Cmd, updated.Cmd)
+}
@@ -0,0 +1,291 @@
+package task
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+// MaxLimit caps the number of Tasks of a page.
+const MaxLimit = 1000
+
+// Query selects, orders and pages through a list of Tasks. It is read from the query parameters of the
+// task listings with ParseQuery, for example:
+//
+//	?state=running,failed&namePrefix=web-&label=env=prod&startedAfter=2024-01-01T00:00:00Z&sort=-startTime&limit=50
+//
+// Tasks are ordered by Sort, then by ID so that the order is stable. A page ends with a cursor, which
+// is passed back as the cursor parameter to get the next page.
+type Query struct {
+	// States keeps the Tasks in any of the States, all of them when empty
+	States []State
+
+	// NamePrefix keeps the Tasks whose Name starts with it
+	NamePrefix string
+
+	// Image keeps the Tasks running exactly this Image
+	Image string
+
+	// Labels keeps the Tasks having all of these labels. An empty value only requires the key.
+	Labels map[string]string
+
+	// StartedAfter, StartedBefore, FinishedAfter and FinishedBefore bound StartTime and FinishTime,
+	// the bounds are inclusive and ignored when zero. A Task not started or not finished yet is left
+	// out by the bounds of the time it lacks.
+	StartedAfter   time.Time
+	StartedBefore  time.Time
+	FinishedAfter  time.Time
+	FinishedBefore time.Time
+
+	// Sort is startTime or finishTime, prefixed with - for a descending order. Tasks are ordered by ID only when empty.
+	Sort string
+
+	// Limit is the size of a page, no limit when zero
+	Limit int
+
+	// Cursor is the position after which the page starts, as returned with the previous page
+	Cursor string
+}
+
+// sortKeys are the valid values of Query.Sort, without the - prefix.
+var sortKeys = map[string]func(t *Task) time.Time{
+	"startTime":  func(t *Task) time.Time { return t.StartTime },
+	"finishTime": func(t *Task) time.Time { return t.FinishTime },
+}
+
+// ParseQuery reads a Query from the parameters state, namePrefix, image, label (key=value or key,
+// repeatable), startedAfter, startedBefore, finishedAfter, finishedBefore (RFC 3339), sort, limit and cursor.
+func ParseQuery(values url.Values) (Query, error) {
+	q := Query{
+		NamePrefix: values.Get("namePrefix"),
+		Image:      values.Get("image"),
+		Sort:       values.Get("sort"),
+		Cursor:     values.Get("cursor"),
+	}
+
+	for _, param := range values["state"] {
+		for _, name := range strings.Split(param, ",") {
+			s, err := ParseState(strings.TrimSpace(name))
+			if err != nil {
+				return Query{}, errdefs.New(errdefs.InvalidArgument, "invalid state: %w", err)
+			}
+			q.States = append(q.States, s)
+		}
+	}
+
+	for _, label := range values["label"] {
+		key, value, _ := strings.Cut(label, "=")
+		if key == "" {
+			return Query{}, errdefs.New(errdefs.InvalidArgument, "invalid label %q, expected key=value or key", label)
+		}
+		if q.Labels == nil {
+			q.Labels = map[string]string{}
+		}
+		q.Labels[key] = value
+	}
+
+	for name, bound := range map[string]*time.Time{
+		"startedAfter":   &q.StartedAfter,
+		"startedBefore":  &q.StartedBefore,
+		"finishedAfter":  &q.FinishedAfter,
+		"finishedBefore": &q.FinishedBefore,
+	} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return Query{}, errdefs.New(errdefs.InvalidArgument, "invalid %s %q, expected an RFC 3339 timestamp", name, value)
+		}
+		*bound = t
+	}
+
+	if _, ok := sortKeys[strings.TrimPrefix(q.Sort, "-")]; q.Sort != "" && !ok {
+		return Query{}, errdefs.New(errdefs.InvalidArgument, "invalid sort %q, expected startTime or finishTime, optionally prefixed with -", q.Sort)
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > MaxLimit {
+			return Query{}, errdefs.New(errdefs.InvalidArgument, "invalid limit %q, expected a number between 1 and %d", value, MaxLimit)
+		}
+		q.Limit = limit
+	}
+
+	if q.Cursor != "" {
+		if _, err := q.decodeCursor(); err != nil {
+			return Query{}, err
+		}
+	}
+	return q, nil
+}
+
+// Values encodes the Query as the parameters ParseQuery reads.
+func (q Query) Values() url.Values {
+	values := url.Values{}
+	if len(q.States) > 0 {
+		names := []string{}
+		for _, s := range q.States {
+			names = append(names, s.String())
+		}
+		values.Set("state", strings.Join(names, ","))
+	}
+	for key, value := range q.Labels {
+		if value == "" {
+			values.Add("label", key)
+		} else {
+			values.Add("label", key+"="+value)
+		}
+	}
+	for name, bound := range map[string]time.Time{
+		"startedAfter":   q.StartedAfter,
+		"startedBefore":  q.StartedBefore,
+		"finishedAfter":  q.FinishedAfter,
+		"finishedBefore": q.FinishedBefore,
+	} {
+		if !bound.IsZero() {
+			values.Set(name, bound.Format(time.RFC3339))
+		}
+	}
+	for name, value := range map[string]string{
+		"namePrefix": q.NamePrefix,
+		"image":      q.Image,
+		"sort":       q.Sort,
+		"cursor":     q.Cursor,
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return values
+}
+
+// Matches reports whether t passes the filters of the Query.
+func (q Query) Matches(t *Task) bool {
+	if len(q.States) > 0 && !slices.Contains(q.States, t.State) {
+		return false
+	}
+	if !strings.HasPrefix(t.Name, q.NamePrefix) {
+		return false
+	}
+	if q.Image != "" && t.Image != q.Image {
+		return false
+	}
+	for key, value := range q.Labels {
+		v, ok := t.Labels[key]
+		if !ok || (value != "" && v != value) {
+			return false
+		}
+	}
+	return within(t.StartTime, q.StartedAfter, q.StartedBefore) && within(t.FinishTime, q.FinishedAfter, q.FinishedBefore)
+}
+
+// within reports whether t is within the bounds which are set. A zero t, a time which did not come
+// yet, is within none.
+func within(t time.Time, after time.Time, before time.Time) bool {
+	if after.IsZero() && before.IsZero() {
+		return true
+	}
+	if t.IsZero() {
+		return false
+	}
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+	if !before.IsZero() && t.After(before) {
+		return false
+	}
+	return true
+}
+
+// Apply filters and orders tasks and returns the requested page, with the cursor of the next page,
+// empty on the last one.
+func (q Query) Apply(tasks []*Task) ([]*Task, string) {
+	page := []*Task{}
+	for _, t := range tasks {
+		if q.Matches(t) {
+			page = append(page, t)
+		}
+	}
+	slices.SortFunc(page, q.compare)
+
+	if q.Cursor != "" {
+		// ParseQuery checked the cursor already.
+		after, _ := q.decodeCursor()
+		start, _ := slices.BinarySearchFunc(page, after, func(t *Task, c cursor) int {
+			if q.compare(t, c.task()) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		page = page[start:]
+	}
+
+	if q.Limit == 0 || len(page) <= q.Limit {
+		return page, ""
+	}
+	page = page[:q.Limit]
+	return page, q.encodeCursor(page[len(page)-1])
+}
+
+// compare orders two Tasks by the Sort key, then by ID.
+func (q Query) compare(a *Task, b *Task) int {
+	desc := strings.HasPrefix(q.Sort, "-")
+	if key, ok := sortKeys[strings.TrimPrefix(q.Sort, "-")]; ok {
+		if c := key(a).Compare(key(b)); c != 0 {
+			if desc {
+				return -c
+			}
+			return c
+		}
+	}
+	c := strings.Compare(a.ID.String(), b.ID.String())
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// cursor is the position of the last Task of a page: its sort key and ID.
+type cursor struct {
+	Sort string    `json:"s"`
+	Time time.Time `json:"t"`
+	ID   uuid.UUID `json:"id"`
+}
+
+// task returns a Task at the position of the cursor, to compare others with.
+func (c cursor) task() *Task {
+	return &Task{ID: c.ID, StartTime: c.Time, FinishTime: c.Time}
+}
+
+func (q Query) encodeCursor(last *Task) string {
+	c := cursor{Sort: q.Sort, ID: last.ID}
+	if key, ok := sortKeys[strings.TrimPrefix(q.Sort, "-")]; ok {
+		c.Time = key(last)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (q Query) decodeCursor() (cursor, error) {
+	c := cursor{}
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return cursor{}, errdefs.New(errdefs.InvalidArgument, "invalid cursor %q", q.Cursor)
+	}
+	if c.Sort != q.Sort {
+		return cursor{}, errdefs.New(errdefs.InvalidArgument, "cursor %q belongs to a listing sorted by %q, not %q", q.Cursor, c.Sort, q.Sort)
+	}
+	return c, nil
+}
@@ -0,0 +1,202 @@
+package task
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(hours int) time.Time {
+	return epoch.Add(time.Duration(hours) * time.Hour)
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    Query
+		wantErr bool
+	}{
+		{name: "empty", query: "", want: Query{}},
+		{
+			name:  "filters",
+			query: "state=running,failed&namePrefix=web-&image=nginx&label=env=prod&label=tier&startedAfter=2024-01-01T00:00:00Z&finishedBefore=2024-01-01T02:00:00Z",
+			want: Query{
+				States:         []State{Running, Failed},
+				NamePrefix:     "web-",
+				Image:          "nginx",
+				Labels:         map[string]string{"env": "prod", "tier": ""},
+				StartedAfter:   at(0),
+				FinishedBefore: at(2),
+			},
+		},
+		{name: "sort and limit", query: "sort=-startTime&limit=50", want: Query{Sort: "-startTime", Limit: 50}},
+		{name: "unknown state", query: "state=sleeping", wantErr: true},
+		{name: "label without key", query: "label==prod", wantErr: true},
+		{name: "invalid time", query: "startedBefore=yesterday", wantErr: true},
+		{name: "unknown sort", query: "sort=name", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit above the maximum", query: fmt.Sprintf("limit=%d", MaxLimit+1), wantErr: true},
+		{name: "invalid cursor", query: "cursor=nope", wantErr: true},
+		{name: "cursor of another sort", query: "sort=finishTime&cursor=" + Query{Sort: "startTime"}.encodeCursor(&Task{}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			got, err := ParseQuery(values)
+			if tt.wantErr {
+				if !errdefs.Is(err, errdefs.InvalidArgument) {
+					t.Fatalf("ParseQuery() error = %v, want %s", err, errdefs.InvalidArgument)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ParseQuery() = %+v, want %+v", got, tt.want)
+			}
+
+			// Values encodes what ParseQuery reads.
+			again, err := ParseQuery(got.Values())
+			if err != nil || fmt.Sprint(again) != fmt.Sprint(got) {
+				t.Errorf("ParseQuery(Values()) = %+v, %v, want %+v", again, err, got)
+			}
+		})
+	}
+}
+
+func TestQueryMatches(t *testing.T) {
+	finished := &Task{
+		Name: "web-1", Image: "nginx", State: Completed, Labels: map[string]string{"env": "prod"},
+		StartTime: at(1), FinishTime: at(3),
+	}
+	running := &Task{Name: "web-2", Image: "nginx", State: Running, StartTime: at(2)}
+	pending := &Task{Name: "batch-1", Image: "busybox", State: Pending}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []*Task
+	}{
+		{name: "no filter", query: Query{}, want: []*Task{finished, running, pending}},
+		{name: "states", query: Query{States: []State{Running, Pending}}, want: []*Task{running, pending}},
+		{name: "name prefix", query: Query{NamePrefix: "web-"}, want: []*Task{finished, running}},
+		{name: "image", query: Query{Image: "busybox"}, want: []*Task{pending}},
+		{name: "label value", query: Query{Labels: map[string]string{"env": "prod"}}, want: []*Task{finished}},
+		{name: "label value differs", query: Query{Labels: map[string]string{"env": "dev"}}, want: []*Task{}},
+		{name: "label key", query: Query{Labels: map[string]string{"env": ""}}, want: []*Task{finished}},
+		{name: "started after, inclusive", query: Query{StartedAfter: at(2)}, want: []*Task{running}},
+		{name: "started before, inclusive", query: Query{StartedBefore: at(1)}, want: []*Task{finished}},
+		{name: "started before leaves out tasks not started", query: Query{StartedBefore: at(10)}, want: []*Task{finished, running}},
+		{name: "started within", query: Query{StartedAfter: at(0), StartedBefore: at(1)}, want: []*Task{finished}},
+		{name: "finished after", query: Query{FinishedAfter: at(0)}, want: []*Task{finished}},
+		{name: "finished before leaves out tasks not finished", query: Query{FinishedBefore: at(10)}, want: []*Task{finished}},
+		{name: "finished before the end", query: Query{FinishedBefore: at(2)}, want: []*Task{}},
+		{name: "all filters", query: Query{States: []State{Completed}, NamePrefix: "web", Image: "nginx", StartedBefore: at(1), FinishedAfter: at(3)}, want: []*Task{finished}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []*Task{}
+			for _, task := range []*Task{finished, running, pending} {
+				if tt.query.Matches(task) {
+					got = append(got, task)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Matches() kept %v, want %v", names(got), names(tt.want))
+			}
+		})
+	}
+}
+
+func TestQueryApplyPages(t *testing.T) {
+	// Tasks 0 to 3 start at the same time, the ties are broken by ID. Task 6 has not started yet.
+	tasks := []*Task{}
+	starts := []int{5, 5, 5, 5, 1, 9, -1}
+	for i, start := range starts {
+		task := &Task{ID: uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", 6-i)), Name: fmt.Sprint("task-", i)}
+		if start >= 0 {
+			task.StartTime = at(start)
+		}
+		tasks = append(tasks, task)
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{sort: "", want: []string{"task-6", "task-5", "task-4", "task-3", "task-2", "task-1", "task-0"}},
+		{sort: "startTime", want: []string{"task-6", "task-4", "task-3", "task-2", "task-1", "task-0", "task-5"}},
+		{sort: "-startTime", want: []string{"task-5", "task-0", "task-1", "task-2", "task-3", "task-4", "task-6"}},
+	}
+
+	for _, tt := range tests {
+		for limit := 1; limit <= len(tasks)+1; limit++ {
+			t.Run(fmt.Sprintf("sort %q limit %d", tt.sort, limit), func(t *testing.T) {
+				q := Query{Sort: tt.sort, Limit: limit}
+				got := []*Task{}
+				for pages := 0; ; pages++ {
+					if pages > len(tasks) {
+						t.Fatalf("paging did not end, got %v so far", names(got))
+					}
+					page, next := q.Apply(slices.Clone(tasks))
+					if len(page) > limit {
+						t.Fatalf("page of %d tasks, over the limit of %d", len(page), limit)
+					}
+					got = append(got, page...)
+					if next == "" {
+						break
+					}
+
+					// The cursor goes through the query parameters.
+					values := q.Values()
+					values.Set("cursor", next)
+					var err error
+					if q, err = ParseQuery(values); err != nil {
+						t.Fatalf("ParseQuery() error = %v", err)
+					}
+				}
+				if !slices.Equal(names(got), tt.want) {
+					t.Errorf("pages listed %v, want %v", names(got), tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestQueryApplyFiltersBeforePaging(t *testing.T) {
+	tasks := []*Task{
+		{ID: uuid.MustParse("00000000-0000-0000-0000-000000000001"), Name: "a", State: Running},
+		{ID: uuid.MustParse("00000000-0000-0000-0000-000000000002"), Name: "b", State: Failed},
+		{ID: uuid.MustParse("00000000-0000-0000-0000-000000000003"), Name: "c", State: Running},
+	}
+	q := Query{States: []State{Running}, Limit: 1}
+
+	page, next := q.Apply(tasks)
+	if !slices.Equal(names(page), []string{"a"}) || next == "" {
+		t.Fatalf("first page = %v, %q, want [a] and a cursor", names(page), next)
+	}
+	q.Cursor = next
+	page, next = q.Apply(tasks)
+	if !slices.Equal(names(page), []string{"c"}) || next != "" {
+		t.Errorf("second page = %v, %q, want [c] and no cursor", names(page), next)
+	}
+}
+
+func names(tasks []*Task) []string {
+	n := []string{}
+	for _, t := range tasks {
+		n = append(n, t.Name)
+	}
+	return n
+}
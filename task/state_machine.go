@@ -1,6 +1,12 @@
 package task
 
-import "slices"
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/praaatik/tesseract/errdefs"
+)
 
 // State represents the current lifecycle state of a Task.
 type State int
@@ -22,6 +28,55 @@ const (
 	Failed
 )
 
+var stateNames = map[State]string{
+	Pending:   "pending",
+	Scheduled: "scheduled",
+	Running:   "running",
+	Completed: "completed",
+	Failed:    "failed",
+}
+
+// States lists every State in lifecycle order.
+var States = []State{Pending, Scheduled, Running, Completed, Failed}
+
+// String returns the lower case name of the State, as used in logs and metric labels.
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// ParseState returns the State with the given name, as returned by String.
+func ParseState(name string) (State, error) {
+	for s, n := range stateNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return Pending, errdefs.New(errdefs.InvalidArgument, "unknown state %q", name)
+}
+
+// StateChange is an entry of the History of a Task.
+type StateChange struct {
+	State State
+	Time  time.Time
+
+	// Reason explains the change, e.g. the exit code of the container
+	Reason string `json:",omitempty"`
+}
+
+// SetState moves the Task to s and records the change in its History. Setting the State the Task
+// was last recorded in again leaves the History alone.
+func (t *Task) SetState(s State, reason string) {
+	t.State = s
+	if n := len(t.History); n > 0 && t.History[n-1].State == s {
+		return
+	}
+	// Copies of a Task share the array of their History, Clip makes append allocate a new one.
+	t.History = append(slices.Clip(t.History), StateChange{State: s, Time: time.Now().UTC(), Reason: reason})
+}
+
 var stateTransitionMap = map[State][]State{
 	Pending:   {Scheduled},
 	Scheduled: {Scheduled, Running, Failed},
@@ -2,19 +2,36 @@ package task
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"math"
 	"os"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	dockererrdefs "github.com/docker/docker/errdefs"
 	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
 	"github.com/praaatik/tesseract/logger"
+	"github.com/praaatik/tesseract/metrics"
+	"github.com/praaatik/tesseract/tracing"
 )
 
+// dockerErrors counts the failed calls to the Docker API, by operation.
+var dockerErrors = metrics.NewCounter(
+	"tesseract_docker_errors_total",
+	"Number of failed Docker API calls, by operation.",
+	"operation",
+)
+
+func init() {
+	metrics.Default.MustRegister(dockerErrors)
+}
+
 // Task is the smallest unit of work to be performed.
 // This struct might be extended with more fields.
 type Task struct {
@@ -30,6 +47,12 @@ type Task struct {
 	// Image indicates the Docker image the Task is running.
 	Image string
 
+	// Env holds the environment variables of the container, as KEY=value.
+	Env []string
+
+	// Cmd is the command of the container, the default of the image when empty.
+	Cmd []string
+
 	// Memory is useful to identify the memory the Task would require.
 	Memory int
 
@@ -48,13 +71,43 @@ type Task struct {
 	// RestartPolicy defines the policy which tells the system what to do when a Task fails.
 	RestartPolicy string
 
+	// NetworkMode is the Docker network mode of the container, e.g. "container:<id>" to share the
+	// network namespace of another container. Empty means the Docker default.
+	NetworkMode string
+
+	// GroupID is the ID of the Group the Task belongs to, if any.
+	GroupID uuid.UUID
+
 	// StartTime is the time when the Task was started.
 	StartTime time.Time
 
 	// FinishTime is the time when the Task was completed.
 	FinishTime time.Time
 
-	Logger *logger.Logger
+	// History records the States the Task went through, oldest first, see SetState.
+	History []StateChange
+
+	// Labels are key/value pairs describing the Task, e.g. env=prod, which listings can filter on.
+	Labels map[string]string
+
+	// Revision is the revision of the spec the Task was created from, e.g. the template revision of its Service.
+	Revision int
+
+	// Health is the status of the container health check (starting, healthy or unhealthy).
+	// It is empty when the image does not define a health check.
+	Health string
+
+	// StopGracePeriod is how long the Task is given to exit after SIGTERM before it is killed with SIGKILL.
+	// A zero value falls back to the default of the Worker running the Task.
+	StopGracePeriod time.Duration
+
+	// TraceParent is the trace context of the request which queued the Task, and QueuedAt the time it
+	// was queued, so that the wait in the queue and the work done for the Task join the same trace.
+	// Both are local to a process, the trace context travels between processes in HTTP headers.
+	TraceParent string    `json:"-"`
+	QueuedAt    time.Time `json:"-"`
+
+	Logger *logger.Logger `json:"-"`
 }
 
 // Event represents a change in the Task state.
@@ -107,6 +160,12 @@ type Config struct {
 
 	// Image specifies the Image the Task should run.
 	Image string
+
+	// StopGracePeriod is the time between SIGTERM and SIGKILL when the container is stopped.
+	StopGracePeriod time.Duration
+
+	// NetworkMode is the Docker network mode of the container.
+	NetworkMode string
 }
 
 // Docker struct is used to run a task as a Docker container
@@ -121,7 +180,7 @@ type Docker struct {
 
 // DockerResult contains the result of the docker container execution
 type DockerResult struct {
-	// Error is used to hold error messages
+	// Error is the reason the action failed, with its errdefs.Code
 	Error error
 
 	// Action being taken, start, stop, etc
@@ -140,20 +199,28 @@ type DockerResult struct {
 // 3. Check if ImagePull was successful
 // 4. Return to standard output
 // Equivalent to `docker run` command
-func (d *Docker) Run() DockerResult {
-	ctx := context.Background()
+// The pull, create and start steps are traced as children of the span in ctx.
+func (d *Docker) Run(ctx context.Context) DockerResult {
 	d.Logger.Info("Pulling Docker image %s", d.Config.Image)
+	_, span := tracing.Default.Start(ctx, "docker.pull", tracing.WithAttributes("image", d.Config.Image))
 	reader, err := d.Client.ImagePull(ctx, d.Config.Image, image.PullOptions{})
 
 	if err != nil {
 		// log.Printf("Error pulling image %s: %v\n", d.Config.Image, err)
 		d.Logger.Error("Failed to pull image %s: %v", d.Config.Image, err)
-		return DockerResult{Error: err}
+		dockerErrors.Inc("pull")
+		span.RecordError(err)
+		span.End()
+		if client.IsErrConnectionFailed(err) {
+			return DockerResult{Error: runtimeError(err, "pulling image %s", d.Config.Image)}
+		}
+		return DockerResult{Error: errdefs.New(errdefs.ImagePullFailed, "pulling image %s: %w", d.Config.Image, err)}
 	}
 	_, err = io.Copy(os.Stdout, reader)
 	if err != nil {
 		d.Logger.Warn("Error copying image pull output: %v", err)
 	}
+	span.End()
 
 	// Required for host configuration
 	restartPolicy := container.RestartPolicy{
@@ -170,28 +237,45 @@ func (d *Docker) Run() DockerResult {
 		RestartPolicy:   restartPolicy,
 		Resources:       resources,
 		PublishAllPorts: true,
+		NetworkMode:     container.NetworkMode(d.Config.NetworkMode),
 	}
 
 	containerConfiguration := container.Config{
 		Image:        d.Config.Image,
 		Tty:          false,
 		Env:          d.Config.Env,
+		Cmd:          d.Config.Cmd,
 		ExposedPorts: d.Config.ExposedPorts,
 	}
 
+	// A container joining the network of another one cannot publish ports of its own,
+	// they have to be exposed by the container owning the network namespace.
+	if hostConfig.NetworkMode.IsContainer() {
+		hostConfig.PublishAllPorts = false
+		containerConfiguration.ExposedPorts = nil
+	}
+
 	d.Logger.Debug("Creating container for image %s", d.Config.Image)
+	_, span = tracing.Default.Start(ctx, "docker.create", tracing.WithAttributes("image", d.Config.Image))
 	resp, err := d.Client.ContainerCreate(ctx, &containerConfiguration, &hostConfig, nil, nil, d.Config.Name)
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		d.Logger.Error("Failed to create container %s: %v", d.Config.Image, err)
+		dockerErrors.Inc("create")
 		// log.Printf("Error creating container %s: %v\n", d.Config.Image, err)
-		return DockerResult{Error: err}
+		return DockerResult{Error: runtimeError(err, "creating container for image %s", d.Config.Image)}
 	}
 
 	d.Logger.Info("Starting container %s", resp.ID)
+	_, span = tracing.Default.Start(ctx, "docker.start", tracing.WithAttributes("container_id", resp.ID))
 	err = d.Client.ContainerStart(ctx, resp.ID, container.StartOptions{})
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		d.Logger.Error("Failed to start container %s: %v", resp.ID, err)
-		return DockerResult{Error: err}
+		dockerErrors.Inc("start")
+		return DockerResult{Error: runtimeError(err, "starting container %s", resp.ID)}
 	}
 
 	d.Logger.Info("Container %s started successfully", resp.ID)
@@ -212,13 +296,15 @@ func (d *Docker) Stop(id string) DockerResult {
 	_, err := d.Client.ContainerInspect(ctx, id)
 	if err != nil {
 		d.Logger.Warn("Container %s not found or error inspecting: %v", id, err)
-		return DockerResult{Action: "stop", Result: "container not found", Error: err}
+		dockerErrors.Inc("inspect")
+		return DockerResult{Action: "stop", Result: "container not found", Error: runtimeError(err, "inspecting container %s", id)}
 	}
 
-	err = d.Client.ContainerStop(ctx, id, container.StopOptions{})
+	err = d.Client.ContainerStop(ctx, id, d.stopOptions())
 	if err != nil {
 		d.Logger.Error("Error stopping container %s: %v\n", id, err)
-		return DockerResult{Error: err}
+		dockerErrors.Inc("stop")
+		return DockerResult{Error: runtimeError(err, "stopping container %s", id)}
 	}
 
 	err = d.Client.ContainerRemove(ctx, id, container.RemoveOptions{
@@ -228,37 +314,179 @@ func (d *Docker) Stop(id string) DockerResult {
 	})
 	if err != nil {
 		d.Logger.Error("Error removing container %s: %v\n", id, err)
-		return DockerResult{Error: err}
+		dockerErrors.Inc("remove")
+		return DockerResult{Error: runtimeError(err, "removing container %s", id)}
 	}
 
 	d.Logger.Info("Successfully stopped and removed container %s", id)
 	return DockerResult{Action: "stop", Result: "success", Error: nil}
 }
 
-func NewDocker(c *Config, logger *logger.Logger) *Docker {
+// stopOptions sends SIGTERM and gives the container StopGracePeriod to exit before Docker sends SIGKILL.
+// Without a grace period the Docker daemon default is used.
+func (d *Docker) stopOptions() container.StopOptions {
+	options := container.StopOptions{Signal: "SIGTERM"}
+	if d.Config.StopGracePeriod > 0 {
+		timeout := int(math.Ceil(d.Config.StopGracePeriod.Seconds()))
+		options.Timeout = &timeout
+	}
+	return options
+}
+
+// Update applies the memory and CPU limits and the restart policy of the config to a running
+// container, in place. Equivalent to `docker update` command
+// A zero Memory or Cpu leaves the current limit alone, Docker cannot lift a limit once set.
+func (d *Docker) Update(id string) DockerResult {
+	d.Logger.Info("Updating container %s", id)
+
+	update := container.UpdateConfig{
+		Resources: container.Resources{
+			Memory:   d.Config.Memory,
+			NanoCPUs: int64(d.Config.Cpu * math.Pow(10, 9)),
+		},
+		RestartPolicy: container.RestartPolicy{
+			Name: container.RestartPolicyMode(d.Config.RestartPolicy),
+		},
+	}
+	if d.Config.Memory > 0 {
+		// Keep the swap limit Docker gives a container created with a memory limit, it has to be
+		// above the new memory limit.
+		update.Resources.MemorySwap = 2 * d.Config.Memory
+	}
+
+	_, err := d.Client.ContainerUpdate(context.Background(), id, update)
+	if err != nil {
+		d.Logger.Error("Failed to update container %s: %v", id, err)
+		dockerErrors.Inc("update")
+		return DockerResult{Error: runtimeError(err, "updating container %s", id)}
+	}
+	return DockerResult{Action: "update", ContainerId: id, Result: "success"}
+}
+
+// Inspect returns the low-level information Docker holds about the container.
+// Equivalent to `docker inspect` command
+func (d *Docker) Inspect(id string) (types.ContainerJSON, error) {
+	ctx := context.Background()
+	resp, err := d.Client.ContainerInspect(ctx, id)
+	if err != nil {
+		d.Logger.Error("Error inspecting container %s: %v", id, err)
+		dockerErrors.Inc("inspect")
+		return types.ContainerJSON{}, runtimeError(err, "inspecting container %s", id)
+	}
+	return resp, nil
+}
+
+// Logs returns the output of the container as Docker sends it, stdout and stderr multiplexed, see
+// stdcopy.StdCopy. With options.Follow the stream stays open until the container exits or ctx is done.
+// Equivalent to `docker logs` command
+func (d *Docker) Logs(ctx context.Context, id string, options LogOptions) (io.ReadCloser, error) {
+	logs, err := d.Client.ContainerLogs(ctx, id, options.docker())
+	if err != nil {
+		d.Logger.Error("Error getting logs of container %s: %v", id, err)
+		dockerErrors.Inc("logs")
+		return nil, runtimeError(err, "getting logs of container %s", id)
+	}
+	return logs, nil
+}
+
+// Stats returns a resource usage sample of the container, including the previous CPU sample
+// needed to compute the CPU usage. Equivalent to `docker stats --no-stream` command
+func (d *Docker) Stats(id string) (container.StatsResponse, error) {
+	ctx := context.Background()
+	resp, err := d.Client.ContainerStats(ctx, id, false)
+	if err != nil {
+		d.Logger.Error("Error getting stats of container %s: %v", id, err)
+		dockerErrors.Inc("stats")
+		return container.StatsResponse{}, runtimeError(err, "getting stats of container %s", id)
+	}
+	defer resp.Body.Close()
+
+	stats := container.StatsResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		d.Logger.Error("Error decoding stats of container %s: %v", id, err)
+		return container.StatsResponse{}, err
+	}
+	return stats, nil
+}
+
+// DockerRootDir returns the directory where the Docker daemon keeps images and containers,
+// usually /var/lib/docker. Equivalent to `docker info --format '{{.DockerRootDir}}'` command
+func DockerRootDir() (string, error) {
+	dc, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		dockerErrors.Inc("client")
+		return "", err
+	}
+	defer dc.Close()
+
+	info, err := dc.Info(context.Background())
+	if err != nil {
+		dockerErrors.Inc("info")
+		return "", err
+	}
+	return info.DockerRootDir, nil
+}
+
+// NewDocker returns a Docker for the config with a client of its own, which the caller closes with
+// d.Client.Close(). Processes making many calls share one client instead, see NewDockerWithClient.
+func NewDocker(c *Config, logger *logger.Logger) (*Docker, error) {
+	dc, err := NewDockerClient(logger)
+	if err != nil {
+		return nil, err
+	}
+	return NewDockerWithClient(dc, c, logger), nil
+}
+
+// NewDockerClient returns a client of the Docker daemon of the environment. It fails with
+// errdefs.RuntimeUnavailable when no client can be created, e.g. because DOCKER_HOST is malformed.
+func NewDockerClient(logger *logger.Logger) (*client.Client, error) {
 	dc, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
 		logger.Error("Failed to create a Docker client: %v", err)
-		//
-		//TODO: think of something better error handling here
-		return nil
+		dockerErrors.Inc("client")
+		return nil, errdefs.New(errdefs.RuntimeUnavailable, "creating a Docker client: %w", err)
 	}
+	return dc, nil
+}
 
+// NewDockerWithClient returns a Docker for the config using dc, which may be shared and stays open.
+func NewDockerWithClient(dc *client.Client, c *Config, logger *logger.Logger) *Docker {
 	return &Docker{
 		Client: dc,
 		Config: *c,
-		Logger: logger,
+		Logger: logger.Named("docker"),
+	}
+}
+
+// runtimeError describes a failed call to the Docker API and gives it the errdefs.Code matching
+// what went wrong, Internal when nothing more specific applies.
+func runtimeError(err error, format string, args ...any) error {
+	code := errdefs.Internal
+	switch {
+	case client.IsErrConnectionFailed(err):
+		code = errdefs.RuntimeUnavailable
+	case dockererrdefs.IsNotFound(err):
+		code = errdefs.NotFound
+	case dockererrdefs.IsConflict(err):
+		code = errdefs.Conflict
+	case dockererrdefs.IsInvalidParameter(err):
+		code = errdefs.InvalidArgument
 	}
+	return errdefs.New(code, format+": %w", append(args, err)...)
 }
 
 func NewConfig(t *Task) *Config {
 	return &Config{
-		Name:          t.Name,
-		ExposedPorts:  t.ExposedPorts,
-		Image:         t.Image,
-		Cpu:           t.Cpu,
-		Memory:        int64(t.Memory),
-		Disk:          int64(t.Disk),
-		RestartPolicy: t.RestartPolicy,
+		Name:            t.Name,
+		ExposedPorts:    t.ExposedPorts,
+		Image:           t.Image,
+		Env:             t.Env,
+		Cmd:             t.Cmd,
+		Cpu:             t.Cpu,
+		Memory:          int64(t.Memory),
+		Disk:            int64(t.Disk),
+		RestartPolicy:   t.RestartPolicy,
+		StopGracePeriod: t.StopGracePeriod,
+		NetworkMode:     t.NetworkMode,
 	}
 }
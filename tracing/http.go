@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/praaatik/tesseract/middleware"
+)
+
+// TraceParentHeader carries the span context over HTTP, see https://www.w3.org/TR/trace-context/
+const TraceParentHeader = "traceparent"
+
+// TraceParent formats the span context of ctx as a traceparent value, empty if ctx has none.
+func TraceParent(ctx context.Context) string {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ContextWithTraceParent returns a context whose spans are children of the span described by the
+// traceparent value. ctx is returned as is when the value is empty or invalid.
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return ctx
+	}
+
+	var sc SpanContext
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return ctx
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.SpanID) {
+		return ctx
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return ctx
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&0x01 == 1
+	if !sc.IsValid() {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// Inject sets the traceparent header of an outgoing request from the span context of ctx.
+func Inject(ctx context.Context, h http.Header) {
+	if tp := TraceParent(ctx); tp != "" {
+		h.Set(TraceParentHeader, tp)
+	}
+}
+
+// Extract returns a context carrying the span context of the traceparent header of an incoming request.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return ContextWithTraceParent(ctx, h.Get(TraceParentHeader))
+}
+
+// Instrument wraps an API router so that every request gets a server span, a child of the span of
+// the caller when the request has a traceparent header. Handlers find the span context in r.Context().
+// The span is named after the route, as metrics.Instrument labels requests.
+func Instrument(t *Tracer, component string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), r.Header)
+		ctx, span := t.Start(ctx, r.Method, WithKind(KindServer), WithAttributes(
+			"component", component,
+			"http.request.method", r.Method,
+			"url.path", r.URL.Path,
+		))
+		defer span.End()
+
+		sw := middleware.NewStatusWriter(w)
+		r = r.WithContext(ctx)
+		next.ServeHTTP(sw, r)
+
+		if r.Pattern != "" {
+			span.Name = r.Pattern
+			span.SetAttributes("http.route", r.Pattern)
+		}
+		span.SetAttributes("http.response.status_code", sw.Status)
+		if sw.Status >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("%s", http.StatusText(sw.Status)))
+		}
+	})
+}
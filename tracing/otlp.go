@@ -0,0 +1,236 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/praaatik/tesseract/logger"
+)
+
+// OTLPExporter batches ended spans and sends them to an OpenTelemetry collector with OTLP/HTTP,
+// JSON encoded. Spans are sent every FlushInterval, or as soon as MaxBatch of them are waiting.
+type OTLPExporter struct {
+	// Endpoint is the base URL of the collector, e.g. http://localhost:4318; spans go to /v1/traces
+	Endpoint string
+
+	// Service is the service.name of the exported spans
+	Service string
+
+	FlushInterval time.Duration
+	MaxBatch      int
+	Client        *http.Client
+
+	// Logger reports the batches which could not be sent
+	Logger *logger.Logger
+
+	mu      sync.Mutex
+	pending []*Span
+	flush   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewOTLPExporter creates an exporter to the collector at endpoint and starts sending spans.
+// The batches which cannot be sent are reported to logger.
+func NewOTLPExporter(endpoint string, service string, logger *logger.Logger) *OTLPExporter {
+	e := &OTLPExporter{
+		Endpoint:      strings.TrimSuffix(endpoint, "/"),
+		Service:       service,
+		FlushInterval: 5 * time.Second,
+		MaxBatch:      512,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		Logger:        logger,
+		flush:         make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// ExportSpan queues an ended span. The oldest spans are dropped when the collector cannot keep up.
+func (e *OTLPExporter) ExportSpan(s *Span) {
+	e.mu.Lock()
+	e.pending = append(e.pending, s)
+	if overflow := len(e.pending) - 8*e.MaxBatch; overflow > 0 {
+		e.pending = e.pending[overflow:]
+	}
+	full := len(e.pending) >= e.MaxBatch
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown sends the queued spans and stops the exporter, giving up when ctx is done.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	close(e.done)
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(e.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.done:
+			e.send()
+			return
+		}
+		e.send()
+	}
+}
+
+// send posts the queued spans in batches of MaxBatch. A failed batch is logged and dropped.
+func (e *OTLPExporter) send() {
+	e.mu.Lock()
+	spans := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+
+	for len(spans) > 0 {
+		batch := spans[:min(e.MaxBatch, len(spans))]
+		spans = spans[len(batch):]
+		if err := e.post(batch); err != nil {
+			e.Logger.Error("Error exporting %d spans to %s: %v", len(batch), e.Endpoint, err)
+		}
+	}
+}
+
+func (e *OTLPExporter) post(spans []*Span) error {
+	data, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.Client.Post(e.Endpoint+"/v1/traces", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The types below are the JSON encoding of an OTLP ExportTraceServiceRequest.
+// IDs are hex encoded and times are nanoseconds since the epoch, as strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func (e *OTLPExporter) request(spans []*Span) otlpRequest {
+	encoded := []otlpSpan{}
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Status:            otlpStatus{Code: s.Status, Message: s.Message},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		for _, a := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpAttr(a.Key, a.Value))
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{otlpAttr("service.name", e.Service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/praaatik/tesseract/tracing"}, Spans: encoded}},
+	}}}
+}
+
+// otlpAttr encodes a value as an OTLP AnyValue, 64-bit integers are strings in the JSON encoding.
+func otlpAttr(key string, value any) otlpAttribute {
+	var v map[string]any
+	switch value := value.(type) {
+	case string:
+		v = map[string]any{"stringValue": value}
+	case bool:
+		v = map[string]any{"boolValue": value}
+	case int:
+		v = map[string]any{"intValue": strconv.FormatInt(int64(value), 10)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(value, 10)}
+	case uint64:
+		v = map[string]any{"intValue": strconv.FormatUint(value, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": value}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(value)}
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
@@ -0,0 +1,251 @@
+// Package tracing records OpenTelemetry compatible spans, propagates their context in W3C traceparent
+// headers and exports them over OTLP/HTTP, which is all tesseract needs, without pulling in the
+// OpenTelemetry SDK.
+
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Default is the tracer of the manager and the worker. It records spans but only exports them
+// once an exporter is set with SetExporter.
+var Default = NewTracer()
+
+// TraceID identifies a trace, the spans of one request across processes.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span which is propagated to its children, across processes too.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind is the role of a span in a request, with the values of OTLP.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// StatusCode is the outcome of a span, with the values of OTLP.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOk    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key/value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	SpanContext
+	Parent     SpanID
+	Name       string
+	Kind       Kind
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes []Attribute
+	Status     StatusCode
+	Message    string
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// Option configures a span when it starts.
+type Option func(s *Span)
+
+// WithKind sets the kind of the span, internal by default.
+func WithKind(k Kind) Option {
+	return func(s *Span) { s.Kind = k }
+}
+
+// WithStartTime starts the span in the past, e.g. when a task was put on a queue.
+func WithStartTime(t time.Time) Option {
+	return func(s *Span) {
+		if !t.IsZero() {
+			s.StartTime = t
+		}
+	}
+}
+
+// WithAttributes adds key/value pairs to the span, as SetAttributes does.
+func WithAttributes(kv ...any) Option {
+	return func(s *Span) { s.Attributes = append(s.Attributes, attributes(kv)...) }
+}
+
+// SetAttributes adds key/value pairs to the span, e.g. SetAttributes("task_id", t.ID, "worker", name).
+func (s *Span) SetAttributes(kv ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes = append(s.Attributes, attributes(kv)...)
+}
+
+// RecordError marks the span as failed with err, nil errors are ignored.
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Status = StatusError
+	s.Message = err.Error()
+}
+
+// End ends the span and hands it to the exporter of its tracer. Only the first call has an effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	if s.Sampled {
+		s.tracer.export(s)
+	}
+}
+
+func attributes(kv []any) []Attribute {
+	attrs := []Attribute{}
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 == len(kv) {
+			attrs = append(attrs, Attribute{Key: "!BADKEY", Value: kv[i]})
+			break
+		}
+		attrs = append(attrs, Attribute{Key: fmt.Sprint(kv[i]), Value: kv[i+1]})
+	}
+	return attrs
+}
+
+// Exporter sends ended spans somewhere, such as an OTLP collector.
+type Exporter interface {
+	ExportSpan(s *Span)
+}
+
+// Tracer creates spans and hands the ended ones to its exporter.
+type Tracer struct {
+	mu       sync.RWMutex
+	exporter Exporter
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{}
+}
+
+// SetExporter sets where the ended spans go, nil drops them.
+func (t *Tracer) SetExporter(e Exporter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.exporter = e
+}
+
+func (t *Tracer) export(s *Span) {
+	t.mu.RLock()
+	e := t.exporter
+	t.mu.RUnlock()
+	if e != nil {
+		e.ExportSpan(s)
+	}
+}
+
+// Start starts a span as a child of the span in ctx, or of a new trace if there is none,
+// and returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...Option) (context.Context, *Span) {
+	s := &Span{
+		Name:      name,
+		Kind:      KindInternal,
+		StartTime: time.Now(),
+		tracer:    t,
+	}
+
+	parent := SpanContextFromContext(ctx)
+	if parent.IsValid() {
+		s.TraceID = parent.TraceID
+		s.Parent = parent.SpanID
+		s.Sampled = parent.Sampled
+	} else {
+		s.TraceID = newTraceID()
+		s.Sampled = true
+	}
+	s.SpanID = newSpanID()
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	return ContextWithSpanContext(ctx, s.SpanContext), s
+}
+
+type contextKey struct{}
+
+// ContextWithSpanContext returns a context whose spans are children of sc.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, an invalid one if there is none.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(contextKey{}).(SpanContext)
+	return sc
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		for i := range id {
+			id[i] = byte(rand.Uint32())
+		}
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		for i := range id {
+			id[i] = byte(rand.Uint32())
+		}
+	}
+	return id
+}
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+// AdmitTask normalizes a submitted Event, see task.Event.Normalize, and checks it, rejecting the ID
+// of a Task the Worker already has, queued or run. A Worker only starts Scheduled Tasks.
+func (w *Worker) AdmitTask(te *task.Event) error {
+	te.Normalize()
+	if err := te.Validate(); err != nil {
+		return err
+	}
+	if te.Task.State != task.Scheduled {
+		return errdefs.Invalid([]errdefs.FieldViolation{{
+			Field:       "Task.State",
+			Description: fmt.Sprintf("must be scheduled for a task sent to a worker, got %s", te.Task.State),
+		}})
+	}
+
+	w.mu.RLock()
+	exists := w.knownTask(te.Task.ID)
+	w.mu.RUnlock()
+	if exists {
+		return duplicateTask(te.Task.ID)
+	}
+	return nil
+}
+
+// SubmitTask admits the Event, see AdmitTask, and queues its Task like AddTask. It returns the Task
+// as queued.
+func (w *Worker) SubmitTask(te task.Event) (*task.Task, error) {
+	if err := w.AdmitTask(&te); err != nil {
+		return nil, err
+	}
+
+	t := te.Task
+	w.mu.Lock()
+	// Another submission of the same ID may have come in since it was admitted.
+	if w.knownTask(t.ID) {
+		w.mu.Unlock()
+		return nil, duplicateTask(t.ID)
+	}
+	if w.admitted == nil {
+		w.admitted = make(map[uuid.UUID]bool)
+	}
+	w.admitted[t.ID] = true
+	w.mu.Unlock()
+
+	w.AddTask(t)
+	return &t, nil
+}
+
+// SubmitGroup admits every Task of the Group like AdmitTask, and queues the Group like AddGroup.
+// Nothing is queued unless every Task is admitted, the error then lists the invalid fields of all
+// of them. It returns the Group as queued.
+func (w *Worker) SubmitGroup(g task.Group) (*task.Group, error) {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	g.State = task.Scheduled
+
+	violations := []errdefs.FieldViolation{}
+	ids := map[uuid.UUID]bool{}
+	for i := range g.Tasks {
+		t := &g.Tasks[i]
+		t.GroupID = g.ID
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("%s-%d", g.Name, i)
+		}
+		t.SetState(task.Scheduled, "")
+
+		te := task.Event{State: task.Scheduled, Task: *t}
+		err := w.AdmitTask(&te)
+		*t = te.Task
+		if errdefs.Is(err, errdefs.AlreadyExists) {
+			return nil, err
+		}
+		for _, v := range errdefs.FieldsOf(err) {
+			v.Field = fmt.Sprintf("Tasks[%d].%s", i, strings.TrimPrefix(v.Field, "Task."))
+			violations = append(violations, v)
+		}
+		if ids[t.ID] {
+			violations = append(violations, errdefs.FieldViolation{
+				Field:       fmt.Sprintf("Tasks[%d].ID", i),
+				Description: "is the ID of another task of the group",
+			})
+		}
+		ids[t.ID] = true
+	}
+	if len(violations) > 0 {
+		return nil, errdefs.Invalid(violations)
+	}
+
+	w.mu.Lock()
+	// Another submission of the same IDs may have come in since they were admitted.
+	if _, exists := w.GroupDb[g.ID]; exists || w.admitted[g.ID] {
+		w.mu.Unlock()
+		return nil, errdefs.New(errdefs.AlreadyExists, "group %v already exists", g.ID)
+	}
+	for _, t := range g.Tasks {
+		if w.knownTask(t.ID) {
+			w.mu.Unlock()
+			return nil, duplicateTask(t.ID)
+		}
+	}
+	if w.admitted == nil {
+		w.admitted = make(map[uuid.UUID]bool)
+	}
+	w.admitted[g.ID] = true
+	for _, t := range g.Tasks {
+		w.admitted[t.ID] = true
+	}
+	w.mu.Unlock()
+
+	w.AddGroup(g)
+	return &g, nil
+}
+
+// knownTask reports whether the Task with the given ID was run or is waiting in the queue. The
+// caller holds w.mu.
+func (w *Worker) knownTask(id uuid.UUID) bool {
+	_, exists := w.TaskDb[id]
+	return exists || w.admitted[id]
+}
+
+// persistTask returns the stored copy of a Task taken off the queue, storing t first when the
+// Worker does not have it yet.
+func (w *Worker) persistTask(t task.Task) task.Task {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.admitted, t.ID)
+	if stored, ok := w.TaskDb[t.ID]; ok {
+		return *stored
+	}
+	w.TaskDb[t.ID] = &t
+	return t
+}
+
+func duplicateTask(id uuid.UUID) error {
+	return &errdefs.Error{
+		Code:    errdefs.AlreadyExists,
+		Message: fmt.Sprintf("task %v already exists", id),
+		Fields:  []errdefs.FieldViolation{{Field: "Task.ID", Description: "is the ID of an existing task"}},
+	}
+}
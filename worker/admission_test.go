@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/golang-collections/collections/queue"
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+func TestSubmitTask(t *testing.T) {
+	w := &Worker{TaskQueue: queue.New(), TaskDb: make(map[uuid.UUID]*task.Task), Logger: testLogger}
+	ran := uuid.New()
+	waiting := uuid.New()
+	if _, err := w.SubmitTask(task.Event{State: task.Scheduled, Task: task.Task{ID: ran, State: task.Scheduled, Image: "nginx"}}); err != nil {
+		t.Fatalf("SubmitTask() error = %v", err)
+	}
+	if _, err := w.SubmitTask(task.Event{State: task.Scheduled, Task: task.Task{ID: waiting, State: task.Scheduled, Image: "nginx"}}); err != nil {
+		t.Fatalf("SubmitTask() error = %v", err)
+	}
+	// The first Task leaves the queue for TaskDb.
+	w.persistTask(w.dequeue().(task.Task))
+
+	tests := []struct {
+		name     string
+		event    task.Event
+		wantCode errdefs.Code
+	}{
+		{
+			name:  "new task",
+			event: task.Event{State: task.Scheduled, Task: task.Task{State: task.Scheduled, Image: "nginx"}},
+		},
+		{
+			name:     "invalid spec",
+			event:    task.Event{State: task.Scheduled, Task: task.Task{State: task.Scheduled}},
+			wantCode: errdefs.InvalidArgument,
+		},
+		{
+			// The worker would never start it, pending is the state of a task the manager has not sent yet.
+			name:     "pending task",
+			event:    task.Event{State: task.Scheduled, Task: task.Task{State: task.Pending, Image: "nginx"}},
+			wantCode: errdefs.InvalidArgument,
+		},
+		{
+			name:     "task already run",
+			event:    task.Event{State: task.Scheduled, Task: task.Task{ID: ran, State: task.Scheduled, Image: "nginx"}},
+			wantCode: errdefs.AlreadyExists,
+		},
+		{
+			name:     "task still queued",
+			event:    task.Event{State: task.Scheduled, Task: task.Task{ID: waiting, State: task.Scheduled, Image: "nginx"}},
+			wantCode: errdefs.AlreadyExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			te := tt.event
+			err := w.AdmitTask(&te)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("AdmitTask() error = %v", err)
+				}
+				if te.Task.ID == uuid.Nil || te.Task.Name == "" || te.Task.RestartPolicy != task.DefaultRestartPolicy {
+					t.Errorf("AdmitTask() left the defaults out: %+v", te.Task)
+				}
+				return
+			}
+			if !errdefs.Is(err, tt.wantCode) {
+				t.Fatalf("AdmitTask() error = %v, want %s", err, tt.wantCode)
+			}
+			if _, err := w.SubmitTask(tt.event); !errdefs.Is(err, tt.wantCode) {
+				t.Errorf("SubmitTask() error = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+
+	if n := w.QueueLen(); n != 1 {
+		t.Errorf("QueueLen() = %d, want only the second task queued", n)
+	}
+}
+
+func TestSubmitGroup(t *testing.T) {
+	existing := task.Task{ID: uuid.New(), State: task.Running, Image: "nginx"}
+	w := &Worker{
+		TaskQueue: queue.New(),
+		TaskDb:    map[uuid.UUID]*task.Task{existing.ID: &existing},
+		GroupDb:   make(map[uuid.UUID]*GroupRecord),
+		Logger:    testLogger,
+	}
+	dup := uuid.New()
+
+	tests := []struct {
+		name      string
+		tasks     []task.Task
+		wantCode  errdefs.Code
+		wantField string
+	}{
+		{
+			// A member must not overwrite the record of a task the worker already has.
+			name:     "existing task",
+			tasks:    []task.Task{{Image: "nginx"}, {ID: existing.ID, Image: "redis"}},
+			wantCode: errdefs.AlreadyExists,
+		},
+		{
+			name:      "invalid member",
+			tasks:     []task.Task{{Image: "nginx"}, {}},
+			wantCode:  errdefs.InvalidArgument,
+			wantField: "Tasks[1].Image",
+		},
+		{
+			name:      "duplicate IDs",
+			tasks:     []task.Task{{ID: dup, Image: "nginx"}, {ID: dup, Image: "redis"}},
+			wantCode:  errdefs.InvalidArgument,
+			wantField: "Tasks[1].ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := w.SubmitGroup(task.Group{Name: "web", Tasks: tt.tasks})
+			if !errdefs.Is(err, tt.wantCode) {
+				t.Fatalf("SubmitGroup() error = %v, want %s", err, tt.wantCode)
+			}
+			if tt.wantField != "" && !slices.ContainsFunc(errdefs.FieldsOf(err), func(v errdefs.FieldViolation) bool {
+				return v.Field == tt.wantField
+			}) {
+				t.Errorf("SubmitGroup() fields = %v, want %s", errdefs.FieldsOf(err), tt.wantField)
+			}
+			if n := w.QueueLen(); n != 0 {
+				t.Errorf("QueueLen() = %d, want nothing queued", n)
+			}
+			if got := w.TaskDb[existing.ID]; got.Image != "nginx" || got.State != task.Running {
+				t.Errorf("TaskDb[%v] = %+v, want it unchanged", existing.ID, got)
+			}
+		})
+	}
+
+	g, err := w.SubmitGroup(task.Group{Name: "web", Tasks: []task.Task{{Image: "nginx"}, {Image: "redis"}}})
+	if err != nil {
+		t.Fatalf("SubmitGroup() error = %v", err)
+	}
+	for i, member := range g.Tasks {
+		if member.GroupID != g.ID || member.State != task.Scheduled || member.Name != fmt.Sprintf("web-%d", i) {
+			t.Errorf("SubmitGroup() member %d = %+v", i, member)
+		}
+	}
+	if _, err := w.SubmitGroup(*g); !errdefs.Is(err, errdefs.AlreadyExists) {
+		t.Errorf("SubmitGroup() of a queued group error = %v, want %s", err, errdefs.AlreadyExists)
+	}
+	if n := w.QueueLen(); n != 1 {
+		t.Errorf("QueueLen() = %d, want the group queued once", n)
+	}
+}
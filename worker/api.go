@@ -1,15 +1,37 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	v1 "github.com/praaatik/tesseract/api/v1"
+	"github.com/praaatik/tesseract/audit"
+	"github.com/praaatik/tesseract/errdefs"
 	"github.com/praaatik/tesseract/logger"
+	"github.com/praaatik/tesseract/metrics"
+	"github.com/praaatik/tesseract/tracing"
 )
 
+// NextCursorHeader carries the cursor of the next page of the unversioned task listing, whose body
+// is a bare list.
+const NextCursorHeader = "X-Next-Cursor"
+
+// eventsInterval is how often GET /events looks for changes of state.
+const eventsInterval = time.Second
+
+// ErrResponse is the body of every error response of the unversioned routes.
 type ErrResponse struct {
 	HTTPStatusCode int
-	Message        string
+
+	// Code is the errdefs.Code of the error, which clients can match on
+	Code    errdefs.Code
+	Message string
+
+	// Fields are the fields of the request which failed validation, when the error is about them
+	Fields []errdefs.FieldViolation `json:",omitempty"`
 }
 
 type Api struct {
@@ -18,6 +40,12 @@ type Api struct {
 	Worker  *Worker
 	Logger  *logger.Logger
 	Router  *http.ServeMux
+
+	// Audit records the calls which change state, none are recorded when it is nil
+	Audit *audit.Log
+
+	// server is the HTTP server started by Start, kept around to shut it down.
+	server *http.Server
 }
 
 func (a *Api) initRouter() {
@@ -29,14 +57,89 @@ func (a *Api) initRouter() {
 	// Getting new tasks
 	a.Router.HandleFunc("GET /tasks", a.GetTasksHandler)
 
+	// A single task, with the status of its container
+	a.Router.HandleFunc("GET /tasks/{taskID}", a.GetTaskHandler)
+
+	// Updating running tasks
+	a.Router.HandleFunc("PATCH /tasks/{taskID}", a.PatchTaskHandler)
+
 	// Stopping tasks (deleting)
 	a.Router.HandleFunc("DELETE /tasks/{taskID}", a.StopTaskHandler)
 
+	// Resource usage of a single task
+	a.Router.HandleFunc("GET /tasks/{taskID}/stats", a.TaskStatsHandler)
+
+	// Streaming the output of tasks and their changes of state
+	a.Router.HandleFunc("GET /tasks/{taskID}/logs", a.GetTaskLogsHandler)
+	a.Router.HandleFunc("GET /events", a.GetEventsHandler)
+
+	// Task groups
+	a.Router.HandleFunc("POST /groups", a.StartGroupHandler)
+	a.Router.HandleFunc("GET /groups", a.GetGroupsHandler)
+	a.Router.HandleFunc("GET /groups/{groupID}", a.GetGroupHandler)
+	a.Router.HandleFunc("DELETE /groups/{groupID}", a.StopGroupHandler)
+
 	// Get the statistics
 	a.Router.HandleFunc("/stats", a.StatsHandler)
+	a.Router.HandleFunc("GET /stats/history", a.StatsHistoryHandler)
+
+	// Version 1 of the API, see package v1 for its compatibility policy. The routes above
+	// encode the internal types as they are, they are kept for existing clients.
+	a.Router.HandleFunc("POST /v1/tasks", a.StartTaskV1Handler)
+	a.Router.HandleFunc("GET /v1/tasks", a.GetTasksV1Handler)
+	a.Router.HandleFunc("GET /v1/tasks/{taskID}", a.GetTaskV1Handler)
+	a.Router.HandleFunc("PATCH /v1/tasks/{taskID}", a.PatchTaskV1Handler)
+	a.Router.HandleFunc("DELETE /v1/tasks/{taskID}", a.StopTaskV1Handler)
+	a.Router.HandleFunc("GET /v1/tasks/{taskID}/stats", a.TaskStatsV1Handler)
+	a.Router.HandleFunc("POST /v1/groups", a.StartGroupV1Handler)
+	a.Router.HandleFunc("GET /v1/groups", a.GetGroupsV1Handler)
+	a.Router.HandleFunc("GET /v1/groups/{groupID}", a.GetGroupV1Handler)
+	a.Router.HandleFunc("DELETE /v1/groups/{groupID}", a.StopGroupV1Handler)
+	a.Router.HandleFunc("GET /v1/stats", a.StatsV1Handler)
+	a.Router.HandleFunc("GET /v1/openapi.json", v1.OpenAPIHandler())
+
+	// Log levels of the components, adjustable at runtime
+	logLevels := logger.LevelsHandler(a.Logger, writeError)
+	a.Router.HandleFunc("GET /admin/loglevels", logLevels)
+	a.Router.HandleFunc("PUT /admin/loglevels", logLevels)
+
+	// Audit trail of the calls which changed state
+	if a.Audit != nil {
+		a.Router.HandleFunc("GET /audit", audit.Handler(a.Audit, writeError))
+	}
+
+	// Prometheus metrics
+	a.Router.HandleFunc("GET /metrics", metrics.Handler(metrics.Default))
+	if err := a.Worker.registerMetrics(metrics.Default); err != nil {
+		a.Logger.Warn("Worker metrics not registered: %v", err)
+	}
 }
 
-func (a *Api) Start() {
+// Start serves the API until Shutdown is called. It only returns an error when the server fails.
+func (a *Api) Start() error {
 	a.initRouter()
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	var handler http.Handler = a.Router
+	if a.Audit != nil {
+		handler = audit.Instrument(a.Audit, "worker", handler)
+	}
+	a.server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", a.Address, a.Port),
+		Handler: tracing.Instrument(tracing.Default, "worker", metrics.Instrument("worker", handler)),
+	}
+
+	a.Logger.Info("Worker API listening on %s", a.server.Addr)
+	err := a.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to finish or ctx to be done.
+func (a *Api) Shutdown(ctx context.Context) error {
+	if a.server == nil {
+		return nil
+	}
+	a.Logger.Info("Shutting down worker API")
+	return a.server.Shutdown(ctx)
 }
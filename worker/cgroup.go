@@ -0,0 +1,271 @@
+package worker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsPaths tells GetStats where procfs and the cgroup filesystem are mounted. A worker running in a
+// container can point Proc to the /proc of the host, and both can point to fixture files.
+type StatsPaths struct {
+	// Proc is the mount point of procfs, /proc when empty
+	Proc string
+
+	// Cgroup is the mount point of the cgroup filesystem, /sys/fs/cgroup when empty
+	Cgroup string
+}
+
+func (p StatsPaths) proc(name ...string) string {
+	root := p.Proc
+	if root == "" {
+		root = "/proc"
+	}
+	return filepath.Join(append([]string{root}, name...)...)
+}
+
+func (p StatsPaths) cgroup(name ...string) string {
+	root := p.Cgroup
+	if root == "" {
+		root = "/sys/fs/cgroup"
+	}
+	return filepath.Join(append([]string{root}, name...)...)
+}
+
+// CgroupStats are the limits and usage of the cgroup the worker runs in.
+type CgroupStats struct {
+	// Version is 1 or 2
+	Version int
+
+	// MemoryLimit is the memory limit in bytes, 0 when the cgroup has none
+	MemoryLimit uint64
+
+	// MemoryUsage is the memory used by the cgroup in bytes, without the inactive page cache
+	MemoryUsage uint64
+
+	// CpuLimit is the number of CPU cores the cgroup may use, 0 when it has no quota
+	CpuLimit float64
+
+	// CpuUsage is the CPU time used by the cgroup since it was created
+	CpuUsage time.Duration
+}
+
+// Capacity is the memory and CPU the worker can effectively use, taking the cgroup limits into account.
+type Capacity struct {
+	// Source is "host" when the capacity comes from /proc, "cgroup v1" or "cgroup v2" otherwise
+	Source string
+
+	CpuCores       float64
+	MemTotalKb     uint64
+	MemAvailableKb uint64
+}
+
+// unlimited is the smallest value cgroup v1 reports for a memory limit which was never set,
+// the largest page aligned int64.
+const unlimited = 1 << 62
+
+// GetCgroupStats reads the limits and usage of the cgroup of the worker process.
+// It returns nil when the cgroup cannot be read, the statistics then come from /proc only.
+func GetCgroupStats(paths StatsPaths) *CgroupStats {
+	memberships, err := readCgroupMemberships(paths.proc("self", "cgroup"))
+	if err != nil {
+		return nil
+	}
+
+	if _, err := os.Stat(paths.cgroup("cgroup.controllers")); err == nil {
+		stats, err := readCgroupV2(paths, memberships[""])
+		if err != nil {
+			return nil
+		}
+		return stats
+	}
+
+	stats, err := readCgroupV1(paths, memberships)
+	if err != nil {
+		return nil
+	}
+	return stats
+}
+
+// readCgroupMemberships parses /proc/self/cgroup into the cgroup path of each controller.
+// The cgroup v2 path is keyed by the empty string.
+func readCgroupMemberships(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	memberships := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[1] == "" {
+			memberships[""] = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			memberships[controller] = fields[2]
+		}
+	}
+	return memberships, scanner.Err()
+}
+
+// cgroupDir returns the directory of the cgroup at path under root. When the worker runs in a
+// cgroup namespace, or the path is not mounted, the files are at the root of the hierarchy.
+func cgroupDir(root string, path string, file string) string {
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+		return dir
+	}
+	return root
+}
+
+func readCgroupV2(paths StatsPaths, path string) (*CgroupStats, error) {
+	dir := cgroupDir(paths.cgroup(), path, "memory.max")
+	stats := &CgroupStats{Version: 2}
+
+	if limit, err := readCgroupValue(filepath.Join(dir, "memory.max")); err == nil {
+		stats.MemoryLimit = limit
+	}
+	current, err := readCgroupValue(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return nil, err
+	}
+	inactive, _ := readCgroupStat(filepath.Join(dir, "memory.stat"), "inactive_file")
+	stats.MemoryUsage = current - min(inactive, current)
+
+	if b, err := os.ReadFile(filepath.Join(dir, "cpu.max")); err == nil {
+		// $MAX $PERIOD, where $MAX is "max" without a quota
+		fields := strings.Fields(string(b))
+		if len(fields) == 2 && fields[0] != "max" {
+			quota, _ := strconv.ParseFloat(fields[0], 64)
+			period, _ := strconv.ParseFloat(fields[1], 64)
+			if period > 0 {
+				stats.CpuLimit = quota / period
+			}
+		}
+	}
+	if usage, err := readCgroupStat(filepath.Join(dir, "cpu.stat"), "usage_usec"); err == nil {
+		stats.CpuUsage = time.Duration(usage) * time.Microsecond
+	}
+	return stats, nil
+}
+
+func readCgroupV1(paths StatsPaths, memberships map[string]string) (*CgroupStats, error) {
+	path, ok := memberships["memory"]
+	if !ok {
+		return nil, errors.New("no memory controller in cgroup v1 hierarchy")
+	}
+	stats := &CgroupStats{Version: 1}
+
+	memory := cgroupDir(paths.cgroup("memory"), path, "memory.usage_in_bytes")
+	if limit, err := readCgroupValue(filepath.Join(memory, "memory.limit_in_bytes")); err == nil && limit < unlimited {
+		stats.MemoryLimit = limit
+	}
+	usage, err := readCgroupValue(filepath.Join(memory, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+	inactive, _ := readCgroupStat(filepath.Join(memory, "memory.stat"), "total_inactive_file")
+	stats.MemoryUsage = usage - min(inactive, usage)
+
+	cpu := cgroupDir(paths.cgroup("cpu"), memberships["cpu"], "cpu.cfs_quota_us")
+	quota, err := os.ReadFile(filepath.Join(cpu, "cpu.cfs_quota_us"))
+	if err == nil && strings.TrimSpace(string(quota)) != "-1" {
+		q, _ := strconv.ParseFloat(strings.TrimSpace(string(quota)), 64)
+		period, _ := readCgroupValue(filepath.Join(cpu, "cpu.cfs_period_us"))
+		if period > 0 {
+			stats.CpuLimit = q / float64(period)
+		}
+	}
+
+	cpuacct := cgroupDir(paths.cgroup("cpuacct"), memberships["cpuacct"], "cpuacct.usage")
+	if usage, err := readCgroupValue(filepath.Join(cpuacct, "cpuacct.usage")); err == nil {
+		stats.CpuUsage = time.Duration(usage)
+	}
+	return stats, nil
+}
+
+// readCgroupValue reads a file holding a single number, "max" reads as 0 for no limit.
+func readCgroupValue(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(b))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readCgroupStat reads the value of key from a flat keyed file such as memory.stat or cpu.stat.
+func readCgroupStat(path string, key string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no %s in %s", key, path)
+}
+
+// capacity returns the effective capacity of the worker: the cgroup limits when they are lower
+// than what the host has, the host resources otherwise.
+func (s *Stats) capacity() *Capacity {
+	c := &Capacity{
+		Source:         "host",
+		CpuCores:       float64(len(s.Cores)),
+		MemTotalKb:     s.MemStats.MemTotal,
+		MemAvailableKb: s.MemStats.MemAvailable,
+	}
+
+	cg := s.Cgroup
+	if cg == nil {
+		return c
+	}
+	source := fmt.Sprintf("cgroup v%d", cg.Version)
+
+	if cg.CpuLimit > 0 && (c.CpuCores == 0 || cg.CpuLimit < c.CpuCores) {
+		c.CpuCores = cg.CpuLimit
+		c.Source = source
+	}
+	if limitKb := cg.MemoryLimit / 1024; limitKb > 0 && (c.MemTotalKb == 0 || limitKb < c.MemTotalKb) {
+		c.MemTotalKb = limitKb
+		c.MemAvailableKb = limitKb - min(cg.MemoryUsage/1024, limitKb)
+		if s.MemStats.MemAvailable > 0 {
+			c.MemAvailableKb = min(c.MemAvailableKb, s.MemStats.MemAvailable)
+		}
+		c.Source = source
+	}
+	return c
+}
+
+// cgroupCpuUtilization is the share (0.0 to 1.0) of the CPU quota of the cgroup used between two samples.
+func cgroupCpuUtilization(prev *CgroupStats, cur *CgroupStats, elapsed time.Duration) float64 {
+	if prev == nil || cur.CpuLimit <= 0 || elapsed <= 0 || cur.CpuUsage < prev.CpuUsage {
+		return 0
+	}
+	cores := float64(cur.CpuUsage-prev.CpuUsage) / float64(elapsed)
+	return min(cores/cur.CpuLimit, 1)
+}
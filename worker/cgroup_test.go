@@ -0,0 +1,312 @@
+package worker
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c9s/goprocinfo/linux"
+)
+
+// fixture returns the StatsPaths of a directory of testdata holding a proc and a cgroup tree.
+func fixture(name string) StatsPaths {
+	return StatsPaths{
+		Proc:   filepath.Join("testdata", name, "proc"),
+		Cgroup: filepath.Join("testdata", name, "cgroup"),
+	}
+}
+
+func TestGetCgroupStats(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    *CgroupStats
+	}{
+		{
+			fixture: "cgroup-v2",
+			want: &CgroupStats{
+				Version:     2,
+				MemoryLimit: 512 << 20,
+				MemoryUsage: 200<<20 - 10<<20,
+				CpuLimit:    1.5,
+				CpuUsage:    2500 * time.Millisecond,
+			},
+		},
+		{
+			// The cgroup of the worker is not mounted, its files are at the root, without limits.
+			fixture: "cgroup-v2-namespace",
+			want: &CgroupStats{
+				Version:     2,
+				MemoryLimit: 0,
+				MemoryUsage: 100<<20 - 4<<20,
+				CpuLimit:    0,
+				CpuUsage:    time.Millisecond,
+			},
+		},
+		{
+			fixture: "cgroup-v1",
+			want: &CgroupStats{
+				Version:     1,
+				MemoryLimit: 256 << 20,
+				MemoryUsage: 128<<20 - 16<<20,
+				CpuLimit:    0.5,
+				CpuUsage:    3 * time.Second,
+			},
+		},
+		{
+			// A memory limit which was never set and a quota of -1 are no limits.
+			fixture: "cgroup-v1-unlimited",
+			want: &CgroupStats{
+				Version:     1,
+				MemoryLimit: 0,
+				MemoryUsage: 1 << 30,
+				CpuLimit:    0,
+				CpuUsage:    42,
+			},
+		},
+		{
+			fixture: "missing",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got := GetCgroupStats(fixture(tt.fixture))
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("GetCgroupStats() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("GetCgroupStats() = nil, want %+v", tt.want)
+			}
+			if *got != *tt.want {
+				t.Errorf("GetCgroupStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCgroupValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    uint64
+		wantErr bool
+	}{
+		{name: "number", path: "cgroup-v2/cgroup/system.slice/tesseract.service/memory.max", want: 512 << 20},
+		{name: "max", path: "cgroup-v2-namespace/cgroup/memory.max", want: 0},
+		{name: "negative", path: "cgroup-v1-unlimited/cgroup/cpu/cpu.cfs_quota_us", wantErr: true},
+		{name: "not a single number", path: "cgroup-v2/cgroup/system.slice/tesseract.service/cpu.max", wantErr: true},
+		{name: "missing", path: "missing/memory.max", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCgroupValue(filepath.Join("testdata", tt.path))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCgroupValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readCgroupValue() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCgroupStat(t *testing.T) {
+	memoryStat := "cgroup-v2/cgroup/system.slice/tesseract.service/memory.stat"
+	tests := []struct {
+		name    string
+		path    string
+		key     string
+		want    uint64
+		wantErr bool
+	}{
+		{name: "first key", path: memoryStat, key: "anon", want: 150 << 20},
+		{name: "later key", path: memoryStat, key: "inactive_file", want: 10 << 20},
+		{name: "prefix of a key", path: memoryStat, key: "file", want: 50 << 20},
+		{name: "unknown key", path: memoryStat, key: "shmem", wantErr: true},
+		{name: "missing", path: "missing/memory.stat", key: "anon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCgroupStat(filepath.Join("testdata", tt.path), tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCgroupStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readCgroupStat() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCgroupMemberships(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    map[string]string
+	}{
+		{
+			fixture: "cgroup-v2",
+			want:    map[string]string{"": "/system.slice/tesseract.service"},
+		},
+		{
+			fixture: "cgroup-v1",
+			want: map[string]string{
+				"memory":       "/docker/abc123",
+				"cpu":          "/docker/abc123",
+				"cpuacct":      "/docker/abc123",
+				"name=systemd": "/docker/abc123",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := readCgroupMemberships(fixture(tt.fixture).proc("self", "cgroup"))
+			if err != nil {
+				t.Fatalf("readCgroupMemberships() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("readCgroupMemberships() = %v, want %v", got, tt.want)
+			}
+			for controller, path := range tt.want {
+				if got[controller] != path {
+					t.Errorf("readCgroupMemberships()[%q] = %q, want %q", controller, got[controller], path)
+				}
+			}
+		})
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	twoCores := []CoreStats{{Id: "cpu0"}, {Id: "cpu1"}}
+	host := &linux.MemInfo{MemTotal: 8_000_000, MemAvailable: 6_000_000}
+
+	tests := []struct {
+		name  string
+		stats Stats
+		want  Capacity
+	}{
+		{
+			name:  "host only",
+			stats: Stats{Cores: twoCores, MemStats: host},
+			want:  Capacity{Source: "host", CpuCores: 2, MemTotalKb: 8_000_000, MemAvailableKb: 6_000_000},
+		},
+		{
+			name:  "cgroup without limits",
+			stats: Stats{Cores: twoCores, MemStats: host, Cgroup: &CgroupStats{Version: 2, MemoryUsage: 1 << 30}},
+			want:  Capacity{Source: "host", CpuCores: 2, MemTotalKb: 8_000_000, MemAvailableKb: 6_000_000},
+		},
+		{
+			name:  "cgroup CPU quota lower than the host",
+			stats: Stats{Cores: twoCores, MemStats: host, Cgroup: &CgroupStats{Version: 1, CpuLimit: 0.5}},
+			want:  Capacity{Source: "cgroup v1", CpuCores: 0.5, MemTotalKb: 8_000_000, MemAvailableKb: 6_000_000},
+		},
+		{
+			name: "cgroup memory limit lower than the host",
+			stats: Stats{Cores: twoCores, MemStats: host, Cgroup: &CgroupStats{
+				Version: 2, MemoryLimit: 512 << 20, MemoryUsage: 200 << 20,
+			}},
+			want: Capacity{Source: "cgroup v2", CpuCores: 2, MemTotalKb: 512 << 10, MemAvailableKb: 312 << 10},
+		},
+		{
+			name: "host has less memory available than the cgroup",
+			stats: Stats{Cores: twoCores, MemStats: &linux.MemInfo{MemTotal: 8_000_000, MemAvailable: 100_000}, Cgroup: &CgroupStats{
+				Version: 2, MemoryLimit: 512 << 20, MemoryUsage: 200 << 20,
+			}},
+			want: Capacity{Source: "cgroup v2", CpuCores: 2, MemTotalKb: 512 << 10, MemAvailableKb: 100_000},
+		},
+		{
+			name: "cgroup usage above its limit",
+			stats: Stats{Cores: twoCores, MemStats: host, Cgroup: &CgroupStats{
+				Version: 2, MemoryLimit: 512 << 20, MemoryUsage: 600 << 20,
+			}},
+			want: Capacity{Source: "cgroup v2", CpuCores: 2, MemTotalKb: 512 << 10, MemAvailableKb: 0},
+		},
+		{
+			name: "cgroup limits higher than the host",
+			stats: Stats{Cores: twoCores, MemStats: host, Cgroup: &CgroupStats{
+				Version: 2, CpuLimit: 4, MemoryLimit: 16 << 30,
+			}},
+			want: Capacity{Source: "host", CpuCores: 2, MemTotalKb: 8_000_000, MemAvailableKb: 6_000_000},
+		},
+		{
+			name: "host unreadable",
+			stats: Stats{Cores: []CoreStats{}, MemStats: &linux.MemInfo{}, Cgroup: &CgroupStats{
+				Version: 1, CpuLimit: 1, MemoryLimit: 1 << 30, MemoryUsage: 256 << 20,
+			}},
+			want: Capacity{Source: "cgroup v1", CpuCores: 1, MemTotalKb: 1 << 20, MemAvailableKb: 768 << 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.capacity(); *got != tt.want {
+				t.Errorf("capacity() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCgroupCpuUtilization(t *testing.T) {
+	tests := []struct {
+		name    string
+		prev    *CgroupStats
+		cur     *CgroupStats
+		elapsed time.Duration
+		want    float64
+	}{
+		{
+			name:    "half of the quota",
+			prev:    &CgroupStats{CpuLimit: 2, CpuUsage: time.Second},
+			cur:     &CgroupStats{CpuLimit: 2, CpuUsage: 2 * time.Second},
+			elapsed: time.Second,
+			want:    0.5,
+		},
+		{
+			name:    "capped at the quota",
+			prev:    &CgroupStats{CpuLimit: 0.5},
+			cur:     &CgroupStats{CpuLimit: 0.5, CpuUsage: time.Second},
+			elapsed: time.Second,
+			want:    1,
+		},
+		{
+			name:    "no previous sample",
+			cur:     &CgroupStats{CpuLimit: 1, CpuUsage: time.Second},
+			elapsed: time.Second,
+			want:    0,
+		},
+		{
+			name:    "no quota",
+			prev:    &CgroupStats{},
+			cur:     &CgroupStats{CpuUsage: time.Second},
+			elapsed: time.Second,
+			want:    0,
+		},
+		{
+			name:    "counter reset",
+			prev:    &CgroupStats{CpuLimit: 1, CpuUsage: time.Second},
+			cur:     &CgroupStats{CpuLimit: 1},
+			elapsed: time.Second,
+			want:    0,
+		},
+		{
+			name: "no time elapsed",
+			prev: &CgroupStats{CpuLimit: 1},
+			cur:  &CgroupStats{CpuLimit: 1, CpuUsage: time.Second},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cgroupCpuUtilization(tt.prev, tt.cur, tt.elapsed); got != tt.want {
+				t.Errorf("cgroupCpuUtilization() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package worker
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/task"
+)
+
+// ContainerStats is the resource usage of the container of a single Task, next to what the Task requested.
+type ContainerStats struct {
+	TaskID      uuid.UUID
+	ContainerID string
+
+	// Timestamp is when Docker took the sample.
+	Timestamp time.Time
+
+	// CpuCores is the number of CPU cores in use, comparable to the Cpu requested by the Task.
+	CpuCores float64
+
+	// CpuRequested is the Cpu of the Task.
+	CpuRequested float64
+
+	// MemoryUsage is the memory used by the container in bytes, excluding the inactive page cache.
+	MemoryUsage uint64
+
+	// MemoryLimit is the memory limit of the container in bytes, the host memory if it has none.
+	MemoryLimit uint64
+
+	// MemoryRequested is the Memory of the Task.
+	MemoryRequested int
+
+	// NetworkRxBytes and NetworkTxBytes are the bytes received and sent over all interfaces.
+	NetworkRxBytes uint64
+	NetworkTxBytes uint64
+
+	// BlockReadBytes and BlockWriteBytes are the bytes read from and written to block devices.
+	BlockReadBytes  uint64
+	BlockWriteBytes uint64
+
+	// Pids is the number of processes running in the container.
+	Pids uint64
+}
+
+// ContainerSummary adds up the usage of the containers of the running Tasks.
+type ContainerSummary struct {
+	Containers      int
+	CpuCores        float64
+	CpuRequested    float64
+	MemoryUsage     uint64
+	MemoryRequested int
+	NetworkRxBytes  uint64
+	NetworkTxBytes  uint64
+	BlockReadBytes  uint64
+	BlockWriteBytes uint64
+
+	// Tasks holds the usage of each container.
+	Tasks []*ContainerStats
+}
+
+// NewContainerStats turns a Docker stats sample of the container of t into ContainerStats.
+func NewContainerStats(t *task.Task, s container.StatsResponse) *ContainerStats {
+	cs := &ContainerStats{
+		TaskID:          t.ID,
+		ContainerID:     t.ContainerID,
+		Timestamp:       s.Read,
+		CpuCores:        cpuCores(s),
+		CpuRequested:    t.Cpu,
+		MemoryUsage:     memoryUsage(s.MemoryStats),
+		MemoryLimit:     s.MemoryStats.Limit,
+		MemoryRequested: t.Memory,
+		Pids:            s.PidsStats.Current,
+	}
+
+	for _, n := range s.Networks {
+		cs.NetworkRxBytes += n.RxBytes
+		cs.NetworkTxBytes += n.TxBytes
+	}
+
+	for _, entry := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			cs.BlockReadBytes += entry.Value
+		case "write":
+			cs.BlockWriteBytes += entry.Value
+		}
+	}
+
+	return cs
+}
+
+// cpuCores computes the cores in use between the previous and the current CPU sample,
+// the same way `docker stats` does before turning it into a percentage.
+func cpuCores(s container.StatsResponse) float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	onlineCPUs := float64(s.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * onlineCPUs
+}
+
+// memoryUsage leaves the inactive page cache out of the usage, like `docker stats`.
+// cgroup v1 reports it as total_inactive_file, cgroup v2 as inactive_file.
+func memoryUsage(m container.MemoryStats) uint64 {
+	cache, ok := m.Stats["total_inactive_file"]
+	if !ok {
+		cache = m.Stats["inactive_file"]
+	}
+	if cache > m.Usage {
+		return m.Usage
+	}
+	return m.Usage - cache
+}
+
+// GetContainerStats samples the container of every running Task concurrently.
+// Containers which cannot be sampled are left out.
+func (w *Worker) GetContainerStats() map[uuid.UUID]*ContainerStats {
+	running := w.runningTasks()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	stats := make(map[uuid.UUID]*ContainerStats)
+	for _, t := range running {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cs, err := w.containerStats(&t)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			stats[t.ID] = cs
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return stats
+}
+
+// lastContainerStats returns the sample of the container of the Task taken by the last collection.
+func (w *Worker) lastContainerStats(id uuid.UUID) (*ContainerStats, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	cs, ok := w.ContainerStats[id]
+	return cs, ok
+}
+
+func (w *Worker) containerStats(t *task.Task) (*ContainerStats, error) {
+	d, err := w.docker(task.NewConfig(t), w.Logger)
+	if err != nil {
+		return nil, err
+	}
+	s, err := d.Stats(t.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+	return NewContainerStats(t, s), nil
+}
+
+// summarizeContainers adds up the usage of the given containers.
+func summarizeContainers(stats map[uuid.UUID]*ContainerStats) *ContainerSummary {
+	summary := &ContainerSummary{Tasks: []*ContainerStats{}}
+	for _, cs := range stats {
+		summary.Containers++
+		summary.CpuCores += cs.CpuCores
+		summary.CpuRequested += cs.CpuRequested
+		summary.MemoryUsage += cs.MemoryUsage
+		summary.MemoryRequested += cs.MemoryRequested
+		summary.NetworkRxBytes += cs.NetworkRxBytes
+		summary.NetworkTxBytes += cs.NetworkTxBytes
+		summary.BlockReadBytes += cs.BlockReadBytes
+		summary.BlockWriteBytes += cs.BlockWriteBytes
+		summary.Tasks = append(summary.Tasks, cs)
+	}
+	return summary
+}
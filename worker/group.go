@@ -0,0 +1,171 @@
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+// GroupRecord is what the Worker stores about a Group: the Group itself and the IDs of its Tasks,
+// whose state is kept in TaskDb.
+type GroupRecord struct {
+	Group   task.Group
+	TaskIDs []uuid.UUID
+}
+
+// AddGroup queues a Group, it is started or stopped as one unit by RunTask. New Groups are
+// submitted with SubmitGroup.
+func (w *Worker) AddGroup(g task.Group) {
+	w.enqueue(g)
+	w.Logger.Debug("Group %v added to the queue TaskQueue", g.ID)
+}
+
+// StartGroup starts the Tasks of the Group in order. Every Task after the first joins the network
+// namespace of the first container. If a Task fails to start, the ones already started are stopped.
+func (w *Worker) StartGroup(g task.Group) task.DockerResult {
+	w.Logger.Info("Starting group %v with %d tasks", g.ID, len(g.Tasks))
+	g.StartTime = time.Now().UTC()
+
+	members := []uuid.UUID{}
+	var result task.DockerResult
+	var networkOwner string
+	for i, t := range g.Tasks {
+		t.GroupID = g.ID
+		t.SetState(task.Scheduled, "")
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("%s-%d", g.Name, i)
+		}
+		members = append(members, t.ID)
+
+		// Once a Task has failed the rest are not started, they are recorded as failed too.
+		if result.Error != nil {
+			t.SetState(task.Failed, "An earlier task of the group failed to start")
+			w.storeTask(t)
+			continue
+		}
+
+		if networkOwner != "" {
+			t.NetworkMode = task.ContainerNetworkMode(networkOwner)
+		}
+
+		result = w.StartTask(t)
+		if result.Error != nil {
+			w.Logger.Error("Task %v of group %v failed to start, stopping the group", t.ID, g.ID)
+			w.stopMembers(members[:len(members)-1])
+			continue
+		}
+
+		if i == 0 {
+			networkOwner = result.ContainerId
+		}
+	}
+
+	g.Tasks = nil
+	w.mu.Lock()
+	w.GroupDb[g.ID] = &GroupRecord{Group: g, TaskIDs: members}
+	delete(w.admitted, g.ID)
+	for _, id := range members {
+		delete(w.admitted, id)
+	}
+	w.mu.Unlock()
+	return result
+}
+
+// StopGroup stops the Tasks of the Group in reverse start order.
+func (w *Worker) StopGroup(g task.Group) task.DockerResult {
+	w.mu.RLock()
+	record, ok := w.GroupDb[g.ID]
+	var members []uuid.UUID
+	if ok {
+		members = record.TaskIDs
+	}
+	w.mu.RUnlock()
+	if !ok {
+		return task.DockerResult{Error: errdefs.New(errdefs.NotFound, "no group with ID %v found", g.ID)}
+	}
+
+	w.Logger.Info("Stopping group %v", g.ID)
+	result := w.stopMembers(members)
+	w.mu.Lock()
+	record.Group.FinishTime = time.Now().UTC()
+	w.mu.Unlock()
+	return result
+}
+
+// stopMembers stops the running Tasks among ids, last one first.
+func (w *Worker) stopMembers(ids []uuid.UUID) task.DockerResult {
+	var result task.DockerResult
+	for i := len(ids) - 1; i >= 0; i-- {
+		t, ok := w.lookupTask(ids[i])
+		if !ok || t.State != task.Running {
+			continue
+		}
+		r := w.StopTask(t)
+		if r.Error != nil {
+			result = r
+		}
+	}
+	return result
+}
+
+// GetGroups returns every Group with the current state of each of its Tasks.
+func (w *Worker) GetGroups() []task.Group {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	groups := []task.Group{}
+	for _, record := range w.GroupDb {
+		groups = append(groups, w.groupStatus(record))
+	}
+	return groups
+}
+
+// GetGroup returns the Group with the current state of each of its Tasks.
+func (w *Worker) GetGroup(id uuid.UUID) (task.Group, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	record, ok := w.GroupDb[id]
+	if !ok {
+		return task.Group{}, false
+	}
+	return w.groupStatus(record), true
+}
+
+// groupStatus returns the Group of record with copies of its Tasks. The caller holds w.mu.
+func (w *Worker) groupStatus(record *GroupRecord) task.Group {
+	g := record.Group
+	g.Tasks = []task.Task{}
+	for _, id := range record.TaskIDs {
+		if t, ok := w.TaskDb[id]; ok {
+			g.Tasks = append(g.Tasks, *t)
+		}
+	}
+	g.State = task.GroupState(g.Tasks)
+	return g
+}
+
+// runGroup starts or stops a Group taken off the queue, depending on its desired State.
+func (w *Worker) runGroup(g task.Group) task.DockerResult {
+	current := task.Pending
+	w.mu.RLock()
+	if record, ok := w.GroupDb[g.ID]; ok {
+		current = w.groupStatus(record).State
+	}
+	w.mu.RUnlock()
+
+	if current == task.Pending && g.State == task.Scheduled {
+		return w.StartGroup(g)
+	}
+	// A failed Group can still have running Tasks, so it can be stopped from any started state.
+	if g.State == task.Completed && current != task.Pending && current != task.Completed {
+		return w.StopGroup(g)
+	}
+
+	err := errdefs.New(errdefs.InvalidTransition, "invalid transition of group %v from %v to %v", g.ID, current, g.State)
+	w.Logger.Warn("Invalid state transition: %v", err)
+	return task.DockerResult{Error: err}
+}
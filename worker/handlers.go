@@ -5,43 +5,158 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
 	"github.com/praaatik/tesseract/task"
+	"github.com/praaatik/tesseract/tracing"
 )
 
-// StartTaskHandler will handle the start task request from the Manager
+// StartTaskHandler will handle the start task request from the Manager. With dryRun=true the task is
+// only checked and returned as it would be queued.
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	d := json.NewDecoder(r.Body)
 	d.DisallowUnknownFields()
 
-	a.Logger.Debug(fmt.Sprintf("StartTaskHandler reached with data - %v\n", d))
+	a.Logger.Debug("StartTaskHandler reached with data - %v\n", d)
+
+	if a.Worker.Draining() {
+		err := errdefs.New(errdefs.Unavailable, "Worker is shutting down, not accepting new tasks")
+		a.Logger.Warn("%v", err)
+		writeError(w, err)
+		return
+	}
 
 	te := task.Event{}
 	err := d.Decode(&te)
 	if err != nil {
-		var msg = fmt.Sprintf("Error unmarshalling body: %v\n", err)
-		a.Logger.Error(msg)
-		w.WriteHeader(http.StatusBadRequest)
-		e := ErrResponse{
-			HTTPStatusCode: 400,
-			Message:        msg,
+		err := errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err)
+		a.Logger.Error("%v", err)
+		writeError(w, err)
+		return
+	}
+
+	dryRun, err := task.ParseDryRun(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if dryRun {
+		if err := a.Worker.AdmitTask(&te); err != nil {
+			writeError(w, err)
+			return
 		}
-		json.NewEncoder(w).Encode(e)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(te.Task)
 		return
 	}
-	a.Worker.AddTask(te.Task)
-	a.Logger.Info(fmt.Sprintf("Added task %v\n", te.Task.ID))
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(te.Task)
 
-	return
+	te.Task.TraceParent = tracing.TraceParent(r.Context())
+	t, err := a.Worker.SubmitTask(te)
+	if err != nil {
+		a.Logger.Warn("Rejected task %v: %v", te.Task.ID, err)
+		writeError(w, err)
+		return
+	}
+	a.Logger.Info("Added task %v\n", t.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
 }
 
+// GetTasksHandler lists the tasks selected by the query parameters, see task.ParseQuery. When there
+// are more tasks than the limit, the cursor of the next page is in the X-Next-Cursor header.
 func (a *Api) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := task.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tasks, next := q.Apply(a.Worker.GetTasks())
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(a.Worker.GetTasks())
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// GetTaskHandler returns a task with the status of its container and the history of its states.
+func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
+		return
+	}
+
+	detail, ok := a.Worker.GetTask(tID)
+	if !ok {
+		writeError(w, errdefs.New(errdefs.NotFound, "No task with ID %v found", tID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(detail)
+}
+
+// PatchTaskHandler updates a running task with the task.Patch in the body. The update is queued
+// and the task, as it will be once updated, is returned with 202 Accepted.
+func (a *Api) PatchTaskHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	p := task.Patch{}
+	if err := d.Decode(&p); err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+		return
+	}
+
+	updated, err := a.patchTask(r, p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// patchTask validates the patch of the task in the taskID path value and queues the update.
+// A patch replacing the container bumps the Revision of the task.
+func (a *Api) patchTask(r *http.Request, p task.Patch) (*task.Task, error) {
+	if a.Worker.Draining() {
+		return nil, errdefs.New(errdefs.Unavailable, "Worker is shutting down, not accepting updates")
+	}
+
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		return nil, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	t, ok := a.Worker.lookupTask(tID)
+	if !ok {
+		return nil, errdefs.New(errdefs.NotFound, "No task with ID %v found", tID)
+	}
+	if t.State != task.Running {
+		return nil, errdefs.New(errdefs.Conflict, "Task %v is %v, only running tasks can be updated", tID, t.State)
+	}
+
+	updated := p.Apply(t)
+	if task.NeedsReplace(&t, &updated) {
+		updated.Revision++
+	}
+	updated.TraceParent = tracing.TraceParent(r.Context())
+	a.Worker.AddTask(updated)
+	a.Logger.With("task_id", tID).Info("Added update of task %v", tID)
+	return &updated, nil
 }
 
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -50,25 +165,25 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 	if taskId == "" {
 		a.Logger.Error("No taskID in the request\n")
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "No taskID in the request"))
 		return
 	}
 
 	tID, err := uuid.Parse(taskId)
 	if err != nil {
 		a.Logger.Error("Invalid taskID format: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
 		return
 	}
 
-	taskToStop, ok := a.Worker.TaskDb[tID]
+	taskToStop, ok := a.Worker.lookupTask(tID)
 	if !ok {
 		a.Logger.Error("No task with ID %v found", tID)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, errdefs.New(errdefs.NotFound, "No task with ID %v found", tID))
 		return
 	}
 
-	taskCopy := *taskToStop
+	taskCopy := taskToStop
 	taskCopy.State = task.Completed
 	a.Worker.AddTask(taskCopy)
 
@@ -79,5 +194,257 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 func (a *Api) StatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(a.Worker.Stats)
+	json.NewEncoder(w).Encode(a.Worker.LastStats())
+}
+
+// StartGroupHandler will handle the start group request from the Manager
+func (a *Api) StartGroupHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	if a.Worker.Draining() {
+		writeError(w, errdefs.New(errdefs.Unavailable, "Worker is shutting down, not accepting new groups"))
+		return
+	}
+
+	g := task.Group{}
+	if err := d.Decode(&g); err != nil {
+		err := errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err)
+		a.Logger.Error("%v", err)
+		writeError(w, err)
+		return
+	}
+	if len(g.Tasks) == 0 {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Group has no tasks"))
+		return
+	}
+
+	queued, err := a.Worker.SubmitGroup(g)
+	if err != nil {
+		a.Logger.Error("Error admitting group %v: %v", g.ID, err)
+		writeError(w, err)
+		return
+	}
+	a.Logger.Info("Added group %v with %d tasks\n", queued.ID, len(queued.Tasks))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(queued)
+}
+
+func (a *Api) GetGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.Worker.GetGroups())
+}
+
+func (a *Api) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	gID, err := uuid.Parse(r.PathValue("groupID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid groupID format: %v", err))
+		return
+	}
+
+	g, ok := a.Worker.GetGroup(gID)
+	if !ok {
+		writeError(w, errdefs.New(errdefs.NotFound, "No group with ID %v found", gID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(g)
+}
+
+func (a *Api) StopGroupHandler(w http.ResponseWriter, r *http.Request) {
+	gID, err := uuid.Parse(r.PathValue("groupID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid groupID format: %v", err))
+		return
+	}
+
+	g, ok := a.Worker.GetGroup(gID)
+	if !ok {
+		writeError(w, errdefs.New(errdefs.NotFound, "No group with ID %v found", gID))
+		return
+	}
+
+	g.State = task.Completed
+	a.Worker.AddGroup(g)
+	a.Logger.Info("Added group %v to stop its tasks\n", gID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StatsHistoryHandler returns the statistics sampled over the window query parameter (e.g. 5m),
+// which defaults to, and is capped at, the window kept by the Worker.
+func (a *Api) StatsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	history := a.Worker.History
+	if history == nil {
+		writeError(w, errdefs.New(errdefs.NotFound, "Stats history is not enabled"))
+		return
+	}
+
+	window := history.Window()
+	if param := r.URL.Query().Get("window"); param != "" {
+		parsed, err := time.ParseDuration(param)
+		if err != nil || parsed <= 0 {
+			writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid window %q, expected a positive duration such as 5m", param))
+			return
+		}
+		window = min(parsed, window)
+	}
+
+	samples := history.Since(time.Now().UTC().Add(-window))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(NewHistoryResponse(window, samples))
+}
+
+// TaskStatsHandler returns the resource usage of the container of a running task. The sample taken
+// by CollectStats is used when there is one, otherwise the container is sampled on the spot.
+func (a *Api) TaskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := a.taskStats(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cs)
+}
+
+// taskStats finds the usage of the task in the taskID path value.
+func (a *Api) taskStats(r *http.Request) (*ContainerStats, error) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		return nil, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err)
+	}
+
+	t, ok := a.Worker.lookupTask(tID)
+	if !ok {
+		return nil, errdefs.New(errdefs.NotFound, "No task with ID %v found", tID)
+	}
+
+	// The last sample of a Task which has since stopped is stale, only running Tasks have statistics.
+	if t.State != task.Running {
+		return nil, errdefs.New(errdefs.NotFound, "No statistics for task %v, it is %v", tID, t.State)
+	}
+	if cs, ok := a.Worker.lastContainerStats(tID); ok {
+		return cs, nil
+	}
+	cs, err := a.Worker.containerStats(&t)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting stats of task %v: %w", tID, err)
+	}
+	return cs, nil
+}
+
+// GetTaskLogsHandler streams the output of the container of a task as plain text, stdout and stderr
+// interleaved, selected by the query parameters, see task.ParseLogOptions.
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
+		return
+	}
+	o, err := task.ParseLogOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	t, ok := a.Worker.lookupTask(tID)
+	if !ok {
+		writeError(w, errdefs.New(errdefs.NotFound, "No task with ID %v found", tID))
+		return
+	}
+	if t.ContainerID == "" {
+		writeError(w, errdefs.New(errdefs.Conflict, "Task %v has no container", tID))
+		return
+	}
+
+	d, err := a.Worker.docker(task.NewConfig(&t), a.Logger.With("task_id", tID, "container_id", t.ContainerID))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logs, err := d.Logs(r.Context(), t.ContainerID, o)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	out := flushWriter{w: w, rc: http.NewResponseController(w)}
+	if _, err := stdcopy.StdCopy(out, out, logs); err != nil && r.Context().Err() == nil {
+		a.Logger.Warn("Error streaming logs of task %v: %v", tID, err)
+	}
+}
+
+// GetEventsHandler streams the changes of state of the tasks as JSON lines, one task.StateEvent each,
+// until the client goes away. The changes recorded after the optional since query parameter, an RFC 3339
+// timestamp, are sent first, otherwise only the changes to come are.
+func (a *Api) GetEventsHandler(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().UTC()
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, errdefs.New(errdefs.InvalidArgument, "Invalid since %q, expected an RFC 3339 timestamp", value))
+			return
+		}
+		since = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	watcher := task.NewWatcher(since)
+	ticker := time.NewTicker(eventsInterval)
+	defer ticker.Stop()
+	for {
+		for _, e := range watcher.Changes(a.Worker.GetTasks()) {
+			if err := encoder.Encode(e); err != nil {
+				return
+			}
+		}
+		rc.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// flushWriter flushes every write, so that streamed output reaches the client as it comes.
+type flushWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = f.rc.Flush()
+	}
+	return n, err
+}
+
+// writeError writes err as an ErrResponse, with the HTTP status of its errdefs.Code.
+func writeError(w http.ResponseWriter, err error) {
+	code := errdefs.CodeOf(err)
+	status := errdefs.HTTPStatus(code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	e := ErrResponse{
+		HTTPStatusCode: status,
+		Code:           code,
+		Message:        err.Error(),
+		Fields:         errdefs.FieldsOf(err),
+	}
+	json.NewEncoder(w).Encode(e)
 }
@@ -0,0 +1,255 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c9s/goprocinfo/linux"
+	"github.com/praaatik/tesseract/logger"
+)
+
+// CoreStats is the usage of a single CPU core.
+type CoreStats struct {
+	// Id is the name of the core in /proc/stat, such as cpu0
+	Id string
+
+	// Usage is the usage of the core (0.0 to 1.0) between the previous sample and this one
+	Usage float64
+
+	// stat holds the cumulative counters the next Usage is computed against
+	stat linux.CPUStat
+}
+
+// InterfaceStats is the traffic of a network interface, from /proc/net/dev.
+// The counters are cumulative since boot, the rates are computed against the previous sample.
+type InterfaceStats struct {
+	Name string
+
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+	RxErrors  uint64
+	TxErrors  uint64
+	RxDropped uint64
+	TxDropped uint64
+
+	RxBytesPerSecond float64
+	TxBytesPerSecond float64
+}
+
+// DiskIOStats is the activity of a block device, from /proc/diskstats.
+// The counters are cumulative since boot, the rates are computed against the previous sample.
+type DiskIOStats struct {
+	Device string
+
+	ReadOps    uint64
+	WriteOps   uint64
+	ReadBytes  uint64
+	WriteBytes uint64
+
+	// InFlight is the number of I/Os in progress when the sample was taken
+	InFlight uint64
+
+	ReadBytesPerSecond  float64
+	WriteBytesPerSecond float64
+
+	// Utilization is the share of time (0.0 to 1.0) the device was busy since the previous sample
+	Utilization float64
+
+	// ioTicks is the cumulative time the device was busy, in milliseconds
+	ioTicks uint64
+}
+
+// MountStats is the usage of the filesystem mounted at Path.
+type MountStats struct {
+	Path       string
+	Total      uint64
+	Used       uint64
+	Free       uint64
+	FreeInodes uint64
+}
+
+// ProcessStats counts the processes and open files of the host.
+type ProcessStats struct {
+	// Processes is the number of processes and threads, from /proc/loadavg
+	Processes uint64
+
+	// Running and Blocked are the processes runnable or blocked on I/O, from /proc/stat
+	Running uint64
+	Blocked uint64
+
+	// OpenFiles and MaxOpenFiles are the allocated and maximum file handles, from /proc/sys/fs/file-nr
+	OpenFiles    uint64
+	MaxOpenFiles uint64
+}
+
+// GetCoreStats retrieves the usage of every CPU core from /proc/stat.
+// The usage is computed against prev, the cores of the previous sample, when there is one.
+func GetCoreStats(paths StatsPaths, prev []CoreStats, log *logger.Logger) []CoreStats {
+	stats, err := linux.ReadStat(paths.proc("stat"))
+	if err != nil {
+		log.Error("Error reading from %s: %v", paths.proc("stat"), err)
+		return []CoreStats{}
+	}
+
+	previous := make(map[string]*linux.CPUStat)
+	for i := range prev {
+		previous[prev[i].Id] = &prev[i].stat
+	}
+
+	cores := []CoreStats{}
+	for _, c := range stats.CPUStats {
+		cores = append(cores, CoreStats{Id: c.Id, Usage: cpuUtilization(previous[c.Id], &c), stat: c})
+	}
+	return cores
+}
+
+// GetNetworkStats retrieves the traffic of every network interface but the loopback from /proc/net/dev.
+// The rates are computed against prev, the interfaces of the previous sample, over elapsed.
+func GetNetworkStats(paths StatsPaths, prev []InterfaceStats, elapsed time.Duration, log *logger.Logger) []InterfaceStats {
+	netstats, err := linux.ReadNetworkStat(paths.proc("net", "dev"))
+	if err != nil {
+		log.Error("Error reading from %s: %v", paths.proc("net", "dev"), err)
+		return []InterfaceStats{}
+	}
+
+	previous := make(map[string]InterfaceStats)
+	for _, i := range prev {
+		previous[i.Name] = i
+	}
+
+	interfaces := []InterfaceStats{}
+	for _, n := range netstats {
+		if n.Iface == "lo" {
+			continue
+		}
+		i := InterfaceStats{
+			Name:      n.Iface,
+			RxBytes:   n.RxBytes,
+			TxBytes:   n.TxBytes,
+			RxPackets: n.RxPackets,
+			TxPackets: n.TxPackets,
+			RxErrors:  n.RxErrs,
+			TxErrors:  n.TxErrs,
+			RxDropped: n.RxDrop,
+			TxDropped: n.TxDrop,
+		}
+		if p, ok := previous[i.Name]; ok {
+			i.RxBytesPerSecond = rate(p.RxBytes, i.RxBytes, elapsed)
+			i.TxBytesPerSecond = rate(p.TxBytes, i.TxBytes, elapsed)
+		}
+		interfaces = append(interfaces, i)
+	}
+	return interfaces
+}
+
+// GetDiskIOStats retrieves the activity of the block devices from /proc/diskstats, leaving out
+// loop and ram devices and the ones which never saw any I/O.
+// The rates are computed against prev, the devices of the previous sample, over elapsed.
+func GetDiskIOStats(paths StatsPaths, prev []DiskIOStats, elapsed time.Duration, log *logger.Logger) []DiskIOStats {
+	diskstats, err := linux.ReadDiskStats(paths.proc("diskstats"))
+	if err != nil {
+		log.Error("Error reading from %s: %v", paths.proc("diskstats"), err)
+		return []DiskIOStats{}
+	}
+
+	previous := make(map[string]DiskIOStats)
+	for _, d := range prev {
+		previous[d.Device] = d
+	}
+
+	devices := []DiskIOStats{}
+	for _, d := range diskstats {
+		if strings.HasPrefix(d.Name, "loop") || strings.HasPrefix(d.Name, "ram") || d.ReadIOs+d.WriteIOs == 0 {
+			continue
+		}
+		io := DiskIOStats{
+			Device:     d.Name,
+			ReadOps:    d.ReadIOs,
+			WriteOps:   d.WriteIOs,
+			ReadBytes:  uint64(d.GetReadBytes()),
+			WriteBytes: uint64(d.GetWriteBytes()),
+			InFlight:   d.InFlight,
+			ioTicks:    d.IOTicks,
+		}
+		if p, ok := previous[io.Device]; ok {
+			io.ReadBytesPerSecond = rate(p.ReadBytes, io.ReadBytes, elapsed)
+			io.WriteBytesPerSecond = rate(p.WriteBytes, io.WriteBytes, elapsed)
+			io.Utilization = min(rate(p.ioTicks, io.ioTicks, elapsed)/1000, 1)
+		}
+		devices = append(devices, io)
+	}
+	return devices
+}
+
+// GetMountStats retrieves the usage of the filesystems mounted at each of the paths.
+// Paths which cannot be read are left out.
+func GetMountStats(paths []string, log *logger.Logger) []MountStats {
+	mounts := []MountStats{}
+	for _, path := range paths {
+		disk, err := linux.ReadDisk(path)
+		if err != nil {
+			log.Error("Error reading disk stats from %s: %v", path, err)
+			continue
+		}
+		mounts = append(mounts, MountStats{
+			Path:       path,
+			Total:      disk.All,
+			Used:       disk.Used,
+			Free:       disk.Free,
+			FreeInodes: disk.FreeInodes,
+		})
+	}
+	return mounts
+}
+
+// GetProcessStats retrieves the number of processes and open files of the host.
+func GetProcessStats(paths StatsPaths, load *linux.LoadAvg, log *logger.Logger) *ProcessStats {
+	p := &ProcessStats{Processes: load.ProcessTotal}
+
+	stats, err := linux.ReadStat(paths.proc("stat"))
+	if err != nil {
+		log.Error("Error reading from %s: %v", paths.proc("stat"), err)
+	} else {
+		p.Running = stats.ProcsRunning
+		p.Blocked = stats.ProcsBlocked
+	}
+
+	p.OpenFiles, p.MaxOpenFiles, err = readFileNr(paths.proc("sys", "fs", "file-nr"))
+	if err != nil {
+		log.Error("Error reading from %s: %v", paths.proc("sys", "fs", "file-nr"), err)
+	}
+	return p
+}
+
+// readFileNr parses file-nr, which holds the allocated, unused and maximum number of file handles.
+func readFileNr(path string) (open uint64, limit uint64, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) != 3 {
+		return 0, 0, fmt.Errorf("cannot parse file-nr: %q", string(b))
+	}
+	if open, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if limit, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+		return 0, 0, err
+	}
+	return open, limit, nil
+}
+
+// rate returns the per second increase of a cumulative counter, zero if it went backwards.
+func rate(prev uint64, cur uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 || cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / elapsed.Seconds()
+}
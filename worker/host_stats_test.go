@@ -0,0 +1,183 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/praaatik/tesseract/logger"
+)
+
+var testLogger = logger.NewLogger("stats", logger.ERROR)
+
+func TestGetStats(t *testing.T) {
+	s := GetStats(nil, fixture("cgroup-v2"), nil, testLogger)
+
+	if s.MemStats.MemTotal != 8_000_000 || s.MemStats.MemAvailable != 6_000_000 {
+		t.Errorf("MemStats = %+v, want a total of 8000000 kB with 6000000 kB available", *s.MemStats)
+	}
+	if s.LoadStats.Last1Min != 0.5 || s.LoadStats.ProcessTotal != 512 {
+		t.Errorf("LoadStats = %+v, want a load of 0.5 with 512 processes", *s.LoadStats)
+	}
+	want := Capacity{Source: "cgroup v2", CpuCores: 1.5, MemTotalKb: 512 << 10, MemAvailableKb: 512<<10 - 190<<10}
+	if *s.Capacity != want {
+		t.Errorf("Capacity = %+v, want %+v", *s.Capacity, want)
+	}
+	// The first sample has no previous cgroup usage to compare against.
+	if s.CpuUtilization != 0 {
+		t.Errorf("CpuUtilization = %v, want 0", s.CpuUtilization)
+	}
+}
+
+func TestGetCoreStats(t *testing.T) {
+	paths := fixture("cgroup-v2")
+	tests := []struct {
+		name string
+		prev []CoreStats
+		want []CoreStats
+	}{
+		{
+			// Without a previous sample the usage is the one since boot.
+			name: "first sample",
+			want: []CoreStats{{Id: "cpu0", Usage: 750.0 / 4800}, {Id: "cpu1", Usage: 750.0 / 4800}},
+		},
+		{
+			name: "against a previous sample",
+			prev: []CoreStats{{Id: "cpu0"}, {Id: "cpu1"}},
+			want: []CoreStats{{Id: "cpu0", Usage: 750.0 / 4800}, {Id: "cpu1", Usage: 750.0 / 4800}},
+		},
+		{
+			name: "idle since the previous sample",
+			prev: GetCoreStats(paths, nil, testLogger),
+			want: []CoreStats{{Id: "cpu0", Usage: 0}, {Id: "cpu1", Usage: 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetCoreStats(paths, tt.prev, testLogger)
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetCoreStats() returned %d cores, want %d", len(got), len(tt.want))
+			}
+			for i := range tt.want {
+				if got[i].Id != tt.want[i].Id || got[i].Usage != tt.want[i].Usage {
+					t.Errorf("GetCoreStats()[%d] = %s %v, want %s %v", i, got[i].Id, got[i].Usage, tt.want[i].Id, tt.want[i].Usage)
+				}
+			}
+		})
+	}
+}
+
+func TestGetNetworkStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		prev    []InterfaceStats
+		elapsed time.Duration
+		want    InterfaceStats
+	}{
+		{
+			name: "first sample",
+			want: InterfaceStats{
+				Name: "eth0", RxBytes: 1 << 20, TxBytes: 512 << 10, RxPackets: 1000, TxPackets: 800,
+				RxErrors: 1, TxErrors: 3, RxDropped: 2, TxDropped: 4,
+			},
+		},
+		{
+			name:    "against a previous sample",
+			prev:    []InterfaceStats{{Name: "eth0", RxBytes: 48_576, TxBytes: 24_288}},
+			elapsed: 2 * time.Second,
+			want: InterfaceStats{
+				Name: "eth0", RxBytes: 1 << 20, TxBytes: 512 << 10, RxPackets: 1000, TxPackets: 800,
+				RxErrors: 1, TxErrors: 3, RxDropped: 2, TxDropped: 4,
+				RxBytesPerSecond: 500_000, TxBytesPerSecond: 250_000,
+			},
+		},
+		{
+			name:    "counter reset",
+			prev:    []InterfaceStats{{Name: "eth0", RxBytes: 2 << 20, TxBytes: 1 << 20}},
+			elapsed: time.Second,
+			want: InterfaceStats{
+				Name: "eth0", RxBytes: 1 << 20, TxBytes: 512 << 10, RxPackets: 1000, TxPackets: 800,
+				RxErrors: 1, TxErrors: 3, RxDropped: 2, TxDropped: 4,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetNetworkStats(fixture("cgroup-v2"), tt.prev, tt.elapsed, testLogger)
+			// The loopback is left out.
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("GetNetworkStats() = %+v, want [%+v]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDiskIOStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		prev    []DiskIOStats
+		elapsed time.Duration
+		want    DiskIOStats
+	}{
+		{
+			name: "first sample",
+			want: DiskIOStats{
+				Device: "sda", ReadOps: 1000, WriteOps: 2000, ReadBytes: 20_000 * 512, WriteBytes: 40_000 * 512,
+				InFlight: 2, ioTicks: 900,
+			},
+		},
+		{
+			name:    "against a previous sample",
+			prev:    []DiskIOStats{{Device: "sda", ReadBytes: 10_000 * 512, WriteBytes: 20_000 * 512, ioTicks: 400}},
+			elapsed: 2 * time.Second,
+			want: DiskIOStats{
+				Device: "sda", ReadOps: 1000, WriteOps: 2000, ReadBytes: 20_000 * 512, WriteBytes: 40_000 * 512,
+				InFlight: 2, ioTicks: 900,
+				ReadBytesPerSecond: 5_000 * 512, WriteBytesPerSecond: 10_000 * 512, Utilization: 0.25,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetDiskIOStats(fixture("cgroup-v2"), tt.prev, tt.elapsed, testLogger)
+			// The loop device and the device without any I/O are left out.
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("GetDiskIOStats() = %+v, want [%+v]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetProcessStats(t *testing.T) {
+	paths := fixture("cgroup-v2")
+	got := GetProcessStats(paths, GetLoadAvg(paths, testLogger), testLogger)
+	want := ProcessStats{Processes: 512, Running: 3, Blocked: 1, OpenFiles: 2048, MaxOpenFiles: 65536}
+	if *got != want {
+		t.Errorf("GetProcessStats() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		prev    uint64
+		cur     uint64
+		elapsed time.Duration
+		want    float64
+	}{
+		{name: "increase", prev: 100, cur: 300, elapsed: 2 * time.Second, want: 100},
+		{name: "unchanged", prev: 100, cur: 100, elapsed: time.Second, want: 0},
+		{name: "counter reset", prev: 300, cur: 100, elapsed: time.Second, want: 0},
+		{name: "no time elapsed", prev: 100, cur: 300, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rate(tt.prev, tt.cur, tt.elapsed); got != tt.want {
+				t.Errorf("rate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
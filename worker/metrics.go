@@ -0,0 +1,166 @@
+package worker
+
+import (
+	"github.com/praaatik/tesseract/metrics"
+	"github.com/praaatik/tesseract/task"
+)
+
+// taskStartDuration measures how long StartTask takes to pull the image, create and start the container.
+var taskStartDuration = metrics.NewHistogram(
+	"tesseract_worker_task_start_duration_seconds",
+	"Time taken to pull the image, create and start the container of a task, by result.",
+	[]float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	"result",
+)
+
+func init() {
+	metrics.Default.MustRegister(taskStartDuration)
+}
+
+// registerMetrics adds the gauges read from the Worker at scrape time to the registry.
+func (w *Worker) registerMetrics(r *metrics.Registry) error {
+	return r.Register(
+		metrics.NewGaugeFunc("tesseract_worker_tasks", "Number of tasks known to the worker, by state.",
+			[]string{"state"}, w.taskStateSamples),
+		metrics.NewGaugeFunc("tesseract_worker_queue_depth", "Number of tasks and groups waiting in the worker queue.",
+			nil, func() []metrics.Sample {
+				return []metrics.Sample{{Value: float64(w.QueueLen())}}
+			}),
+		w.statsGauge("tesseract_worker_memory_total_kilobytes", "Memory the worker can use in kilobytes, the cgroup limit when there is one.",
+			func(s *Stats) float64 { return float64(s.MemTotalKb()) }),
+		w.statsGauge("tesseract_worker_memory_available_kilobytes", "Memory available to the worker in kilobytes.",
+			func(s *Stats) float64 { return float64(s.MemAvailableKb()) }),
+		w.statsGauge("tesseract_worker_disk_total_bytes", "Total disk space of the root filesystem in bytes.",
+			func(s *Stats) float64 { return float64(s.DiskTotal()) }),
+		w.statsGauge("tesseract_worker_disk_free_bytes", "Free disk space of the root filesystem in bytes.",
+			func(s *Stats) float64 { return float64(s.DiskFree()) }),
+		w.statsGauge("tesseract_worker_cpu_capacity_cores", "CPU cores the worker can use, the cgroup quota when there is one.",
+			func(s *Stats) float64 { return s.Capacity.CpuCores }),
+		w.statsGauge("tesseract_worker_cpu_usage_ratio", "CPU usage of the host between 0 and 1.",
+			func(s *Stats) float64 { return s.CpuUsage() }),
+		metrics.NewGaugeFunc("tesseract_worker_cpu_core_usage_ratio", "CPU usage of each core of the host between 0 and 1.",
+			[]string{"core"}, w.coreSamples),
+		metrics.NewGaugeFunc("tesseract_worker_network_receive_bytes_per_second", "Bytes received per second, by network interface.",
+			[]string{"interface"}, w.networkSamples(func(i InterfaceStats) float64 { return i.RxBytesPerSecond })),
+		metrics.NewGaugeFunc("tesseract_worker_network_transmit_bytes_per_second", "Bytes sent per second, by network interface.",
+			[]string{"interface"}, w.networkSamples(func(i InterfaceStats) float64 { return i.TxBytesPerSecond })),
+		metrics.NewGaugeFunc("tesseract_worker_disk_read_bytes_per_second", "Bytes read per second, by block device.",
+			[]string{"device"}, w.diskIOSamples(func(d DiskIOStats) float64 { return d.ReadBytesPerSecond })),
+		metrics.NewGaugeFunc("tesseract_worker_disk_write_bytes_per_second", "Bytes written per second, by block device.",
+			[]string{"device"}, w.diskIOSamples(func(d DiskIOStats) float64 { return d.WriteBytesPerSecond })),
+		metrics.NewGaugeFunc("tesseract_worker_mount_free_bytes", "Free disk space in bytes, by mount point.",
+			[]string{"mountpoint"}, w.mountSamples(func(m MountStats) float64 { return float64(m.Free) })),
+		metrics.NewGaugeFunc("tesseract_worker_mount_total_bytes", "Total disk space in bytes, by mount point.",
+			[]string{"mountpoint"}, w.mountSamples(func(m MountStats) float64 { return float64(m.Total) })),
+		metrics.NewGaugeFunc("tesseract_worker_processes", "Number of processes and threads on the host.",
+			nil, w.processSamples(func(p *ProcessStats) float64 { return float64(p.Processes) })),
+		metrics.NewGaugeFunc("tesseract_worker_open_files", "Number of file handles allocated on the host.",
+			nil, w.processSamples(func(p *ProcessStats) float64 { return float64(p.OpenFiles) })),
+		metrics.NewGaugeFunc("tesseract_worker_load_average", "Load average of the host, by period.",
+			[]string{"period"}, w.loadSamples),
+		w.statsGauge("tesseract_worker_containers_cpu_cores", "CPU cores used by the containers of the running tasks.",
+			func(s *Stats) float64 { return s.Containers.CpuCores }),
+		w.statsGauge("tesseract_worker_containers_memory_bytes", "Memory used by the containers of the running tasks in bytes.",
+			func(s *Stats) float64 { return float64(s.Containers.MemoryUsage) }),
+	)
+}
+
+func (w *Worker) taskStateSamples() []metrics.Sample {
+	counts := make(map[task.State]int)
+	for _, t := range w.GetTasks() {
+		counts[t.State]++
+	}
+
+	samples := []metrics.Sample{}
+	for _, s := range task.States {
+		samples = append(samples, metrics.Sample{LabelValues: []string{s.String()}, Value: float64(counts[s])})
+	}
+	return samples
+}
+
+func (w *Worker) loadSamples() []metrics.Sample {
+	stats := w.LastStats()
+	if stats == nil || stats.LoadStats == nil {
+		return nil
+	}
+	return []metrics.Sample{
+		{LabelValues: []string{"1m"}, Value: stats.LoadStats.Last1Min},
+		{LabelValues: []string{"5m"}, Value: stats.LoadStats.Last5Min},
+		{LabelValues: []string{"15m"}, Value: stats.LoadStats.Last15Min},
+	}
+}
+
+func (w *Worker) coreSamples() []metrics.Sample {
+	stats := w.LastStats()
+	if stats == nil {
+		return nil
+	}
+	samples := []metrics.Sample{}
+	for _, c := range stats.Cores {
+		samples = append(samples, metrics.Sample{LabelValues: []string{c.Id}, Value: c.Usage})
+	}
+	return samples
+}
+
+func (w *Worker) networkSamples(value func(i InterfaceStats) float64) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		stats := w.LastStats()
+		if stats == nil {
+			return nil
+		}
+		samples := []metrics.Sample{}
+		for _, i := range stats.Network {
+			samples = append(samples, metrics.Sample{LabelValues: []string{i.Name}, Value: value(i)})
+		}
+		return samples
+	}
+}
+
+func (w *Worker) diskIOSamples(value func(d DiskIOStats) float64) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		stats := w.LastStats()
+		if stats == nil {
+			return nil
+		}
+		samples := []metrics.Sample{}
+		for _, d := range stats.DiskIO {
+			samples = append(samples, metrics.Sample{LabelValues: []string{d.Device}, Value: value(d)})
+		}
+		return samples
+	}
+}
+
+func (w *Worker) mountSamples(value func(m MountStats) float64) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		stats := w.LastStats()
+		if stats == nil {
+			return nil
+		}
+		samples := []metrics.Sample{}
+		for _, m := range stats.Mounts {
+			samples = append(samples, metrics.Sample{LabelValues: []string{m.Path}, Value: value(m)})
+		}
+		return samples
+	}
+}
+
+func (w *Worker) processSamples(value func(p *ProcessStats) float64) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		stats := w.LastStats()
+		if stats == nil || stats.Processes == nil {
+			return nil
+		}
+		return []metrics.Sample{{Value: value(stats.Processes)}}
+	}
+}
+
+// statsGauge exposes a value of the last Stats collected, nothing is exposed before the first collection.
+func (w *Worker) statsGauge(name string, help string, value func(s *Stats) float64) *metrics.GaugeFunc {
+	return metrics.NewGaugeFunc(name, help, nil, func() []metrics.Sample {
+		stats := w.LastStats()
+		if stats == nil || stats.MemStats == nil || stats.DiskStats == nil || stats.CpuStats == nil || stats.Capacity == nil || stats.Containers == nil {
+			return nil
+		}
+		return []metrics.Sample{{Value: value(stats)}}
+	})
+}
@@ -1,32 +1,63 @@
 package worker
 
 import (
-	"log"
+	"time"
 
 	"github.com/c9s/goprocinfo/linux"
+	"github.com/praaatik/tesseract/logger"
 )
 
 // Stats aggregates system resource statistics for memory, disk, CPU, load average, and task count.
 type Stats struct {
+	// Time at which the statistics were read
+	Timestamp time.Time
+
 	// Memory statistics from /proc/meminfo
 	MemStats *linux.MemInfo
 
 	// Disk usage statistics for the root filesystem
 	DiskStats *linux.Disk
 
+	// Disk usage statistics for each of the mount points watched by the worker
+	Mounts []MountStats
+
+	// Disk I/O statistics for each block device, from /proc/diskstats
+	DiskIO []DiskIOStats
+
+	// Traffic statistics for each network interface, from /proc/net/dev
+	Network []InterfaceStats
+
 	// CPU usage statistics from /proc/stat
 	CpuStats *linux.CPUStat
 
+	// Usage of each CPU core from /proc/stat
+	Cores []CoreStats
+
 	// Load average statistics from /proc/loadavg
 	LoadStats *linux.LoadAvg
-	//
+
+	// Number of processes and open files
+	Processes *ProcessStats
+
 	// Number of tasks currently managed by the system
 	TaskCount int
+
+	// Resource usage of the containers of the running tasks
+	Containers *ContainerSummary
+
+	// Limits and usage of the cgroup the worker runs in, nil when it cannot be read
+	Cgroup *CgroupStats
+
+	// Memory and CPU the worker can effectively use, the cgroup limits when there are some
+	Capacity *Capacity
+
+	// CPU usage (0.0 to 1.0) between the previous sample and this one, of the cgroup quota when there is one
+	CpuUtilization float64
 }
 
 // MemUsedKb returns the amount of memory used in kilobytes.
 func (s *Stats) MemUsedKb() uint64 {
-	return s.MemStats.MemTotal - s.MemStats.MemAvailable
+	return s.MemTotalKb() - s.MemAvailableKb()
 }
 
 // MemUsedPercent returns the percentage of memory currently in use.
@@ -37,13 +68,19 @@ func (s *Stats) MemUsedPercent() uint64 {
 	return s.MemStats.MemAvailable / s.MemStats.MemTotal
 }
 
-// MemAvailableKb returns the amount of memory available in kilobytes.
+// MemAvailableKb returns the amount of memory available in kilobytes, within the cgroup limit if any.
 func (s *Stats) MemAvailableKb() uint64 {
+	if s.Capacity != nil {
+		return s.Capacity.MemAvailableKb
+	}
 	return s.MemStats.MemAvailable
 }
 
-// MemTotalKb returns the total amount of memory in kilobytes.
+// MemTotalKb returns the total amount of memory in kilobytes, the cgroup limit if it is lower.
 func (s *Stats) MemTotalKb() uint64 {
+	if s.Capacity != nil {
+		return s.Capacity.MemTotalKb
+	}
 	return s.MemStats.MemTotal
 }
 
@@ -62,66 +99,108 @@ func (s *Stats) DiskUsed() uint64 {
 	return s.DiskStats.Used
 }
 
-// CpuUsage returns the CPU usage as a percentage (0.0 to 1.0).
+// CpuUsage returns the CPU usage as a percentage (0.0 to 1.0) over the interval since the previous sample.
 func (s *Stats) CpuUsage() float64 {
-	idle := s.CpuStats.Idle + s.CpuStats.IOWait
-	nonIdle := s.CpuStats.User + s.CpuStats.Nice + s.CpuStats.System + s.CpuStats.IRQ + s.CpuStats.SoftIRQ + s.CpuStats.Steal
-	total := idle + nonIdle
+	return s.CpuUtilization
+}
+
+// cpuUtilization computes the CPU usage (0.0 to 1.0) between two readings of the cumulative /proc/stat
+// counters. Without a previous reading the usage since boot is returned.
+func cpuUtilization(prev *linux.CPUStat, cur *linux.CPUStat) float64 {
+	idle, total := cpuTimes(cur)
+	if prev != nil {
+		prevIdle, prevTotal := cpuTimes(prev)
+		idle -= prevIdle
+		total -= prevTotal
+	}
 
-	if total == 0 {
+	if total == 0 || idle > total {
 		return 0.00
 	}
 
 	return (float64(total) - float64(idle)) / float64(total)
 }
 
-// GetStats retrieves and aggregates system resource statistics.
-func GetStats() *Stats {
-	return &Stats{
-		MemStats:  GetMemoryInfo(),
-		DiskStats: GetDiskInfo(),
-		CpuStats:  GetCpuStats(),
-		LoadStats: GetLoadAvg(),
+// cpuTimes returns the idle and total time spent by the CPU since boot, in jiffies.
+func cpuTimes(c *linux.CPUStat) (idle uint64, total uint64) {
+	idle = c.Idle + c.IOWait
+	nonIdle := c.User + c.Nice + c.System + c.IRQ + c.SoftIRQ + c.Steal
+	return idle, idle + nonIdle
+}
+
+// GetStats retrieves and aggregates system resource statistics from paths, including the usage of the
+// filesystems mounted at mounts. The CPU usage and the network and disk rates are computed against prev,
+// the previous sample, when there is one.
+func GetStats(prev *Stats, paths StatsPaths, mounts []string, log *logger.Logger) *Stats {
+	if prev == nil {
+		prev = &Stats{}
 	}
+
+	s := &Stats{
+		Timestamp: time.Now().UTC(),
+		MemStats:  GetMemoryInfo(paths, log),
+		DiskStats: GetDiskInfo(log),
+		Mounts:    GetMountStats(mounts, log),
+		CpuStats:  GetCpuStats(paths, log),
+		Cores:     GetCoreStats(paths, prev.Cores, log),
+		LoadStats: GetLoadAvg(paths, log),
+		Cgroup:    GetCgroupStats(paths),
+	}
+
+	var elapsed time.Duration
+	if !prev.Timestamp.IsZero() {
+		elapsed = s.Timestamp.Sub(prev.Timestamp)
+	}
+	s.Network = GetNetworkStats(paths, prev.Network, elapsed, log)
+	s.DiskIO = GetDiskIOStats(paths, prev.DiskIO, elapsed, log)
+	s.Processes = GetProcessStats(paths, s.LoadStats, log)
+	s.Capacity = s.capacity()
+
+	// With a CPU quota, the usage is relative to the quota rather than to the cores of the host.
+	if s.Cgroup != nil && s.Cgroup.CpuLimit > 0 && s.Capacity.CpuCores == s.Cgroup.CpuLimit {
+		s.CpuUtilization = cgroupCpuUtilization(prev.Cgroup, s.Cgroup, elapsed)
+	} else {
+		s.CpuUtilization = cpuUtilization(prev.CpuStats, s.CpuStats)
+	}
+	return s
 }
 
 // GetMemoryInfo retrieves memory statistics from /proc/meminfo.
-func GetMemoryInfo() *linux.MemInfo {
-	memstats, err := linux.ReadMemInfo("/proc/meminfo")
+func GetMemoryInfo(paths StatsPaths, log *logger.Logger) *linux.MemInfo {
+	memstats, err := linux.ReadMemInfo(paths.proc("meminfo"))
 	if err != nil {
-		log.Printf("Error reading from /proc/meminfo: %v", err)
+		log.Error("Error reading from %s: %v", paths.proc("meminfo"), err)
 		return &linux.MemInfo{}
 	}
 	return memstats
 }
 
 // GetDiskInfo retrieves disk usage statistics for the root filesystem.
-func GetDiskInfo() *linux.Disk {
+func GetDiskInfo(log *logger.Logger) *linux.Disk {
 	diskstats, err := linux.ReadDisk("/")
 	if err != nil {
-		log.Printf("Error reading disk stats from /: %v", err)
+		log.Error("Error reading disk stats from /: %v", err)
 		return &linux.Disk{}
 	}
 	return diskstats
 }
 
 // GetCpuStats retrieves CPU usage statistics from /proc/stat.
-func GetCpuStats() *linux.CPUStat {
-	stats, err := linux.ReadStat("/proc/stat")
+func GetCpuStats(paths StatsPaths, log *logger.Logger) *linux.CPUStat {
+	stats, err := linux.ReadStat(paths.proc("stat"))
 	if err != nil {
-		log.Printf("Error reading from /proc/stat: %v", err)
+		log.Error("Error reading from %s: %v", paths.proc("stat"), err)
 		return &linux.CPUStat{}
 	}
 	return &stats.CPUStatAll
 }
 
 // GetLoadAvg retrieves system load average statistics from /proc/loadavg.
-func GetLoadAvg() *linux.LoadAvg {
-	loadavg, err := linux.ReadLoadAvg("/proc/loadavg")
+func GetLoadAvg(paths StatsPaths, log *logger.Logger) *linux.LoadAvg {
+	loadavg, err := linux.ReadLoadAvg(paths.proc("loadavg"))
 	if err != nil {
-		log.Printf("Error reading from /proc/loadavg: %v", err)
+		log.Error("Error reading from %s: %v", paths.proc("loadavg"), err)
 		return &linux.LoadAvg{}
 	}
 	return loadavg
 }
-
@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultStatsInterval is the time between two samples of the statistics.
+const defaultStatsInterval = 15 * time.Second
+
+// StatsHistory is a ring buffer of Stats samples covering a fixed window of time.
+type StatsHistory struct {
+	window  time.Duration
+	mu      sync.RWMutex
+	samples []*Stats
+	next    int
+	full    bool
+}
+
+// NewStatsHistory creates a history large enough to hold window worth of samples taken every interval.
+func NewStatsHistory(window time.Duration, interval time.Duration) *StatsHistory {
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+	size := max(int(window/interval), 1)
+	return &StatsHistory{window: window, samples: make([]*Stats, size)}
+}
+
+// Window returns the duration covered by the history once it is full.
+func (h *StatsHistory) Window() time.Duration {
+	return h.window
+}
+
+// Add stores a sample, overwriting the oldest one once the buffer is full.
+func (h *StatsHistory) Add(s *Stats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Since returns the samples taken at or after t, oldest first.
+func (h *StatsHistory) Since(t time.Time) []*Stats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ordered := h.samples[:h.next]
+	if h.full {
+		ordered = append(slices.Clone(h.samples[h.next:]), h.samples[:h.next]...)
+	}
+
+	samples := []*Stats{}
+	for _, s := range ordered {
+		if !s.Timestamp.Before(t) {
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+// HistorySample is the part of a Stats sample exposed as a time series.
+type HistorySample struct {
+	Timestamp time.Time
+
+	// CpuUsage is the CPU usage (0.0 to 1.0) over the interval ending at Timestamp.
+	CpuUsage float64
+
+	MemUsedKb      uint64
+	MemAvailableKb uint64
+	DiskFree       uint64
+	LoadAvg1       float64
+	TaskCount      int
+}
+
+// SeriesSummary describes the values of a time series.
+type SeriesSummary struct {
+	Min float64
+	Avg float64
+	Max float64
+	P95 float64
+}
+
+// HistoryResponse is returned by the stats history endpoint.
+type HistoryResponse struct {
+	// Window is the duration covered by the request.
+	Window string
+
+	// Samples are ordered oldest first.
+	Samples []HistorySample
+
+	// Summary holds the min/avg/max/p95 of each series, keyed by series name.
+	Summary map[string]SeriesSummary
+}
+
+// NewHistoryResponse turns samples into time series and sums them up.
+func NewHistoryResponse(window time.Duration, samples []*Stats) HistoryResponse {
+	resp := HistoryResponse{
+		Window:  window.String(),
+		Samples: []HistorySample{},
+		Summary: make(map[string]SeriesSummary),
+	}
+
+	series := map[string][]float64{}
+	for _, s := range samples {
+		hs := HistorySample{
+			Timestamp: s.Timestamp,
+			CpuUsage:  s.CpuUsage(),
+			TaskCount: s.TaskCount,
+		}
+		if s.MemStats != nil {
+			hs.MemUsedKb = s.MemUsedKb()
+			hs.MemAvailableKb = s.MemAvailableKb()
+		}
+		if s.DiskStats != nil {
+			hs.DiskFree = s.DiskFree()
+		}
+		if s.LoadStats != nil {
+			hs.LoadAvg1 = s.LoadStats.Last1Min
+		}
+		resp.Samples = append(resp.Samples, hs)
+
+		series["CpuUsage"] = append(series["CpuUsage"], hs.CpuUsage)
+		series["MemUsedKb"] = append(series["MemUsedKb"], float64(hs.MemUsedKb))
+		series["MemAvailableKb"] = append(series["MemAvailableKb"], float64(hs.MemAvailableKb))
+		series["DiskFree"] = append(series["DiskFree"], float64(hs.DiskFree))
+		series["LoadAvg1"] = append(series["LoadAvg1"], hs.LoadAvg1)
+		series["TaskCount"] = append(series["TaskCount"], float64(hs.TaskCount))
+	}
+
+	for name, values := range series {
+		resp.Summary[name] = summarize(values)
+	}
+	return resp
+}
+
+// summarize computes the min, average, max and 95th percentile (nearest rank) of values.
+func summarize(values []float64) SeriesSummary {
+	if len(values) == 0 {
+		return SeriesSummary{}
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return SeriesSummary{
+		Min: sorted[0],
+		Avg: sum / float64(len(sorted)),
+		Max: sorted[len(sorted)-1],
+		P95: sorted[max(rank, 0)],
+	}
+}
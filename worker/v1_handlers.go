@@ -0,0 +1,277 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	v1 "github.com/praaatik/tesseract/api/v1"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+	"github.com/praaatik/tesseract/tracing"
+)
+
+// The handlers below serve the /v1 routes. They do what their unversioned counterparts do, but speak
+// the types of package v1 rather than the internal ones.
+
+func (a *Api) StartTaskV1Handler(w http.ResponseWriter, r *http.Request) {
+	if a.Worker.Draining() {
+		writeV1Error(w, errdefs.New(errdefs.Unavailable, "Worker is shutting down, not accepting new tasks"))
+		return
+	}
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	req := v1.CreateTaskRequest{}
+	if err := d.Decode(&req); err != nil {
+		writeV1Error(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+		return
+	}
+	t, err := req.ToTask()
+	if err != nil {
+		writeV1Error(w, err)
+		return
+	}
+	t.SetState(task.Scheduled, "")
+	te := task.Event{State: task.Scheduled, Task: t}
+
+	dryRun, err := task.ParseDryRun(r.URL.Query())
+	if err != nil {
+		writeV1Error(w, err)
+		return
+	}
+	if dryRun {
+		if err := a.Worker.AdmitTask(&te); err != nil {
+			writeV1Error(w, err)
+			return
+		}
+		writeV1JSON(w, http.StatusOK, v1.FromTask(te.Task))
+		return
+	}
+
+	te.Task.TraceParent = tracing.TraceParent(r.Context())
+	submitted, err := a.Worker.SubmitTask(te)
+	if err != nil {
+		a.Logger.Warn("Rejected task %v: %v", te.Task.ID, err)
+		writeV1Error(w, err)
+		return
+	}
+	a.Logger.With("task_id", submitted.ID).Info("Added task %v", submitted.ID)
+	writeV1JSON(w, http.StatusCreated, v1.FromTask(*submitted))
+}
+
+func (a *Api) GetTasksV1Handler(w http.ResponseWriter, r *http.Request) {
+	q, err := task.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeV1Error(w, err)
+		return
+	}
+
+	tasks, next := q.Apply(a.Worker.GetTasks())
+	list := v1.TaskList{Items: []v1.Task{}, NextCursor: next}
+	for _, t := range tasks {
+		list.Items = append(list.Items, v1.FromTask(*t))
+	}
+	writeV1JSON(w, http.StatusOK, list)
+}
+
+func (a *Api) GetTaskV1Handler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		writeV1Error(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
+		return
+	}
+
+	detail, ok := a.Worker.GetTask(tID)
+	if !ok {
+		writeV1Error(w, errdefs.New(errdefs.NotFound, "No task with ID %v found", tID))
+		return
+	}
+	writeV1JSON(w, http.StatusOK, v1.FromDetail(*detail))
+}
+
+func (a *Api) PatchTaskV1Handler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	req := v1.TaskPatch{}
+	if err := d.Decode(&req); err != nil {
+		writeV1Error(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+		return
+	}
+
+	updated, err := a.patchTask(r, req.ToPatch())
+	if err != nil {
+		writeV1Error(w, err)
+		return
+	}
+	writeV1JSON(w, http.StatusAccepted, v1.FromTask(*updated))
+}
+
+func (a *Api) StopTaskV1Handler(w http.ResponseWriter, r *http.Request) {
+	tID, err := uuid.Parse(r.PathValue("taskID"))
+	if err != nil {
+		writeV1Error(w, errdefs.New(errdefs.InvalidArgument, "Invalid taskID format: %v", err))
+		return
+	}
+
+	taskToStop, ok := a.Worker.lookupTask(tID)
+	if !ok {
+		writeV1Error(w, errdefs.New(errdefs.NotFound, "No task with ID %v found", tID))
+		return
+	}
+
+	taskCopy := taskToStop
+	taskCopy.State = task.Completed
+	a.Worker.AddTask(taskCopy)
+	a.Logger.With("task_id", tID).Info("Added task %v to stop container %v", tID, taskToStop.ContainerID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) TaskStatsV1Handler(w http.ResponseWriter, r *http.Request) {
+	cs, err := a.taskStats(r)
+	if err != nil {
+		writeV1Error(w, err)
+		return
+	}
+	writeV1JSON(w, http.StatusOK, newTaskStatsV1(cs))
+}
+
+func (a *Api) StartGroupV1Handler(w http.ResponseWriter, r *http.Request) {
+	if a.Worker.Draining() {
+		writeV1Error(w, errdefs.New(errdefs.Unavailable, "Worker is shutting down, not accepting new groups"))
+		return
+	}
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	req := v1.CreateGroupRequest{}
+	if err := d.Decode(&req); err != nil {
+		writeV1Error(w, errdefs.New(errdefs.InvalidArgument, "Error unmarshalling body: %v", err))
+		return
+	}
+	if len(req.Tasks) == 0 {
+		writeV1Error(w, errdefs.New(errdefs.InvalidArgument, "Group has no tasks"))
+		return
+	}
+	g, err := req.ToGroup()
+	if err != nil {
+		writeV1Error(w, err)
+		return
+	}
+
+	queued, err := a.Worker.SubmitGroup(g)
+	if err != nil {
+		writeV1Error(w, err)
+		return
+	}
+	a.Logger.Info("Added group %v with %d tasks", queued.ID, len(queued.Tasks))
+	writeV1JSON(w, http.StatusCreated, v1.FromGroup(*queued))
+}
+
+func (a *Api) GetGroupsV1Handler(w http.ResponseWriter, r *http.Request) {
+	list := v1.GroupList{Items: []v1.Group{}}
+	for _, g := range a.Worker.GetGroups() {
+		list.Items = append(list.Items, v1.FromGroup(g))
+	}
+	writeV1JSON(w, http.StatusOK, list)
+}
+
+func (a *Api) GetGroupV1Handler(w http.ResponseWriter, r *http.Request) {
+	gID, err := uuid.Parse(r.PathValue("groupID"))
+	if err != nil {
+		writeV1Error(w, errdefs.New(errdefs.InvalidArgument, "Invalid groupID format: %v", err))
+		return
+	}
+
+	g, ok := a.Worker.GetGroup(gID)
+	if !ok {
+		writeV1Error(w, errdefs.New(errdefs.NotFound, "No group with ID %v found", gID))
+		return
+	}
+	writeV1JSON(w, http.StatusOK, v1.FromGroup(g))
+}
+
+func (a *Api) StopGroupV1Handler(w http.ResponseWriter, r *http.Request) {
+	gID, err := uuid.Parse(r.PathValue("groupID"))
+	if err != nil {
+		writeV1Error(w, errdefs.New(errdefs.InvalidArgument, "Invalid groupID format: %v", err))
+		return
+	}
+
+	g, ok := a.Worker.GetGroup(gID)
+	if !ok {
+		writeV1Error(w, errdefs.New(errdefs.NotFound, "No group with ID %v found", gID))
+		return
+	}
+
+	g.State = task.Completed
+	a.Worker.AddGroup(g)
+	a.Logger.Info("Added group %v to stop its tasks", gID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) StatsV1Handler(w http.ResponseWriter, r *http.Request) {
+	s := a.Worker.LastStats()
+	if s == nil || s.MemStats == nil || s.DiskStats == nil {
+		writeV1Error(w, errdefs.New(errdefs.Unavailable, "No statistics collected yet"))
+		return
+	}
+	writeV1JSON(w, http.StatusOK, newNodeStatsV1(s))
+}
+
+// newNodeStatsV1 sums up a statistics sample into its v1 form.
+func newNodeStatsV1(s *Stats) v1.NodeStats {
+	ns := v1.NodeStats{
+		Timestamp:      s.Timestamp,
+		CpuUtilization: s.CpuUsage(),
+		CpuCores:       float64(len(s.Cores)),
+		MemTotalKb:     s.MemTotalKb(),
+		MemAvailableKb: s.MemAvailableKb(),
+		DiskTotal:      s.DiskTotal(),
+		DiskFree:       s.DiskFree(),
+		TaskCount:      s.TaskCount,
+	}
+	if s.Capacity != nil {
+		ns.CpuCores = s.Capacity.CpuCores
+	}
+	if s.LoadStats != nil {
+		ns.LoadAvg1 = s.LoadStats.Last1Min
+		ns.LoadAvg5 = s.LoadStats.Last5Min
+		ns.LoadAvg15 = s.LoadStats.Last15Min
+	}
+	return ns
+}
+
+func newTaskStatsV1(cs *ContainerStats) v1.TaskStats {
+	return v1.TaskStats{
+		TaskID:          cs.TaskID,
+		ContainerID:     cs.ContainerID,
+		Timestamp:       cs.Timestamp,
+		CpuCores:        cs.CpuCores,
+		CpuRequested:    cs.CpuRequested,
+		MemoryUsage:     cs.MemoryUsage,
+		MemoryLimit:     cs.MemoryLimit,
+		MemoryRequested: cs.MemoryRequested,
+		NetworkRxBytes:  cs.NetworkRxBytes,
+		NetworkTxBytes:  cs.NetworkTxBytes,
+		BlockReadBytes:  cs.BlockReadBytes,
+		BlockWriteBytes: cs.BlockWriteBytes,
+		Pids:            cs.Pids,
+	}
+}
+
+func writeV1JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeV1Error writes err as a v1.Error, with the HTTP status of its errdefs.Code.
+func writeV1Error(w http.ResponseWriter, err error) {
+	code := errdefs.CodeOf(err)
+	status := errdefs.HTTPStatus(code)
+	writeV1JSON(w, status, v1.Error{Status: status, Code: string(code), Message: err.Error(), Fields: v1.FromFields(errdefs.FieldsOf(err))})
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golang-collections/collections/queue"
+	"github.com/google/uuid"
+	v1 "github.com/praaatik/tesseract/api/v1"
+	"github.com/praaatik/tesseract/errdefs"
+	"github.com/praaatik/tesseract/task"
+)
+
+func TestStartTaskV1HandlerFields(t *testing.T) {
+	w := &Worker{TaskQueue: queue.New(), TaskDb: make(map[uuid.UUID]*task.Task), Logger: testLogger}
+	a := &Api{Worker: w, Logger: testLogger}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/tasks", strings.NewReader(`{"name": "web 1", "memory": -1, "restartPolicy": "sometimes"}`))
+	rec := httptest.NewRecorder()
+	a.StartTaskV1Handler(rec, r)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	body := v1.Error{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding the error: %v", err)
+	}
+	if body.Code != string(errdefs.InvalidArgument) {
+		t.Errorf("code = %s, want %s", body.Code, errdefs.InvalidArgument)
+	}
+	fields := []string{}
+	for _, f := range body.Fields {
+		fields = append(fields, f.Field)
+	}
+	if want := []string{"name", "image", "memory", "restartPolicy"}; !slices.Equal(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+}
@@ -7,103 +7,305 @@
 package worker
 
 import (
+	"context"
 	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/docker/docker/client"
 	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
+	"github.com/praaatik/tesseract/errdefs"
 	"github.com/praaatik/tesseract/logger"
 	"github.com/praaatik/tesseract/task"
+	"github.com/praaatik/tesseract/tracing"
 )
 
+// defaultUpdateInterval is the time between two checks of the running Tasks.
+const defaultUpdateInterval = 15 * time.Second
+
 type Worker struct {
 	// Name is the human-readable name of the Worker
 	Name string
 
 	// TaskQueue is queue to accept Task from the manager and execute in a FIFO manner.
+	// It is guarded by queueMu, see enqueue, dequeue and QueueLen.
 	TaskQueue *queue.Queue
+	queueMu   sync.Mutex
+
+	// mu guards TaskDb, admitted, GroupDb, Stats and ContainerStats, which the queue loop, the statistics
+	// collection, the task updates and the API handlers all use. Once the Worker runs, they are only
+	// accessed through its methods, which hand out copies.
+	mu sync.RWMutex
 
 	// TaskDb keeps a track of the Task and it's state.
 	TaskDb map[uuid.UUID]*task.Task
 
+	// admitted holds the IDs of the submitted Tasks still waiting in the queue, see SubmitTask.
+	admitted map[uuid.UUID]bool
+
+	// GroupDb keeps a track of the Groups, their Tasks live in TaskDb.
+	GroupDb map[uuid.UUID]*GroupRecord
+
 	// TaskCount keeps a track of the number of Tasks at any given time.
 	TaskCount int
 
 	// Stats relating to the current usage
 	Stats *Stats
 
+	// StatsInterval is the time between two samples of the statistics, 15 seconds when left at zero.
+	StatsInterval time.Duration
+
+	// UpdateInterval is the time between two checks of the running Tasks, 15 seconds when left at zero.
+	UpdateInterval time.Duration
+
+	// Mounts are the mount points whose disk usage is collected, the root filesystem when empty.
+	// The Docker data root is always added to them.
+	Mounts []string
+
+	// StatsPaths tells where to read the statistics from, /proc and /sys/fs/cgroup when left empty.
+	StatsPaths StatsPaths
+
+	// History keeps the samples of the statistics over a sliding window.
+	History *StatsHistory
+
+	// ContainerStats holds the last resource usage sample of each running Task, keyed by Task ID.
+	ContainerStats map[uuid.UUID]*ContainerStats
+
 	// Logger is used to assist with logging for different levels
 	Logger *logger.Logger
+
+	// StopGracePeriod is the default time a Task is given to exit after SIGTERM before it is killed.
+	// Tasks can override it with their own StopGracePeriod.
+	StopGracePeriod time.Duration
+
+	// dockerClient is the client of the Docker daemon shared by every call of the Worker, created on
+	// first use by docker and closed by Close.
+	dockerClient *client.Client
+	dockerMu     sync.Mutex
+
+	// draining is set once the Worker stops accepting new Tasks, before shutting down.
+	draining atomic.Bool
 }
 
 func (w *Worker) StartTask(t task.Task) task.DockerResult {
 	t.StartTime = time.Now().UTC()
-	w.Logger.Info("Starting task: %v", t.ID)
+	log := w.Logger.With("task_id", t.ID)
+	log.Info("Starting task: %v", t.ID)
 
-	config := task.NewConfig(&t)
-	d := task.NewDocker(config, w.Logger)
+	ctx := tracing.ContextWithTraceParent(context.Background(), t.TraceParent)
+	ctx, span := tracing.Default.Start(ctx, "worker.start_task",
+		tracing.WithAttributes("task_id", t.ID.String(), "image", t.Image, "worker", w.Name))
+	defer span.End()
 
-	result := d.Run()
+	config := task.NewConfig(&t)
+	var result task.DockerResult
+	d, err := w.docker(config, log)
+	if err != nil {
+		result.Error = err
+	} else {
+		result = d.Run(ctx)
+	}
+	span.RecordError(result.Error)
 	if result.Error != nil {
-		w.Logger.Error("Error running task %v: %v", t.ID, result.Error)
-		t.State = task.Failed
-		w.TaskDb[t.ID] = &t
+		taskStartDuration.Observe(time.Since(t.StartTime).Seconds(), "failure")
+		log.Error("Error running task %v: %v", t.ID, result.Error)
+		t.SetState(task.Failed, fmt.Sprintf("Error starting the container: %v", result.Error))
+		w.storeTask(t)
 
 		return result
 	}
 
+	taskStartDuration.Observe(time.Since(t.StartTime).Seconds(), "success")
 	t.ContainerID = result.ContainerId
-	t.State = task.Running
-	w.TaskDb[t.ID] = &t
+	t.SetState(task.Running, "Container started")
+	log = log.With("container_id", t.ContainerID)
+	if resp, err := d.Inspect(t.ContainerID); err == nil && resp.State != nil && resp.State.Health != nil {
+		t.Health = resp.State.Health.Status
+	}
+	w.storeTask(t)
 
 	return result
 }
 
 func (w *Worker) AddTask(t task.Task) {
-	w.TaskQueue.Enqueue(t)
+	t.QueuedAt = time.Now()
+	w.enqueue(t)
 	w.Logger.Debug("Task %v added to the queue TaskQueue", t.ID)
 }
 
+// docker returns a Docker for the config using the client shared by the Worker.
+func (w *Worker) docker(config *task.Config, log *logger.Logger) (*task.Docker, error) {
+	w.dockerMu.Lock()
+	defer w.dockerMu.Unlock()
+
+	if w.dockerClient == nil {
+		dc, err := task.NewDockerClient(log)
+		if err != nil {
+			return nil, err
+		}
+		w.dockerClient = dc
+	}
+	return task.NewDockerWithClient(w.dockerClient, config, log), nil
+}
+
+// Close releases the client of the Docker daemon, once the Worker has shut down.
+func (w *Worker) Close() error {
+	w.dockerMu.Lock()
+	defer w.dockerMu.Unlock()
+
+	if w.dockerClient == nil {
+		return nil
+	}
+	err := w.dockerClient.Close()
+	w.dockerClient = nil
+	return err
+}
+
+func (w *Worker) enqueue(item any) {
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	w.TaskQueue.Enqueue(item)
+}
+
+// dequeue takes the next Task or Group off the queue, nil when it is empty.
+func (w *Worker) dequeue() any {
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	return w.TaskQueue.Dequeue()
+}
+
+// QueueLen returns the number of Tasks and Groups waiting in the queue.
+func (w *Worker) QueueLen() int {
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	return w.TaskQueue.Len()
+}
+
+// UpdateTask brings the container of a running Task to the spec of t. Limits and restart policy are
+// changed in place, while a new image, environment or command replaces the container, keeping the
+// ID of the Task. When the new container fails to start, the previous spec is started again.
+func (w *Worker) UpdateTask(t task.Task) task.DockerResult {
+	stored, ok := w.lookupTask(t.ID)
+	if !ok {
+		return task.DockerResult{Error: errdefs.New(errdefs.NotFound, "no task with ID %v found", t.ID)}
+	}
+	current := &stored
+	log := w.Logger.With("task_id", t.ID, "container_id", current.ContainerID)
+
+	// The spec comes from the update, what the container is doing from the Task as it is now.
+	t.ContainerID = current.ContainerID
+	t.StartTime = current.StartTime
+	t.Health = current.Health
+	t.History = current.History
+
+	if !task.NeedsReplace(current, &t) {
+		d, err := w.docker(task.NewConfig(&t), log)
+		if err != nil {
+			return task.DockerResult{Error: err}
+		}
+		result := d.Update(current.ContainerID)
+		if result.Error != nil {
+			log.Error("Error updating task %v: %v", t.ID, result.Error)
+			return result
+		}
+		w.storeTask(t)
+		log.Info("Updated task %v in place", t.ID)
+		return result
+	}
+
+	log.Info("Replacing the container of task %v for revision %d", t.ID, t.Revision)
+	config := task.NewConfig(current)
+	if config.StopGracePeriod == 0 {
+		config.StopGracePeriod = w.StopGracePeriod
+	}
+	d, err := w.docker(config, log)
+	if err != nil {
+		return task.DockerResult{Error: err}
+	}
+	if result := d.Stop(current.ContainerID); result.Error != nil {
+		log.Error("Error stopping container %v of task %v: %v", current.ContainerID, t.ID, result.Error)
+		return result
+	}
+
+	t.ContainerID = ""
+	result := w.StartTask(t)
+	if result.Error == nil {
+		return result
+	}
+
+	log.Warn("Revision %d of task %v failed to start, starting revision %d again", t.Revision, t.ID, current.Revision)
+	previous := *current
+	previous.ContainerID = ""
+	// Keep the failure in the History of the Task.
+	if failed, ok := w.lookupTask(t.ID); ok {
+		previous.History = failed.History
+	}
+	if rollback := w.StartTask(previous); rollback.Error != nil {
+		log.Error("Error starting revision %d of task %v again: %v", current.Revision, t.ID, rollback.Error)
+	}
+	result.Error = fmt.Errorf("replacing the container of task %v: %w", t.ID, result.Error)
+	return result
+}
+
 func (w *Worker) StopTask(t task.Task) task.DockerResult {
-	w.Logger.Info("Stopping task %v with container %v", t.ID, t.ContainerID)
+	log := w.Logger.With("task_id", t.ID, "container_id", t.ContainerID)
+	log.Info("Stopping task %v with container %v", t.ID, t.ContainerID)
 
 	config := task.NewConfig(&t)
-	d := task.NewDocker(config, w.Logger)
-
-	result := d.Stop(t.ContainerID)
+	if config.StopGracePeriod == 0 {
+		config.StopGracePeriod = w.StopGracePeriod
+	}
+	var result task.DockerResult
+	d, err := w.docker(config, log)
+	if err != nil {
+		result.Error = err
+	} else {
+		result = d.Stop(t.ContainerID)
+	}
 
 	if result.Error != nil {
-		w.Logger.Error("Error stopping container %v: %v", t.ContainerID, result.Error)
+		log.Error("Error stopping container %v: %v", t.ContainerID, result.Error)
 	}
 
 	t.FinishTime = time.Now().UTC()
-	t.State = task.Completed
-	w.TaskDb[t.ID] = &t
+	t.SetState(task.Completed, "Stopped")
+	w.storeTask(t)
 
-	w.Logger.Info("Stopped and removed container %v for task %v", t.ContainerID, t.ID)
+	log.Info("Stopped and removed container %v for task %v", t.ContainerID, t.ID)
 
 	return result
 }
 
 func (w *Worker) RunTask() task.DockerResult {
-	t := w.TaskQueue.Dequeue()
+	t := w.dequeue()
 	if t == nil {
 		w.Logger.Warn("No tasks in the queue")
 		return task.DockerResult{Error: nil}
 	}
 
+	if g, ok := t.(task.Group); ok {
+		return w.runGroup(g)
+	}
+
 	taskQueued := t.(task.Task)
-	taskPersisted := w.TaskDb[taskQueued.ID]
-	if taskPersisted == nil {
-		taskPersisted = &taskQueued
-		w.TaskDb[taskQueued.ID] = taskPersisted
+	if !taskQueued.QueuedAt.IsZero() {
+		ctx := tracing.ContextWithTraceParent(context.Background(), taskQueued.TraceParent)
+		_, span := tracing.Default.Start(ctx, "worker.queue", tracing.WithStartTime(taskQueued.QueuedAt),
+			tracing.WithAttributes("task_id", taskQueued.ID.String(), "worker", w.Name))
+		span.End()
 	}
+	taskPersisted := w.persistTask(taskQueued)
 
 	var result task.DockerResult
 	if task.ValidStateTransition(taskPersisted.State, taskQueued.State) {
 		switch taskQueued.State {
 		case task.Scheduled:
 			result = w.StartTask(taskQueued)
+		case task.Running:
+			result = w.UpdateTask(taskQueued)
 		case task.Completed:
 			result = w.StopTask(taskQueued)
 		default:
@@ -111,7 +313,8 @@ func (w *Worker) RunTask() task.DockerResult {
 
 		}
 	} else {
-		err := fmt.Errorf("Invalid transition from %v to %v", taskPersisted.State, taskQueued.State)
+		err := errdefs.New(errdefs.InvalidTransition, "invalid transition of task %v from %v to %v",
+			taskQueued.ID, taskPersisted.State, taskQueued.State)
 		w.Logger.Warn("Invalid state transition: %v", err)
 
 		result.Error = err
@@ -121,19 +324,282 @@ func (w *Worker) RunTask() task.DockerResult {
 	return result
 }
 
+// CollectStats samples the host and container statistics every StatsInterval and keeps them in History.
 func (w *Worker) CollectStats() {
+	interval := w.StatsInterval
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+
+	log := w.Logger.Named("stats")
+	mounts := w.statsMounts(log)
 	for {
-		w.Logger.Debug("Collecting statistics.")
-		w.Stats = GetStats()
-		w.Stats.TaskCount = w.TaskCount
-		time.Sleep(15 * time.Second)
+		log.Debug("Collecting statistics.")
+		stats := GetStats(w.LastStats(), w.StatsPaths, mounts, log)
+		stats.TaskCount = w.TaskCount
+		containers := w.GetContainerStats()
+		stats.Containers = summarizeContainers(containers)
+		w.mu.Lock()
+		w.ContainerStats = containers
+		w.Stats = stats
+		w.mu.Unlock()
+		if w.History != nil {
+			w.History.Add(stats)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// statsMounts returns the mount points to collect the disk usage of: Mounts and the Docker data root.
+func (w *Worker) statsMounts(log *logger.Logger) []string {
+	mounts := slices.Clone(w.Mounts)
+	if len(mounts) == 0 {
+		mounts = []string{"/"}
+	}
+
+	root, err := task.DockerRootDir()
+	if err != nil {
+		log.Warn("Could not find the Docker data root, its disk usage will not be collected: %v", err)
+		return mounts
 	}
+	if !slices.Contains(mounts, root) {
+		mounts = append(mounts, root)
+	}
+	return mounts
 }
 
+// GetTasks returns copies of every Task known to the Worker.
 func (w *Worker) GetTasks() []*task.Task {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
 	existingTasks := []*task.Task{}
 	for _, t := range w.TaskDb {
-		existingTasks = append(existingTasks, t)
+		copied := *t
+		existingTasks = append(existingTasks, &copied)
 	}
 	return existingTasks
 }
+
+// LastStats returns the last Stats collected, nil before the first collection. Stats are replaced
+// as a whole, never changed once collected.
+func (w *Worker) LastStats() *Stats {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.Stats
+}
+
+// lookupTask returns a copy of the Task with the given ID, or false when the Task is unknown.
+func (w *Worker) lookupTask(id uuid.UUID) (task.Task, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	t, ok := w.TaskDb[id]
+	if !ok {
+		return task.Task{}, false
+	}
+	return *t, true
+}
+
+// storeTask records t, replacing the Task with the same ID.
+func (w *Worker) storeTask(t task.Task) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.TaskDb[t.ID] = &t
+}
+
+// changeTask applies change to the Task with the given ID, or returns false when the Task is unknown.
+func (w *Worker) changeTask(id uuid.UUID, change func(t *task.Task)) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	t, ok := w.TaskDb[id]
+	if !ok {
+		return false
+	}
+	change(t)
+	return true
+}
+
+// GetTask returns a copy of the Task with the given ID with the status of its container, or false
+// when the Task is unknown. A container which cannot be inspected is reported in ContainerError.
+func (w *Worker) GetTask(id uuid.UUID) (*task.Detail, bool) {
+	stored, ok := w.lookupTask(id)
+	if !ok {
+		return nil, false
+	}
+	t := &stored
+
+	detail := &task.Detail{Task: t, Node: w.Name}
+	if t.ContainerID == "" {
+		return detail, true
+	}
+
+	d, err := w.docker(task.NewConfig(t), w.Logger.With("task_id", t.ID, "container_id", t.ContainerID))
+	if err != nil {
+		detail.ContainerError = err.Error()
+		return detail, true
+	}
+	resp, err := d.Inspect(t.ContainerID)
+	if err != nil {
+		detail.ContainerError = err.Error()
+		return detail, true
+	}
+	detail.Container = task.NewContainerStatus(resp)
+	return detail, true
+}
+
+// Drain makes the Worker stop accepting new Tasks. Tasks already accepted keep running.
+func (w *Worker) Drain() {
+	if !w.draining.Swap(true) {
+		w.Logger.Info("Worker is draining, no new tasks will be accepted")
+	}
+}
+
+// Draining reports whether the Worker has stopped accepting new Tasks.
+func (w *Worker) Draining() bool {
+	return w.draining.Load()
+}
+
+// Shutdown drains the Worker and brings every running Task to an end.
+// When wait is true the running Tasks are given until ctx is done to exit on their own,
+// whatever is still running afterwards is stopped using its stop grace period.
+// Tasks still sitting in the queue are discarded since they were never started.
+func (w *Worker) Shutdown(ctx context.Context, wait bool) {
+	w.Drain()
+
+	if wait {
+		w.waitForTasks(ctx)
+	}
+
+	for _, t := range w.runningTasks() {
+		w.StopTask(t)
+	}
+
+	for w.QueueLen() != 0 {
+		switch queued := w.dequeue().(type) {
+		case task.Task:
+			w.Logger.Warn("Discarding queued task %v, worker is shutting down", queued.ID)
+		case task.Group:
+			w.Logger.Warn("Discarding queued group %v, worker is shutting down", queued.ID)
+		}
+	}
+
+	for _, t := range w.GetTasks() {
+		w.Logger.Info("Task %v finished shutdown in state %v", t.ID, t.State)
+	}
+}
+
+// waitForTasks polls the containers of the running Tasks until all of them have exited or ctx is done.
+func (w *Worker) waitForTasks(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		running := w.runningTasks()
+		if len(running) == 0 {
+			w.Logger.Info("All tasks have exited")
+			return
+		}
+		w.Logger.Info("Waiting for %d running tasks to exit", len(running))
+
+		select {
+		case <-ctx.Done():
+			w.Logger.Warn("Timed out waiting for %d running tasks, stopping them", len(running))
+			return
+		case <-ticker.C:
+		}
+
+		for _, t := range running {
+			w.updateExitedTask(t)
+		}
+	}
+}
+
+// updateExitedTask moves a Task whose container is no longer running, or is gone, to its final state.
+// The health of containers which are still running is refreshed. t is a copy of the Task, the stored
+// one is only changed while it still runs the same container.
+func (w *Worker) updateExitedTask(t task.Task) {
+	log := w.Logger.With("task_id", t.ID, "container_id", t.ContainerID)
+	d, err := w.docker(task.NewConfig(&t), log)
+	if err != nil {
+		return
+	}
+	resp, err := d.Inspect(t.ContainerID)
+
+	var change func(current *task.Task)
+	switch {
+	case err != nil:
+		if !errdefs.Is(err, errdefs.NotFound) {
+			return
+		}
+		log.Warn("Container %s of task %v no longer exists", t.ContainerID, t.ID)
+		change = func(current *task.Task) {
+			current.FinishTime = time.Now().UTC()
+			current.SetState(task.Failed, "Container no longer exists")
+		}
+	case resp.State == nil:
+		return
+	default:
+		state := resp.State
+		change = func(current *task.Task) {
+			if state.Health != nil {
+				current.Health = state.Health.Status
+			}
+			if state.Running {
+				return
+			}
+			current.FinishTime = time.Now().UTC()
+			reason := fmt.Sprintf("Container exited with code %d", state.ExitCode)
+			if state.ExitCode == 0 {
+				current.SetState(task.Completed, reason)
+			} else {
+				current.SetState(task.Failed, reason)
+			}
+		}
+		if !state.Running {
+			log.Info("Task %v exited with code %d", t.ID, state.ExitCode)
+		}
+	}
+
+	w.changeTask(t.ID, func(current *task.Task) {
+		// The Task may have been stopped or given a new container since it was inspected.
+		if current.State == task.Running && current.ContainerID == t.ContainerID {
+			change(current)
+		}
+	})
+}
+
+// UpdateTasks records the running Tasks whose containers have exited.
+func (w *Worker) UpdateTasks() {
+	for _, t := range w.runningTasks() {
+		w.updateExitedTask(t)
+	}
+}
+
+// UpdateTasksForever checks the running Tasks every UpdateInterval.
+func (w *Worker) UpdateTasksForever() {
+	interval := w.UpdateInterval
+	if interval <= 0 {
+		interval = defaultUpdateInterval
+	}
+	for {
+		w.Logger.Debug("Checking status of running tasks.")
+		w.UpdateTasks()
+		time.Sleep(interval)
+	}
+}
+
+// runningTasks returns copies of the Tasks which are Running.
+func (w *Worker) runningTasks() []task.Task {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	running := []task.Task{}
+	for _, t := range w.TaskDb {
+		if t.State == task.Running {
+			running = append(running, *t)
+		}
+	}
+	return running
+}